@@ -0,0 +1,193 @@
+// Package agent runs Monty as a remote probe: without a database, it checks the endpoints a central
+// server assigns to its location with the worker's checkers and reports the results back
+package agent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/monty/models"
+	"github.com/monty/worker"
+)
+
+// Defaults, overridden by MONTY_BUFFER_DIR, MONTY_BUFFER_MAX_BATCHES, MONTY_DISCOVERY_INTERVAL and
+// MONTY_PUSH_INTERVAL
+const (
+	defaultBufferDir         = "probe-buffer"
+	defaultBufferMaxBatches  = 10000
+	defaultDiscoveryInterval = 30 * time.Second
+	defaultPushInterval      = 10 * time.Second
+)
+
+// maxBatchSize is the most results sent in one request, the server's limit
+const maxBatchSize = 1000
+
+// Config configures an agent
+type Config struct {
+	Server            string        // central server's base URL
+	Token             string        // the probe's token, from registering it on the server
+	BufferDir         string        // where undelivered results are kept
+	BufferMaxBatches  int           // batches kept at most, the oldest are dropped beyond
+	DiscoveryInterval time.Duration // how often the assigned endpoints are fetched
+	PushInterval      time.Duration // how often results are sent
+}
+
+// ConfigFromEnv reads the agent's configuration from the environment
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Server:            os.Getenv("MONTY_SERVER"),
+		Token:             os.Getenv("MONTY_PROBE_TOKEN"),
+		BufferDir:         os.Getenv("MONTY_BUFFER_DIR"),
+		BufferMaxBatches:  envInt("MONTY_BUFFER_MAX_BATCHES", defaultBufferMaxBatches),
+		DiscoveryInterval: time.Duration(envInt("MONTY_DISCOVERY_INTERVAL", 0)) * time.Second,
+		PushInterval:      time.Duration(envInt("MONTY_PUSH_INTERVAL", 0)) * time.Second,
+	}
+	if config.Server == "" || config.Token == "" {
+		return config, errors.New("MONTY_SERVER and MONTY_PROBE_TOKEN are required")
+	}
+	return config, nil
+}
+
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("ignoring invalid %s=%q", name, raw)
+		return fallback
+	}
+	return n
+}
+
+// Agent is the worker's remote in a probe: it fetches the endpoints from the server and collects
+// the results, which are written to the buffer and pushed from there
+type Agent struct {
+	client *Client
+	buffer *buffer
+	health func() *models.ProbeHealth // the worker's canaries, reported along with the results
+
+	mu      sync.Mutex
+	results []models.ProbeResult // collected since the last spool
+}
+
+func New(config Config) (*Agent, error) {
+	if config.BufferDir == "" {
+		config.BufferDir = defaultBufferDir
+	}
+	if config.BufferMaxBatches <= 0 {
+		config.BufferMaxBatches = defaultBufferMaxBatches
+	}
+	buf, err := newBuffer(config.BufferDir, config.BufferMaxBatches)
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{client: NewClient(config.Server, config.Token), buffer: buf}, nil
+}
+
+// Endpoints returns the endpoints assigned to the probe
+func (a *Agent) Endpoints() ([]models.Endpoint, error) {
+	return a.client.Endpoints()
+}
+
+// Record collects a check's result for the next push
+func (a *Agent) Record(ep worker.Endpoint, result worker.Result) {
+	report, err := worker.ProbeResult(ep, result)
+	if err != nil {
+		log.Printf("Failed to report result for %s: %v", ep.URL, err)
+		return
+	}
+	a.mu.Lock()
+	a.results = append(a.results, report)
+	full := len(a.results) >= maxBatchSize
+	a.mu.Unlock()
+	if full {
+		a.spool()
+	}
+}
+
+// spool writes the collected results to the buffer
+func (a *Agent) spool() {
+	a.mu.Lock()
+	results := a.results
+	a.results = nil
+	a.mu.Unlock()
+
+	var health *models.ProbeHealth
+	if a.health != nil {
+		health = a.health()
+	}
+	for len(results) > 0 {
+		n := min(len(results), maxBatchSize)
+		if err := a.buffer.add(models.ProbeReport{Results: results[:n], Health: health}); err != nil {
+			log.Printf("Failed to buffer %d results: %v", n, err)
+		}
+		results = results[n:]
+	}
+}
+
+// push spools the collected results and sends what the buffer holds
+func (a *Agent) push() {
+	a.spool()
+	sent, err := a.buffer.flush(a.client.Push)
+	if err != nil {
+		pending, _ := a.buffer.pending()
+		log.Printf("Failed to push results, %d batches buffered: %v", pending, err)
+		return
+	}
+	if sent > 0 {
+		log.Printf("Pushed %d result batches", sent)
+	}
+}
+
+// Run checks the probe's endpoints until ctx ends, then waits for the running checks up to
+// shutdownTimeout and makes a last attempt to push their results
+func Run(ctx context.Context, config Config, shutdownTimeout time.Duration) error {
+	a, err := New(config)
+	if err != nil {
+		return err
+	}
+	discoveryInterval := config.DiscoveryInterval
+	if discoveryInterval <= 0 {
+		discoveryInterval = defaultDiscoveryInterval
+	}
+	pushInterval := config.PushInterval
+	if pushInterval <= 0 {
+		pushInterval = defaultPushInterval
+	}
+
+	w := worker.NewRemoteWorker(a, discoveryInterval)
+	a.health = func() *models.ProbeHealth {
+		stats, ok := w.Canary()
+		if !ok || stats.CheckedAt.IsZero() {
+			return nil
+		}
+		return &models.ProbeHealth{Healthy: stats.Healthy, CheckedAt: stats.CheckedAt}
+	}
+	w.Start(nil)
+	log.Printf("Probe agent reporting to %s", config.Server)
+
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.push()
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := w.Shutdown(shutdownCtx); err != nil {
+				log.Printf("checks still running at the shutdown deadline were cancelled: %v", err)
+			}
+			// Whatever isn't delivered now stays buffered for the next start
+			a.push()
+			return nil
+		}
+	}
+}
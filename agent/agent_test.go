@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"github.com/monty/worker"
+)
+
+// fakeServer is a central server's agent API that accepts one token
+type fakeServer struct {
+	mu        sync.Mutex
+	endpoints []models.Endpoint
+	reports   []models.ProbeReport
+	down      bool
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/api/agent/endpoints":
+		json.NewEncoder(w).Encode(s.endpoints)
+	case "/api/agent/results":
+		var report models.ProbeReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.reports = append(s.reports, report)
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestClientAuthenticates(t *testing.T) {
+	fake := &fakeServer{endpoints: []models.Endpoint{{ID: "ep-1", URL: "http://example.com", Interval: 60}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	endpoints, err := NewClient(server.URL+"/", "secret").Endpoints()
+	if err != nil {
+		t.Fatalf("failed to get endpoints: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != "ep-1" {
+		t.Errorf("expected the assigned endpoint, got %+v", endpoints)
+	}
+
+	_, err = NewClient(server.URL, "wrong").Endpoints()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized || statusErr.Rejected() {
+		t.Errorf("expected a retryable status error for a rejected token, got %v", err)
+	}
+}
+
+func TestAgentBuffersWhileServerIsDown(t *testing.T) {
+	fake := &fakeServer{down: true}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a, err := New(Config{Server: server.URL, Token: "secret", BufferDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	ep := worker.Endpoint{ID: "ep-1", URL: "http://example.com"}
+	result := worker.Result{Status: &models.Status{ID: uuid.New().String(), Code: 200, CheckedAt: time.Now()}}
+
+	a.Record(ep, result)
+	a.push()
+	if pending, _ := a.buffer.pending(); pending != 1 {
+		t.Fatalf("expected the batch buffered while the server is down, got %d", pending)
+	}
+
+	fake.mu.Lock()
+	fake.down = false
+	fake.mu.Unlock()
+	a.push()
+
+	if pending, _ := a.buffer.pending(); pending != 0 {
+		t.Errorf("expected the buffer delivered, got %d batches left", pending)
+	}
+	if len(fake.reports) != 1 || len(fake.reports[0].Results) != 1 {
+		t.Fatalf("expected one batch with one result, got %+v", fake.reports)
+	}
+	got := fake.reports[0].Results[0]
+	if got.EndpointID != "ep-1" || got.Status == nil || got.Status.ID != result.Status.ID {
+		t.Errorf("expected the recorded result, got %+v", got)
+	}
+}
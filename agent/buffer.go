@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// buffer keeps the batches of results not yet delivered in a directory, one JSON file per batch,
+// so they survive the central server being unreachable and the agent restarting. Batches are
+// delivered oldest first, and the oldest are dropped when more than max are waiting
+type buffer struct {
+	dir string
+	max int
+
+	mu  sync.Mutex
+	seq int // orders batches written in the same nanosecond
+}
+
+func newBuffer(dir string, max int) (*buffer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &buffer{dir: dir, max: max}, nil
+}
+
+// add writes a batch to the buffer
+func (b *buffer) add(report models.ProbeReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), b.seq%1000000)
+	// Write under a temporary name so a crash never leaves a partial batch to deliver
+	tmp := filepath.Join(b.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(b.dir, name)); err != nil {
+		return err
+	}
+	return b.trimLocked()
+}
+
+// trimLocked drops the oldest batches beyond max
+func (b *buffer) trimLocked() error {
+	names, err := b.pendingLocked()
+	if err != nil {
+		return err
+	}
+	for len(names) > b.max {
+		log.Printf("Result buffer full, dropping batch %s", names[0])
+		if err := os.Remove(filepath.Join(b.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// pending returns the number of batches waiting
+func (b *buffer) pending() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names, err := b.pendingLocked()
+	return len(names), err
+}
+
+// pendingLocked returns the batches' file names, oldest first
+func (b *buffer) pendingLocked() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// flush sends the waiting batches oldest first, removing each once send accepted it, and stops at
+// the first one it fails to send. Batches that can't be read are dropped, and so are batches the
+// server rejected for good, which would otherwise hold up all later ones
+func (b *buffer) flush(send func(models.ProbeReport) error) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names, err := b.pendingLocked()
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, name := range names {
+		path := filepath.Join(b.dir, name)
+		var report models.ProbeReport
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &report)
+		}
+		if err != nil {
+			log.Printf("Dropping unreadable result batch %s: %v", name, err)
+			os.Remove(path)
+			continue
+		}
+		if err := send(report); err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.Rejected() {
+				log.Printf("Dropping result batch %s the server rejected: %v", name, err)
+				os.Remove(path)
+				continue
+			}
+			return sent, err
+		}
+		if err := os.Remove(path); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/monty/models"
+)
+
+func report(endpointID string) models.ProbeReport {
+	return models.ProbeReport{Results: []models.ProbeResult{{EndpointID: endpointID}}}
+}
+
+func TestBufferFlushesOldestFirst(t *testing.T) {
+	buf, err := newBuffer(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("failed to create buffer: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := buf.add(report(id)); err != nil {
+			t.Fatalf("failed to add batch: %v", err)
+		}
+	}
+
+	// The server is unreachable after the first batch, the rest stay buffered
+	var sent []string
+	n, err := buf.flush(func(r models.ProbeReport) error {
+		if len(sent) == 1 {
+			return errors.New("connection refused")
+		}
+		sent = append(sent, r.Results[0].EndpointID)
+		return nil
+	})
+	if err == nil || n != 1 {
+		t.Fatalf("expected 1 batch sent before the error, got %d, %v", n, err)
+	}
+	if pending, _ := buf.pending(); pending != 2 {
+		t.Fatalf("expected 2 batches still buffered, got %d", pending)
+	}
+
+	n, err = buf.flush(func(r models.ProbeReport) error {
+		sent = append(sent, r.Results[0].EndpointID)
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("expected the 2 buffered batches sent, got %d, %v", n, err)
+	}
+	if len(sent) != 3 || sent[0] != "a" || sent[1] != "b" || sent[2] != "c" {
+		t.Errorf("expected batches sent in order, got %v", sent)
+	}
+	if pending, _ := buf.pending(); pending != 0 {
+		t.Errorf("expected an empty buffer, got %d batches", pending)
+	}
+}
+
+func TestBufferDropsOldestWhenFull(t *testing.T) {
+	dir := t.TempDir()
+	buf, err := newBuffer(dir, 2)
+	if err != nil {
+		t.Fatalf("failed to create buffer: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if err := buf.add(report(id)); err != nil {
+			t.Fatalf("failed to add batch: %v", err)
+		}
+	}
+
+	// Batches survive a restart
+	buf, err = newBuffer(dir, 2)
+	if err != nil {
+		t.Fatalf("failed to reopen buffer: %v", err)
+	}
+	var sent []string
+	buf.flush(func(r models.ProbeReport) error {
+		sent = append(sent, r.Results[0].EndpointID)
+		return nil
+	})
+	if len(sent) != 2 || sent[0] != "b" || sent[1] != "c" {
+		t.Errorf("expected the newest 2 batches kept, got %v", sent)
+	}
+}
+
+func TestBufferDropsRejectedBatches(t *testing.T) {
+	buf, err := newBuffer(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("failed to create buffer: %v", err)
+	}
+	for _, id := range []string{"invalid", "too-large", "forbidden", "valid"} {
+		if err := buf.add(report(id)); err != nil {
+			t.Fatalf("failed to add batch: %v", err)
+		}
+	}
+
+	// A batch the server won't ever take is dropped, any other refusal keeps the batch for later
+	responses := map[string]error{
+		"invalid":   &StatusError{StatusCode: 400, Status: "400 Bad Request", Message: "invalid result"},
+		"too-large": &StatusError{StatusCode: 413, Status: "413 Request Entity Too Large", Message: "body too large"},
+		"forbidden": &StatusError{StatusCode: 403, Status: "403 Forbidden", Message: "probe disabled"},
+	}
+	n, err := buf.flush(func(r models.ProbeReport) error {
+		return responses[r.Results[0].EndpointID]
+	})
+	if err == nil || n != 0 {
+		t.Fatalf("expected the flush to stop at the forbidden batch, got %d, %v", n, err)
+	}
+	if pending, _ := buf.pending(); pending != 2 {
+		t.Fatalf("expected the rejected batches dropped and 2 kept, got %d", pending)
+	}
+
+	var sent []string
+	n, err = buf.flush(func(r models.ProbeReport) error {
+		sent = append(sent, r.Results[0].EndpointID)
+		return nil
+	})
+	if err != nil || n != 2 || sent[0] != "forbidden" || sent[1] != "valid" {
+		t.Errorf("expected the kept batches sent, got %v, %v", sent, err)
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// clientTimeout bounds a request to the central server
+const clientTimeout = 30 * time.Second
+
+// Client talks to the agent API of a central Monty server as a probe
+type Client struct {
+	server string // base URL, e.g. https://monty.example.com
+	token  string
+	http   *http.Client
+}
+
+func NewClient(server, token string) *Client {
+	return &Client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: clientTimeout},
+	}
+}
+
+// Endpoints returns the endpoints assigned to the probe
+func (c *Client) Endpoints() ([]models.Endpoint, error) {
+	var endpoints []models.Endpoint
+	if err := c.do(http.MethodGet, "/api/agent/endpoints", nil, &endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// Push sends a batch of results. The server ignores results it already stored, so a batch whose
+// response was lost can be sent again
+func (c *Client) Push(report models.ProbeReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPost, "/api/agent/results", body, nil)
+}
+
+// StatusError is a request the server answered with a status other than 200
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Message    string // the start of the response body
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// Rejected reports whether the server refused the request for good: the request itself is
+// malformed, too large or invalid, and sending it again won't change that. Other errors, such as
+// a refused token, a missing route while the server is upgraded or rate limiting, may pass
+func (e *StatusError) Rejected() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// do sends a request with the probe's token and decodes the response into out, when given. A
+// response other than 200 is returned as a *StatusError
+func (c *Client) do(method, path string, body []byte, out any) error {
+	req, err := http.NewRequest(method, c.server+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{
+			Method: method, Path: path, StatusCode: resp.StatusCode, Status: resp.Status,
+			Message: string(bytes.TrimSpace(message)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
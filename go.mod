@@ -3,8 +3,14 @@ module github.com/monty
 go 1.23.4
 
 require (
+	github.com/andybalholm/cascadia v1.3.2
 	github.com/gofiber/fiber/v2 v2.52.0
 	github.com/google/uuid v1.5.0
+	github.com/miekg/dns v1.1.57
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
 	gorm.io/driver/postgres v1.5.2
 	gorm.io/driver/sqlite v1.5.2
 	gorm.io/gorm v1.25.5
@@ -29,7 +35,6 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasthttp v1.51.0 // indirect
 	github.com/valyala/tcplisten v1.0.0 // indirect
-	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 )
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/worker"
+)
+
+func RegisterCheckTypes(app fiber.Router) {
+	app.Get("/check-types", listCheckTypes)
+}
+
+// CheckTypeInfo describes a check type and the endpoint settings it takes
+type CheckTypeInfo struct {
+	Type        string         `json:"type"`
+	Description string         `json:"description"`
+	Schema      map[string]any `json:"schema"` // JSON schema of an endpoint of the type
+}
+
+// listCheckTypes lists the check types endpoints can use, sorted by name
+func listCheckTypes(c *fiber.Ctx) error {
+	checkers := worker.Checkers()
+	response := make([]CheckTypeInfo, 0, len(checkers))
+	for _, checker := range checkers {
+		response = append(response, CheckTypeInfo{
+			Type:        checker.Name(),
+			Description: checker.Description(),
+			Schema:      worker.Schema(checker),
+		})
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestListCheckTypes(t *testing.T) {
+	app := fiber.New()
+	RegisterCheckTypes(app)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/check-types", nil), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var body []CheckTypeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	types := make(map[string]CheckTypeInfo, len(body))
+	for _, info := range body {
+		types[info.Type] = info
+	}
+	for _, name := range []string{"http", "ssl", "dns", "dns_propagation", "email_auth", "exec", "prometheus", "domain", "ping", "tcp", "ssh", "ntp", "heartbeat", "transaction"} {
+		if _, ok := types[name]; !ok {
+			t.Errorf("expected check type %s to be listed", name)
+		}
+	}
+
+	properties, _ := types["tcp"].Schema["properties"].(map[string]any)
+	if _, ok := properties["tcp_port"]; !ok {
+		t.Errorf("expected tcp schema to describe tcp_port, got %v", properties)
+	}
+	if _, ok := properties["url"]; !ok {
+		t.Errorf("expected tcp schema to describe the common settings, got %v", properties)
+	}
+	properties, _ = types["heartbeat"].Schema["properties"].(map[string]any)
+	if _, ok := properties["retries"]; ok {
+		t.Error("expected heartbeat schema not to offer retries")
+	}
+}
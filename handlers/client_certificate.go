@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/models"
+)
+
+type ClientCertificateWithExpiry struct {
+	models.ClientCertificate
+	DaysUntilExpiry int `json:"days_until_expiry"`
+}
+
+func RegisterClientCertificates(app fiber.Router) {
+	app.Get("/client-certificates", listClientCertificates)
+	app.Post("/client-certificates", createClientCertificate)
+	app.Delete("/client-certificates/:id", deleteClientCertificate)
+}
+
+func listClientCertificates(c *fiber.Ctx) error {
+	var certs []models.ClientCertificate
+	models.DB.Order("expires_at").Find(&certs)
+
+	response := make([]ClientCertificateWithExpiry, 0, len(certs))
+	for _, cert := range certs {
+		response = append(response, ClientCertificateWithExpiry{
+			ClientCertificate: cert,
+			DaysUntilExpiry:   int(time.Until(cert.ExpiresAt).Hours() / 24),
+		})
+	}
+	return c.JSON(response)
+}
+
+func createClientCertificate(c *fiber.Ctx) error {
+	var input struct {
+		Name        string `json:"name"`
+		Certificate string `json:"certificate,omitempty"` // PEM certificate chain, leaf first
+		PrivateKey  string `json:"private_key,omitempty"` // PEM private key
+		PKCS12      string `json:"pkcs12,omitempty"`      // base64 encoded PKCS#12 bundle, instead of PEM
+		Password    string `json:"password,omitempty"`    // PKCS#12 password
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name must be provided"})
+	}
+
+	var cert models.ClientCertificate
+	var err error
+	switch {
+	case input.PKCS12 != "":
+		data, decodeErr := base64.StdEncoding.DecodeString(input.PKCS12)
+		if decodeErr != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "pkcs12 must be base64 encoded"})
+		}
+		cert, err = models.NewClientCertificateFromPKCS12(input.Name, data, input.Password)
+	case input.Certificate != "" && input.PrivateKey != "":
+		cert, err = models.NewClientCertificate(input.Name, []byte(input.Certificate), []byte(input.PrivateKey))
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "certificate and private_key, or pkcs12, must be provided"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid client certificate"})
+	}
+
+	if err := models.DB.Create(&cert).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store client certificate"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ClientCertificateWithExpiry{
+		ClientCertificate: cert,
+		DaysUntilExpiry:   int(time.Until(cert.ExpiresAt).Hours() / 24),
+	})
+}
+
+func deleteClientCertificate(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "client certificate id required"})
+	}
+
+	var cert models.ClientCertificate
+	if err := models.DB.First(&cert, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "client certificate not found"})
+	}
+
+	var inUse int64
+	models.DB.Model(&models.Endpoint{}).Where("client_certificate_id = ?", id).Count(&inUse)
+	if inUse > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "client certificate is used by endpoints"})
+	}
+
+	if err := models.DB.Delete(&cert).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete client certificate"})
+	}
+
+	return c.JSON(fiber.Map{"message": "client certificate deleted successfully"})
+}
+
+// clientCertificateExists reports whether id refers to a stored client certificate
+func clientCertificateExists(id string) bool {
+	var count int64
+	models.DB.Model(&models.ClientCertificate{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
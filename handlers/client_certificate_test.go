@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/models"
+)
+
+func newClientCertificateTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+
+	app := fiber.New()
+	RegisterEndpoints(app)
+	RegisterClientCertificates(app)
+	return app
+}
+
+func selfSignedPEM(t *testing.T, notAfter time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "monty-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestCreateClientCertificate(t *testing.T) {
+	app := newClientCertificateTestApp(t)
+
+	certPEM, keyPEM := selfSignedPEM(t, time.Now().Add(20*24*time.Hour+time.Hour))
+	payload, _ := json.Marshal(map[string]string{"name": "internal-api", "certificate": certPEM, "private_key": keyPEM})
+	req := httptest.NewRequest(http.MethodPost, "/client-certificates", strings.NewReader(string(payload)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, leaked := body["PrivateKeyPEM"]; leaked {
+		t.Fatalf("private key must not be returned")
+	}
+	if body["days_until_expiry"] != float64(20) {
+		t.Fatalf("expected 20 days until expiry, got %v", body["days_until_expiry"])
+	}
+	if body["subject"] != "CN=monty-client" {
+		t.Fatalf("unexpected subject %v", body["subject"])
+	}
+
+	// Endpoints can reference the stored certificate, and it can't be deleted while in use
+	id := body["id"].(string)
+	epPayload := `{"url":"https://internal.example.com","interval":60,"client_certificate_id":"` + id + `"}`
+	req = httptest.NewRequest(http.MethodPost, "/endpoints", strings.NewReader(epPayload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/client-certificates/"+id, nil)
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+}
+
+func TestCreateClientCertificateValidation(t *testing.T) {
+	app := newClientCertificateTestApp(t)
+
+	certPEM, _ := selfSignedPEM(t, time.Now().Add(time.Hour))
+	_, otherKeyPEM := selfSignedPEM(t, time.Now().Add(time.Hour))
+
+	payloads := []map[string]string{
+		{"name": "mismatched", "certificate": certPEM, "private_key": otherKeyPEM},
+		{"name": "missing key", "certificate": certPEM},
+		{"name": "bad bundle", "pkcs12": "bm90IGEgYnVuZGxl", "password": "secret"},
+	}
+	for _, p := range payloads {
+		payload, _ := json.Marshal(p)
+		req := httptest.NewRequest(http.MethodPost, "/client-certificates", strings.NewReader(string(payload)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected status %d, got %d", p["name"], http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+
+	var count int64
+	models.DB.Model(&models.ClientCertificate{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no stored certificates, got %d", count)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/endpoints", strings.NewReader(`{"url":"https://x","interval":60,"client_certificate_id":"missing"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -17,6 +17,49 @@ models.Endpoint
 Uptime float64 `json:"uptime"`
 }
 
+// EndpointWithToken is a heartbeat endpoint with the token its job pings, which is only returned by
+// the request that generated it
+type EndpointWithToken struct {
+	models.Endpoint
+	HeartbeatToken string `json:"heartbeat_token,omitempty"`
+}
+
+// validationErrors maps the models' validation errors to API error messages
+var validationErrors = []struct {
+	err     error
+	message string
+}{
+	{models.ErrInvalidEndpoint, "invalid endpoint configuration"},
+	{models.ErrUnknownCheckType, "unknown check type"},
+	{models.ErrInvalidSchedule, "invalid heartbeat schedule"},
+	{models.ErrInvalidTransaction, "invalid transaction steps"},
+	{models.ErrInvalidContentWatch, "invalid content watch configuration"},
+	{models.ErrInvalidProxy, "invalid proxy url"},
+	{models.ErrInvalidAddressFamily, "invalid address family"},
+	{models.ErrInvalidResolvers, "invalid dns resolvers"},
+	{models.ErrInvalidTrustAnchor, "invalid dnssec trust anchor"},
+	{models.ErrInvalidExecEnv, "invalid exec environment"},
+	{worker.ErrExecNotAllowed, "exec command is not in an allowed plugin directory"},
+	{models.ErrInvalidMetricAssertion, "invalid metric assertion"},
+	{models.ErrInvalidSecurityGrade, "invalid security grade"},
+	{models.ErrInvalidExpectFailure, "expect_failure is only supported by http, tcp and ping checks"},
+	{models.ErrInvalidRetries, "invalid retries"},
+	{models.ErrInvalidProbeLocations, "invalid probe locations"},
+	{models.ErrInvalidQuorum, "invalid quorum"},
+	{models.ErrInvalidSSHHostKey, "invalid ssh host key fingerprint"},
+	{models.ErrInvalidSSHHostKeyAlgorithm, "invalid ssh host key algorithm"},
+	{models.ErrInvalidSSHAuth, "ssh_username and ssh_key_id must be set together"},
+}
+
+func validationMessage(err error) (string, bool) {
+	for _, v := range validationErrors {
+		if errors.Is(err, v.err) {
+			return v.message, true
+		}
+	}
+	return "", false
+}
+
 func RegisterEndpoints(app fiber.Router) {
 	app.Get("/endpoints", listEndpoints)
 	app.Post("/endpoints", createEndpoint)
@@ -25,6 +68,16 @@ func RegisterEndpoints(app fiber.Router) {
 	app.Get("/endpoint-urls", listEndpointURLs)
 	app.Get("/statuses", listStatuses)
 	app.Get("/endpoints/:id/statuses", listEndpointStatuses)
+	app.Get("/endpoints/:id/step-results", listEndpointStepResults)
+	app.Get("/endpoints/:id/content-changes", listEndpointContentChanges)
+	app.Get("/endpoints/:id/resolver-results", listEndpointResolverResults)
+	app.Get("/endpoints/:id/dnssec-signatures", listEndpointDNSSECSignatures)
+	app.Get("/endpoints/:id/email-auth-findings", listEndpointEmailAuthFindings)
+	app.Get("/endpoints/:id/exec-metrics", listEndpointExecMetrics)
+	app.Get("/endpoints/:id/security-header-findings", listEndpointSecurityHeaderFindings)
+	app.Get("/endpoints/:id/ntp-results", listEndpointNTPResults)
+	app.Get("/incidents", listIncidents)
+	app.Get("/endpoints/:id/incidents", listEndpointIncidents)
 	// SSL status endpoints
 	app.Get("/ssl-statuses", listSSLStatuses)
 	app.Get("/endpoints/:id/ssl-statuses", listEndpointSSLStatuses)
@@ -44,32 +97,24 @@ func calculateUptime(endpointID string) float64 {
 		return calculateSSLUptime(endpointID)
 	}
 
-	// HTTP uptime calculation
+	// Results taken while the checker's own network was down don't count either way
 	var statuses []models.Status
-	models.DB.Where("endpoint_id = ?", endpointID).Find(&statuses)
+	models.DB.Scopes(models.KnownResults).Where("endpoint_id = ?", endpointID).Find(&statuses)
 
 	if len(statuses) == 0 {
 		return 0
 	}
 
-	expectedCodes := []int(ep.ExpectedStatusCodes)
-	if len(expectedCodes) == 0 {
-		expectedCodes = []int{200, 201, 202, 203, 204, 205, 206, 207, 208, 226, 300, 301, 302, 303, 304, 305, 307, 308}
+	// Each check type judges its own statuses, most pass when nothing was wrong while HTTP checks
+	// compare codes and response times
+	config, ok := models.LookupCheckConfig(ep.CheckType)
+	if !ok {
+		return 0
 	}
-
 	successful := 0
-	for _, status := range statuses {
-		if status.ErrorMessage == "" { // No network error
-			codeExpected := false
-			for _, code := range expectedCodes {
-				if status.Code == code {
-					codeExpected = true
-					break
-				}
-			}
-			if codeExpected && status.ResponseTime <= ep.MaxResponseTime {
-				successful++
-			}
+	for i := range statuses {
+		if config.Passed(&ep, &statuses[i]) {
+			successful++
 		}
 	}
 
@@ -78,7 +123,7 @@ func calculateUptime(endpointID string) float64 {
 
 func calculateSSLUptime(endpointID string) float64 {
 	var sslStatuses []models.SSLStatus
-	models.DB.Where("endpoint_id = ?", endpointID).Find(&sslStatuses)
+	models.DB.Scopes(models.KnownResults).Where("endpoint_id = ?", endpointID).Find(&sslStatuses)
 
 	if len(sslStatuses) == 0 {
 		return 0
@@ -100,7 +145,9 @@ func calculateStatus(ep models.Endpoint) string {
 		if err := models.DB.Where("endpoint_id = ?", ep.ID).Order("checked_at desc").First(&status).Error; err != nil {
 			return "No SSL checks yet"
 		}
-		if status.IsValid {
+		if status.Outcome == models.OutcomeUnknown {
+			return "Unknown"
+		} else if status.IsValid {
 			return "Valid"
 		} else {
 			return "Invalid"
@@ -125,7 +172,7 @@ func listEndpoints(c *fiber.Ctx) error {
 	for _, ep := range endpoints {
 		uptime := calculateUptime(ep.ID)
 		response = append(response, EndpointWithUptime{
-			Endpoint: ep,
+			Endpoint: ep.Redacted(),
 			Uptime:   uptime,
 		})
 	}
@@ -156,6 +203,51 @@ func createEndpoint(c *fiber.Ctx) error {
 		CheckChain           *bool    `json:"check_chain,omitempty"`            // optional, defaults to true
 		CheckDomainMatch     *bool    `json:"check_domain_match,omitempty"`     // optional, defaults to true
 		AcceptableTLSVersions []string `json:"acceptable_tls_versions,omitempty"` // optional, defaults to ["TLS 1.2", "TLS 1.3"]
+		ClientCertificateID  string   `json:"client_certificate_id,omitempty"`   // optional, for mutual TLS
+		ProxyURL             string   `json:"proxy_url,omitempty"`               // optional HTTP CONNECT or SOCKS5 proxy
+		AddressFamily        string   `json:"address_family,omitempty"`          // optional, auto, ipv4, ipv6 or both
+		ExpectFailure        bool     `json:"expect_failure,omitempty"`          // optional, pass only while unreachable
+		Retries              int      `json:"retries,omitempty"`                 // optional, re-run a failed check before recording it
+		RetryInterval        int      `json:"retry_interval,omitempty"`          // optional, seconds between retries, defaults to 10
+		ProbeLocations       []string `json:"probe_locations,omitempty"`         // optional, remote probes that also check it, * for all
+		Quorum               int      `json:"quorum,omitempty"`                  // optional, failing probes that open an incident, defaults to a majority
+		QuorumWindow         int      `json:"quorum_window,omitempty"`           // optional, seconds a probe's result counts, defaults to twice the interval
+		// DNS propagation fields
+		DNSRecordType        string   `json:"dns_record_type,omitempty"`        // optional, defaults to A
+		DNSResolvers         []string `json:"dns_resolvers,omitempty"`          // optional, defaults to public resolvers
+		DNSCheckAuthoritative bool    `json:"dns_check_authoritative,omitempty"` // optional, also query the authoritative nameservers
+		// DNSSEC fields for dns checks
+		DNSSEC               bool     `json:"dnssec,omitempty"`                  // optional, validate the chain of trust
+		DNSSECTrustAnchor    string   `json:"dnssec_trust_anchor,omitempty"`     // optional, defaults to the root KSKs
+		DNSSECMinDaysValid   *int     `json:"dnssec_min_days_valid,omitempty"`   // optional, defaults to 3
+		// Email authentication fields
+		DKIMSelectors        []string `json:"dkim_selectors,omitempty"`          // optional, DKIM selectors to audit
+		// Exec-specific fields, url is the command
+		ExecArgs             []string `json:"exec_args,omitempty"`               // optional command arguments
+		ExecEnv              []string `json:"exec_env,omitempty"`                // optional KEY=value environment entries
+		// Prometheus-specific fields
+		MetricAssertions     []string `json:"metric_assertions,omitempty"`       // optional, e.g. queue_depth{queue="emails"} < 1000
+		// SSH-specific fields, url is host or host:port
+		SSHHostKeyFingerprint string  `json:"ssh_host_key_fingerprint,omitempty"` // optional pinned host key, SHA256:...
+		SSHHostKeyAlgorithm  string   `json:"ssh_host_key_algorithm,omitempty"`  // optional, e.g. ssh-ed25519
+		SSHUsername          string   `json:"ssh_username,omitempty"`            // optional, authenticate as this user
+		SSHKeyID             string   `json:"ssh_key_id,omitempty"`              // optional stored key, required with ssh_username
+		// NTP-specific fields, url is host or host:port
+		NTPMaxOffset         *int     `json:"ntp_max_offset,omitempty"`          // optional, defaults to 100ms
+		// Heartbeat-specific fields
+		HeartbeatSchedule    string   `json:"heartbeat_schedule,omitempty"`     // optional cron expression
+		HeartbeatGrace       *int     `json:"heartbeat_grace,omitempty"`        // optional, defaults to 60s
+		HeartbeatMaxRuntime  *int     `json:"heartbeat_max_runtime,omitempty"`  // optional, 0 disables
+		// Transaction-specific fields
+		TransactionSteps     []models.TransactionStep `json:"transaction_steps,omitempty"` // required for transactions
+		// Content change detection fields
+		ContentMode          string   `json:"content_mode,omitempty"`          // optional, "change" or "stale"
+		ContentSelectorType  string   `json:"content_selector_type,omitempty"` // optional, "css", "regex" or "json"
+		ContentSelector      string   `json:"content_selector,omitempty"`
+		ContentStaleAfter    *int     `json:"content_stale_after,omitempty"`   // optional, defaults to 86400s in stale mode
+		// Security header audit fields
+		SecurityHeaders      bool     `json:"security_headers,omitempty"`      // optional, grade the response's security headers
+		MinSecurityGrade     string   `json:"min_security_grade,omitempty"`    // optional, fail below this grade
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
@@ -166,6 +258,14 @@ func createEndpoint(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "url and interval must be provided"})
 	}
 
+	if input.ClientCertificateID != "" && !clientCertificateExists(input.ClientCertificateID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "client certificate not found"})
+	}
+
+	if input.SSHKeyID != "" && !sshKeyExists(input.SSHKeyID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ssh key not found"})
+	}
+
 	// Set defaults for optional fields
 	timeout := 30
 	if input.Timeout != nil && *input.Timeout > 0 {
@@ -183,7 +283,7 @@ func createEndpoint(c *fiber.Ctx) error {
 		checkType = input.CheckType
 	}
 
-	minDaysValid := 7
+	minDaysValid := 30
 	if input.MinDaysValid != nil && *input.MinDaysValid >= 0 {
 		minDaysValid = *input.MinDaysValid
 	}
@@ -203,6 +303,31 @@ func createEndpoint(c *fiber.Ctx) error {
 		acceptableTLSVersions = models.StringArray(input.AcceptableTLSVersions)
 	}
 
+	heartbeatGrace := 60
+	if input.HeartbeatGrace != nil && *input.HeartbeatGrace > 0 {
+		heartbeatGrace = *input.HeartbeatGrace
+	}
+
+	contentStaleAfter := 0
+	if input.ContentStaleAfter != nil && *input.ContentStaleAfter > 0 {
+		contentStaleAfter = *input.ContentStaleAfter
+	}
+
+	dnssecMinDaysValid := 0
+	if input.DNSSECMinDaysValid != nil && *input.DNSSECMinDaysValid > 0 {
+		dnssecMinDaysValid = *input.DNSSECMinDaysValid
+	}
+
+	ntpMaxOffset := 0
+	if input.NTPMaxOffset != nil && *input.NTPMaxOffset > 0 {
+		ntpMaxOffset = *input.NTPMaxOffset
+	}
+
+	heartbeatMaxRuntime := 0
+	if input.HeartbeatMaxRuntime != nil && *input.HeartbeatMaxRuntime > 0 {
+		heartbeatMaxRuntime = *input.HeartbeatMaxRuntime
+	}
+
 	ep := models.Endpoint{
 		ID:                   uuid.New().String(),
 		URL:                  input.URL,
@@ -215,55 +340,53 @@ func createEndpoint(c *fiber.Ctx) error {
 		CheckChain:           checkChain,
 		CheckDomainMatch:     checkDomainMatch,
 		AcceptableTLSVersions: acceptableTLSVersions,
+		ClientCertificateID:  input.ClientCertificateID,
+		ProxyURL:             input.ProxyURL,
+		AddressFamily:        input.AddressFamily,
+		ExpectFailure:        input.ExpectFailure,
+		Retries:              input.Retries,
+		RetryInterval:        input.RetryInterval,
+		ProbeLocations:       models.StringArray(input.ProbeLocations),
+		Quorum:               input.Quorum,
+		QuorumWindow:         input.QuorumWindow,
+		DNSRecordType:        input.DNSRecordType,
+		DNSResolvers:         models.StringArray(input.DNSResolvers),
+		DNSCheckAuthoritative: input.DNSCheckAuthoritative,
+		DNSSEC:               input.DNSSEC,
+		DNSSECTrustAnchor:    strings.TrimSpace(input.DNSSECTrustAnchor),
+		DNSSECMinDaysValid:   dnssecMinDaysValid,
+		DKIMSelectors:        models.StringArray(input.DKIMSelectors),
+		ExecArgs:             models.StringArray(input.ExecArgs),
+		ExecEnv:              models.StringArray(input.ExecEnv),
+		MetricAssertions:     models.StringArray(input.MetricAssertions),
+		SSHHostKeyFingerprint: input.SSHHostKeyFingerprint,
+		SSHHostKeyAlgorithm:  strings.TrimSpace(input.SSHHostKeyAlgorithm),
+		SSHUsername:          strings.TrimSpace(input.SSHUsername),
+		SSHKeyID:             input.SSHKeyID,
+		NTPMaxOffset:         ntpMaxOffset,
+		HeartbeatSchedule:    strings.TrimSpace(input.HeartbeatSchedule),
+		HeartbeatGrace:       heartbeatGrace,
+		HeartbeatMaxRuntime:  heartbeatMaxRuntime,
+		TransactionSteps:     models.TransactionSteps(input.TransactionSteps),
+		ContentMode:          input.ContentMode,
+		ContentSelectorType:  input.ContentSelectorType,
+		ContentSelector:      input.ContentSelector,
+		ContentStaleAfter:    contentStaleAfter,
+		SecurityHeaders:      input.SecurityHeaders,
+		MinSecurityGrade:     strings.TrimSpace(input.MinSecurityGrade),
 		CreatedAt:            time.Now(),
 	}
 	if err := models.DB.Create(&ep).Error; err != nil {
-		if errors.Is(err, models.ErrInvalidEndpoint) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid endpoint configuration"})
+		if message, ok := validationMessage(err); ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": message})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create endpoint"})
 	}
 
-	// Start monitoring the new endpoint immediately
-	workerEp := worker.Endpoint{
-		ID:                   ep.ID,
-		URL:                  ep.URL,
-		CheckType:            ep.CheckType,
-		Interval:             time.Duration(ep.Interval) * time.Second,
-		Timeout:              time.Duration(ep.Timeout) * time.Second,
-		ExpectedStatusCodes:  []int(ep.ExpectedStatusCodes),
-		MaxResponseTime:      time.Duration(ep.MaxResponseTime) * time.Millisecond,
-		MinDaysValid:         ep.MinDaysValid,
-		CheckChain:           ep.CheckChain,
-		CheckDomainMatch:     ep.CheckDomainMatch,
-		AcceptableTLSVersions: ep.AcceptableTLSVersions,
-		DNSRecordType:        ep.DNSRecordType,
-		ExpectedDNSAnswers:   []int(ep.ExpectedDNSAnswers),
-		TCPPort:              ep.TCPPort,
-	}
-	worker.StartMonitoring(workerEp)
-
-	// Perform immediate check for the new endpoint
-	go func() {
-		// Create a dummy worker to use its methods for immediate check
-		w := worker.NewWorker(1 * time.Minute)
-		switch workerEp.CheckType {
-		case "ssl":
-			w.CheckSSLEndpoint(workerEp)
-		case "dns":
-			w.CheckDNSEndpoint(workerEp)
-		case "domain":
-			w.CheckDomainEndpoint(workerEp)
-		case "ping":
-			w.CheckPingEndpoint(workerEp)
-		case "tcp":
-			w.CheckTCPEndpoint(workerEp)
-		default:
-			w.CheckHTTPEndpoint(workerEp)
-		}
-	}()
+	// Start monitoring the new endpoint, it has never been checked so the first check runs right away
+	worker.StartMonitoring(worker.EndpointFromModel(ep))
 
-	return c.Status(fiber.StatusCreated).JSON(ep)
+	return c.Status(fiber.StatusCreated).JSON(EndpointWithToken{Endpoint: ep.Redacted(), HeartbeatToken: ep.HeartbeatToken})
 }
 
 func updateEndpoint(c *fiber.Ctx) error {
@@ -283,6 +406,40 @@ func updateEndpoint(c *fiber.Ctx) error {
 		CheckChain           *bool    `json:"check_chain,omitempty"`
 		CheckDomainMatch     *bool    `json:"check_domain_match,omitempty"`
 		AcceptableTLSVersions []string `json:"acceptable_tls_versions,omitempty"`
+		ClientCertificateID  *string  `json:"client_certificate_id,omitempty"` // empty string removes it
+		ProxyURL             *string  `json:"proxy_url,omitempty"`             // empty string removes it
+		AddressFamily        *string  `json:"address_family,omitempty"`        // empty string resets it to auto
+		ExpectFailure        *bool    `json:"expect_failure,omitempty"`
+		Retries              *int     `json:"retries,omitempty"`
+		RetryInterval        *int     `json:"retry_interval,omitempty"`
+		ProbeLocations       []string `json:"probe_locations,omitempty"` // empty list leaves the endpoint to the central worker
+		Quorum               *int     `json:"quorum,omitempty"` // 0 is a majority
+		QuorumWindow         *int     `json:"quorum_window,omitempty"` // 0 is twice the interval
+		DNSRecordType        string   `json:"dns_record_type,omitempty"`
+		DNSResolvers         []string `json:"dns_resolvers,omitempty"`
+		DNSCheckAuthoritative *bool   `json:"dns_check_authoritative,omitempty"`
+		DNSSEC               *bool    `json:"dnssec,omitempty"`
+		DNSSECTrustAnchor    *string  `json:"dnssec_trust_anchor,omitempty"` // empty string restores the root KSKs
+		DNSSECMinDaysValid   *int     `json:"dnssec_min_days_valid,omitempty"`
+		DKIMSelectors        []string `json:"dkim_selectors,omitempty"`
+		ExecArgs             []string `json:"exec_args,omitempty"`
+		ExecEnv              []string `json:"exec_env,omitempty"`
+		MetricAssertions     []string `json:"metric_assertions,omitempty"`
+		SSHHostKeyFingerprint *string `json:"ssh_host_key_fingerprint,omitempty"` // empty string removes the pin
+		SSHHostKeyAlgorithm  *string  `json:"ssh_host_key_algorithm,omitempty"`  // empty string negotiates any
+		SSHUsername          *string  `json:"ssh_username,omitempty"`            // empty string, with ssh_key_id, stops authenticating
+		SSHKeyID             *string  `json:"ssh_key_id,omitempty"`
+		NTPMaxOffset         *int     `json:"ntp_max_offset,omitempty"`
+		HeartbeatSchedule    *string  `json:"heartbeat_schedule,omitempty"`
+		HeartbeatGrace       *int     `json:"heartbeat_grace,omitempty"`
+		HeartbeatMaxRuntime  *int     `json:"heartbeat_max_runtime,omitempty"`
+		TransactionSteps     []models.TransactionStep `json:"transaction_steps,omitempty"`
+		ContentMode          *string  `json:"content_mode,omitempty"`
+		ContentSelectorType  *string  `json:"content_selector_type,omitempty"`
+		ContentSelector      *string  `json:"content_selector,omitempty"`
+		ContentStaleAfter    *int     `json:"content_stale_after,omitempty"`
+		SecurityHeaders      *bool    `json:"security_headers,omitempty"`
+		MinSecurityGrade     *string  `json:"min_security_grade,omitempty"` // empty string stops failing on the grade
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
@@ -293,6 +450,8 @@ func updateEndpoint(c *fiber.Ctx) error {
 	if err := models.DB.First(&ep, "id = ?", id).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "endpoint not found"})
 	}
+	// Turning the endpoint into a heartbeat generates its token
+	hadToken := ep.HeartbeatToken != ""
 
 	// Update fields if provided
 	if input.URL != "" {
@@ -325,31 +484,130 @@ func updateEndpoint(c *fiber.Ctx) error {
 	if len(input.AcceptableTLSVersions) > 0 {
 		ep.AcceptableTLSVersions = models.StringArray(input.AcceptableTLSVersions)
 	}
+	if input.ClientCertificateID != nil {
+		if *input.ClientCertificateID != "" && !clientCertificateExists(*input.ClientCertificateID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "client certificate not found"})
+		}
+		ep.ClientCertificateID = *input.ClientCertificateID
+	}
+	if input.ProxyURL != nil {
+		ep.ProxyURL = models.UnredactProxyURL(strings.TrimSpace(*input.ProxyURL), ep.ProxyURL)
+	}
+	if input.AddressFamily != nil {
+		ep.AddressFamily = strings.TrimSpace(*input.AddressFamily)
+	}
+	if input.ExpectFailure != nil {
+		ep.ExpectFailure = *input.ExpectFailure
+	}
+	if input.Retries != nil {
+		ep.Retries = *input.Retries
+	}
+	if input.RetryInterval != nil {
+		ep.RetryInterval = *input.RetryInterval
+	}
+	if input.DNSRecordType != "" {
+		ep.DNSRecordType = input.DNSRecordType
+	}
+	if len(input.DNSResolvers) > 0 {
+		ep.DNSResolvers = models.StringArray(input.DNSResolvers)
+	}
+	if input.DNSCheckAuthoritative != nil {
+		ep.DNSCheckAuthoritative = *input.DNSCheckAuthoritative
+	}
+	if input.DNSSEC != nil {
+		ep.DNSSEC = *input.DNSSEC
+	}
+	if input.DNSSECTrustAnchor != nil {
+		ep.DNSSECTrustAnchor = strings.TrimSpace(*input.DNSSECTrustAnchor)
+	}
+	if input.DNSSECMinDaysValid != nil && *input.DNSSECMinDaysValid > 0 {
+		ep.DNSSECMinDaysValid = *input.DNSSECMinDaysValid
+	}
+	if len(input.DKIMSelectors) > 0 {
+		ep.DKIMSelectors = models.StringArray(input.DKIMSelectors)
+	}
+	if input.ProbeLocations != nil {
+		ep.ProbeLocations = models.StringArray(input.ProbeLocations)
+	}
+	if input.Quorum != nil {
+		ep.Quorum = *input.Quorum
+	}
+	if input.QuorumWindow != nil {
+		ep.QuorumWindow = *input.QuorumWindow
+	}
+	if input.ExecArgs != nil {
+		ep.ExecArgs = models.StringArray(input.ExecArgs)
+	}
+	if input.ExecEnv != nil {
+		ep.ExecEnv = models.StringArray(input.ExecEnv)
+	}
+	if input.MetricAssertions != nil {
+		ep.MetricAssertions = models.StringArray(input.MetricAssertions)
+	}
+	if input.SSHHostKeyFingerprint != nil {
+		ep.SSHHostKeyFingerprint = *input.SSHHostKeyFingerprint
+	}
+	if input.SSHHostKeyAlgorithm != nil {
+		ep.SSHHostKeyAlgorithm = strings.TrimSpace(*input.SSHHostKeyAlgorithm)
+	}
+	if input.SSHUsername != nil {
+		ep.SSHUsername = strings.TrimSpace(*input.SSHUsername)
+	}
+	if input.SSHKeyID != nil {
+		if *input.SSHKeyID != "" && !sshKeyExists(*input.SSHKeyID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ssh key not found"})
+		}
+		ep.SSHKeyID = *input.SSHKeyID
+	}
+	if input.NTPMaxOffset != nil && *input.NTPMaxOffset > 0 {
+		ep.NTPMaxOffset = *input.NTPMaxOffset
+	}
+	if input.HeartbeatSchedule != nil {
+		ep.HeartbeatSchedule = strings.TrimSpace(*input.HeartbeatSchedule)
+	}
+	if input.HeartbeatGrace != nil && *input.HeartbeatGrace > 0 {
+		ep.HeartbeatGrace = *input.HeartbeatGrace
+	}
+	if input.HeartbeatMaxRuntime != nil && *input.HeartbeatMaxRuntime >= 0 {
+		ep.HeartbeatMaxRuntime = *input.HeartbeatMaxRuntime
+	}
+	if len(input.TransactionSteps) > 0 {
+		ep.TransactionSteps = models.TransactionSteps(input.TransactionSteps)
+	}
+	if input.ContentMode != nil {
+		ep.ContentMode = *input.ContentMode
+	}
+	if input.ContentSelectorType != nil {
+		ep.ContentSelectorType = *input.ContentSelectorType
+	}
+	if input.ContentSelector != nil {
+		ep.ContentSelector = *input.ContentSelector
+	}
+	if input.ContentStaleAfter != nil && *input.ContentStaleAfter > 0 {
+		ep.ContentStaleAfter = *input.ContentStaleAfter
+	}
+	if input.SecurityHeaders != nil {
+		ep.SecurityHeaders = *input.SecurityHeaders
+	}
+	if input.MinSecurityGrade != nil {
+		ep.MinSecurityGrade = strings.TrimSpace(*input.MinSecurityGrade)
+	}
 
 	if err := models.DB.Save(&ep).Error; err != nil {
+		if message, ok := validationMessage(err); ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": message})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not update endpoint"})
 	}
 
 	// Update monitoring for the endpoint
-	workerEp := worker.Endpoint{
-		ID:                   ep.ID,
-		URL:                  ep.URL,
-		CheckType:            ep.CheckType,
-		Interval:             time.Duration(ep.Interval) * time.Second,
-		Timeout:              time.Duration(ep.Timeout) * time.Second,
-		ExpectedStatusCodes:  []int(ep.ExpectedStatusCodes),
-		MaxResponseTime:      time.Duration(ep.MaxResponseTime) * time.Millisecond,
-		MinDaysValid:         ep.MinDaysValid,
-		CheckChain:           ep.CheckChain,
-		CheckDomainMatch:     ep.CheckDomainMatch,
-		AcceptableTLSVersions: ep.AcceptableTLSVersions,
-		DNSRecordType:        ep.DNSRecordType,
-		ExpectedDNSAnswers:   []int(ep.ExpectedDNSAnswers),
-		TCPPort:              ep.TCPPort,
-	}
+	workerEp := worker.EndpointFromModel(ep)
 	worker.UpdateMonitoring(workerEp)
 
-	return c.JSON(ep)
+	if hadToken {
+		return c.JSON(ep.Redacted())
+	}
+	return c.JSON(EndpointWithToken{Endpoint: ep.Redacted(), HeartbeatToken: ep.HeartbeatToken})
 }
 
 func deleteEndpoint(c *fiber.Ctx) error {
@@ -369,10 +627,21 @@ func deleteEndpoint(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete endpoint"})
 	}
 
-	// Also delete associated statuses, SSL statuses, and domain statuses
+	// Also delete associated statuses and everything else recorded for the endpoint
 	models.DB.Where("endpoint_id = ?", id).Delete(&models.Status{})
 	models.DB.Where("endpoint_id = ?", id).Delete(&models.SSLStatus{})
 	models.DB.Where("endpoint_id = ?", id).Delete(&models.DomainStatus{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.HeartbeatPing{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.TransactionStepResult{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.ContentSnapshot{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.ContentChange{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.DNSResolverResult{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.DNSSECSignature{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.EmailAuthFinding{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.ExecMetric{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.SecurityHeaderFinding{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.NTPResult{})
+	models.DB.Where("endpoint_id = ?", id).Delete(&models.Incident{})
 
 	// Stop monitoring the endpoint
 	worker.StopMonitoring(id)
@@ -393,10 +662,125 @@ func listEndpointStatuses(c *fiber.Ctx) error {
 	}
 
 	var statuses []models.Status
-	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Find(&statuses)
+	query := models.DB.Where("endpoint_id = ?", id)
+	// The central worker's statuses have no location, probes' carry theirs
+	if location, ok := c.Queries()["location"]; ok {
+		query = query.Where("location = ?", location)
+	}
+	query.Order("checked_at desc").Find(&statuses)
 	return c.JSON(statuses)
 }
 
+// listIncidents lists the incidents, with ?open=true only those still open
+func listIncidents(c *fiber.Ctx) error {
+	var incidents []models.Incident
+	query := models.DB.Order("started_at desc")
+	if c.QueryBool("open") {
+		query = query.Where("resolved_at IS NULL")
+	}
+	query.Find(&incidents)
+	return c.JSON(incidents)
+}
+
+func listEndpointIncidents(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var incidents []models.Incident
+	models.DB.Where("endpoint_id = ?", id).Order("started_at desc").Find(&incidents)
+	return c.JSON(incidents)
+}
+
+func listEndpointStepResults(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var results []models.TransactionStepResult
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("step_index").Find(&results)
+	return c.JSON(results)
+}
+
+func listEndpointResolverResults(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var results []models.DNSResolverResult
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("authoritative desc").Order("resolver").Find(&results)
+	return c.JSON(results)
+}
+
+func listEndpointDNSSECSignatures(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var signatures []models.DNSSECSignature
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("expiration").Find(&signatures)
+	return c.JSON(signatures)
+}
+
+func listEndpointEmailAuthFindings(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var findings []models.EmailAuthFinding
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("record").Order("name").Find(&findings)
+	return c.JSON(findings)
+}
+
+func listEndpointExecMetrics(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var metrics []models.ExecMetric
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("label").Find(&metrics)
+	return c.JSON(metrics)
+}
+
+func listEndpointSecurityHeaderFindings(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var findings []models.SecurityHeaderFinding
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Order("penalty desc").Find(&findings)
+	return c.JSON(findings)
+}
+
+func listEndpointNTPResults(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var results []models.NTPResult
+	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Find(&results)
+	return c.JSON(results)
+}
+
+func listEndpointContentChanges(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var changes []models.ContentChange
+	models.DB.Where("endpoint_id = ?", id).Order("detected_at desc").Find(&changes)
+	return c.JSON(changes)
+}
+
 func listSSLStatuses(c *fiber.Ctx) error {
 	var sslStatuses []models.SSLStatus
 	models.DB.Order("checked_at desc").Find(&sslStatuses)
@@ -410,7 +794,11 @@ func listEndpointSSLStatuses(c *fiber.Ctx) error {
 	}
 
 	var sslStatuses []models.SSLStatus
-	models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Find(&sslStatuses)
+	query := models.DB.Where("endpoint_id = ?", id)
+	if location, ok := c.Queries()["location"]; ok {
+		query = query.Where("location = ?", location)
+	}
+	query.Order("checked_at desc").Find(&sslStatuses)
 	return c.JSON(sslStatuses)
 }
 
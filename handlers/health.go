@@ -1,11 +1,40 @@
 package handlers
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/worker"
+)
 
 func RegisterHealth(app fiber.Router) {
 	app.Get("/health", healthHandler)
+	app.Get("/health/executor", executorStatsHandler)
+	app.Get("/health/cluster", clusterHandler)
+	app.Get("/health/network", networkHandler)
 }
 
 func healthHandler(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"status": "ok"})
 }
+
+// executorStatsHandler reports the check executor's queue depth, running checks and skipped runs
+func executorStatsHandler(c *fiber.Ctx) error {
+	return c.JSON(worker.Stats())
+}
+
+// clusterHandler reports the members of the cluster and how many endpoints this node checks
+func clusterHandler(c *fiber.Ctx) error {
+	stats, ok := worker.Cluster()
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "cluster mode is off"})
+	}
+	return c.JSON(stats)
+}
+
+// networkHandler reports whether the server's own network works, as its canaries last saw it
+func networkHandler(c *fiber.Ctx) error {
+	stats, ok := worker.Canary()
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no canary targets configured"})
+	}
+	return c.JSON(stats)
+}
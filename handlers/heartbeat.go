@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// maxPingBodySize caps how much of a ping's payload is stored
+const maxPingBodySize = 10 * 1024
+
+func RegisterHeartbeats(app fiber.Router) {
+	routes := map[string]string{
+		"/ping/:token":       models.PingKindSuccess,
+		"/ping/:token/start": models.PingKindStart,
+		"/ping/:token/fail":  models.PingKindFail,
+	}
+	for path, kind := range routes {
+		app.Get(path, receivePing(kind))
+		app.Post(path, receivePing(kind))
+	}
+	app.Get("/endpoints/:id/pings", listEndpointPings)
+}
+
+func receivePing(kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Params("token")
+		if token == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token required"})
+		}
+
+		var ep models.Endpoint
+		if err := models.DB.First(&ep, "heartbeat_token = ? AND check_type = ?", token, "heartbeat").Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "heartbeat not found"})
+		}
+
+		body := c.Body()
+		if len(body) > maxPingBodySize {
+			// Keep the tail, that's where the interesting log lines usually are
+			body = body[len(body)-maxPingBodySize:]
+		}
+
+		ping := models.HeartbeatPing{
+			ID:         uuid.New().String(),
+			EndpointID: ep.ID,
+			Kind:       kind,
+			Body:       string(body),
+			RemoteAddr: c.IP(),
+			ReceivedAt: time.Now(),
+		}
+		if err := models.DB.Create(&ping).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not record ping"})
+		}
+
+		return c.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+func listEndpointPings(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "endpoint id required"})
+	}
+
+	var pings []models.HeartbeatPing
+	models.DB.Where("endpoint_id = ?", id).Order("received_at desc").Find(&pings)
+	return c.JSON(pings)
+}
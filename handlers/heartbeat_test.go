@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func newHeartbeatTestApp(t *testing.T) (*fiber.App, models.Endpoint) {
+	t.Helper()
+	setupTestDB(t)
+
+	app := fiber.New()
+	RegisterHeartbeats(app)
+
+	ep := models.Endpoint{
+		ID: uuid.New().String(), URL: "nightly-backup", CheckType: "heartbeat", Interval: 3600, CreatedAt: time.Now(),
+	}
+	if err := models.DB.Create(&ep).Error; err != nil {
+		t.Fatalf("failed to seed heartbeat endpoint: %v", err)
+	}
+	if ep.HeartbeatToken == "" {
+		t.Fatalf("expected heartbeat token to be generated")
+	}
+	return app, ep
+}
+
+func TestReceivePing(t *testing.T) {
+	app, ep := newHeartbeatTestApp(t)
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+		kind   string
+	}{
+		{http.MethodGet, "/ping/" + ep.HeartbeatToken + "/start", "", models.PingKindStart},
+		{http.MethodPost, "/ping/" + ep.HeartbeatToken, "backup finished: 42 files", models.PingKindSuccess},
+		{http.MethodPost, "/ping/" + ep.HeartbeatToken + "/fail", "disk full", models.PingKindFail},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: expected status %d, got %d", r.method, r.path, http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/endpoints/"+ep.ID+"/pings", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+
+	var pings []models.HeartbeatPing
+	if err := json.NewDecoder(resp.Body).Decode(&pings); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(pings) != len(requests) {
+		t.Fatalf("expected %d pings, got %d", len(requests), len(pings))
+	}
+
+	kinds := map[string]string{}
+	for _, p := range pings {
+		kinds[p.Kind] = p.Body
+	}
+	for _, r := range requests {
+		body, ok := kinds[r.kind]
+		if !ok {
+			t.Fatalf("expected a %s ping to be stored", r.kind)
+		}
+		if body != r.body {
+			t.Fatalf("expected %s ping body %q, got %q", r.kind, r.body, body)
+		}
+	}
+}
+
+func TestReceivePingUnknownToken(t *testing.T) {
+	app, _ := newHeartbeatTestApp(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/ping/"+uuid.New().String(), nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestCreateHeartbeatEndpointInvalidSchedule(t *testing.T) {
+	app := newTestApp(t)
+
+	payload := `{"url":"nightly-backup","check_type":"heartbeat","interval":3600,"heartbeat_schedule":"not a cron"}`
+	req := httptest.NewRequest(http.MethodPost, "/endpoints", strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
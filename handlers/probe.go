@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxProbeBatch caps the results a probe reports in one request
+const maxProbeBatch = 1000
+
+func RegisterProbes(app fiber.Router) {
+	app.Get("/probes", listProbes)
+	app.Post("/probes", createProbe)
+	app.Delete("/probes/:id", deleteProbe)
+	app.Get("/endpoints/:id/locations", listEndpointLocations)
+
+	agent := app.Group("/agent", authenticateProbe)
+	agent.Get("/endpoints", listProbeEndpoints)
+	agent.Post("/results", receiveProbeResults)
+}
+
+func listProbes(c *fiber.Ctx) error {
+	var probes []models.Probe
+	models.DB.Order("location").Order("name").Find(&probes)
+	return c.JSON(probes)
+}
+
+// ProbeWithToken is a newly registered probe with the token it authenticates with, which is only
+// returned once
+type ProbeWithToken struct {
+	models.Probe
+	Token string `json:"token"`
+}
+
+func createProbe(c *fiber.Ctx) error {
+	var input struct {
+		Name     string `json:"name"`
+		Location string `json:"location"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	probe, token, err := models.NewProbe(input.Name, input.Location)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid probe"})
+	}
+	if err := models.DB.Create(&probe).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store probe"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(ProbeWithToken{Probe: probe, Token: token})
+}
+
+func deleteProbe(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "probe id required"})
+	}
+
+	result := models.DB.Delete(&models.Probe{}, "id = ?", id)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete probe"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "probe not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "probe deleted successfully"})
+}
+
+// authenticateProbe identifies the probe by the bearer token of the request
+func authenticateProbe(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "probe token required"})
+	}
+
+	var probe models.Probe
+	if err := models.DB.First(&probe, "token_hash = ?", models.HashProbeToken(token)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid probe token"})
+	}
+	now := time.Now()
+	models.DB.Model(&probe).UpdateColumn("last_seen_at", now)
+	probe.LastSeenAt = &now
+
+	c.Locals("probe", probe)
+	return c.Next()
+}
+
+// probeEndpoints returns the endpoints assigned to probe
+func probeEndpoints(probe models.Probe) ([]models.Endpoint, error) {
+	var endpoints []models.Endpoint
+	if err := models.DB.Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	assigned := make([]models.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if probe.Assigned(ep) {
+			assigned = append(assigned, ep)
+		}
+	}
+	return assigned, nil
+}
+
+// listProbeEndpoints returns the endpoints the requesting probe checks
+func listProbeEndpoints(c *fiber.Ctx) error {
+	endpoints, err := probeEndpoints(c.Locals("probe").(models.Probe))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not load endpoints"})
+	}
+	return c.JSON(endpoints)
+}
+
+// receiveProbeResults stores a batch of results from the requesting probe. Rows keep the IDs the
+// probe gave them, so a batch sent again after a lost response isn't stored twice. Results for
+// endpoints no longer assigned to the probe are dropped
+func receiveProbeResults(c *fiber.Ctx) error {
+	probe := c.Locals("probe").(models.Probe)
+	var report models.ProbeReport
+	if err := c.BodyParser(&report); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
+	}
+	if len(report.Results) > maxProbeBatch {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "too many results in one batch"})
+	}
+
+	endpoints, err := probeEndpoints(probe)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not load endpoints"})
+	}
+	assigned := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		assigned[ep.ID] = true
+	}
+
+	var rows []any
+	dropped := 0
+	reported := make(map[string]bool)
+	for _, result := range report.Results {
+		if !assigned[result.EndpointID] {
+			dropped++
+			continue
+		}
+		if result.Status != nil {
+			reported[result.EndpointID] = true
+		}
+		resultRows, err := result.Rows(probe)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid result: " + err.Error()})
+		}
+		rows = append(rows, resultRows...)
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store results"})
+	}
+	// Buffered batches arrive late, only a newer verdict replaces the one stored
+	if report.Health != nil && !report.Health.CheckedAt.IsZero() {
+		models.DB.Model(&models.Probe{}).
+			Where("id = ? AND (network_checked_at IS NULL OR network_checked_at < ?)", probe.ID, report.Health.CheckedAt).
+			Updates(map[string]any{"network_healthy": report.Health.Healthy, "network_checked_at": report.Health.CheckedAt})
+	}
+	// The probe's results may complete or break a quorum
+	now := time.Now()
+	for endpointID := range reported {
+		if err := models.UpdateIncident(models.DB, endpointID, now); err != nil {
+			log.Printf("failed to update incidents of endpoint %s: %v", endpointID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{"stored": len(report.Results) - dropped, "dropped": dropped})
+}
+
+// LocationSummary is an endpoint's recent results from one location, the central worker's has
+// an empty location
+type LocationSummary struct {
+	Location  string            `json:"location"`
+	Uptime    float64           `json:"uptime"`
+	Checks    int               `json:"checks"`  // results counted towards the uptime
+	Unknown   int               `json:"unknown"` // results taken while the probe's network was down
+	Latest    *models.Status    `json:"latest,omitempty"`
+	LatestSSL *models.SSLStatus `json:"latest_ssl,omitempty"`
+}
+
+// listEndpointLocations summarizes an endpoint's results per location
+func listEndpointLocations(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var ep models.Endpoint
+	if err := models.DB.First(&ep, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "endpoint not found"})
+	}
+
+	summaries := []LocationSummary{}
+	if ep.CheckType == "ssl" {
+		var statuses []models.SSLStatus
+		models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Find(&statuses)
+		byLocation := make(map[string]int)
+		for i, status := range statuses {
+			n, ok := byLocation[status.Location]
+			if !ok {
+				n = len(summaries)
+				byLocation[status.Location] = n
+				summaries = append(summaries, LocationSummary{Location: status.Location, LatestSSL: &statuses[i]})
+			}
+			if status.Outcome == models.OutcomeUnknown {
+				summaries[n].Unknown++
+				continue
+			}
+			summaries[n].Checks++
+			if status.IsValid {
+				summaries[n].Uptime++
+			}
+		}
+	} else {
+		config, ok := models.LookupCheckConfig(ep.CheckType)
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "unknown check type"})
+		}
+		var statuses []models.Status
+		models.DB.Where("endpoint_id = ?", id).Order("checked_at desc").Find(&statuses)
+		byLocation := make(map[string]int)
+		for i, status := range statuses {
+			n, ok := byLocation[status.Location]
+			if !ok {
+				n = len(summaries)
+				byLocation[status.Location] = n
+				summaries = append(summaries, LocationSummary{Location: status.Location, Latest: &statuses[i]})
+			}
+			if status.Outcome == models.OutcomeUnknown {
+				summaries[n].Unknown++
+				continue
+			}
+			summaries[n].Checks++
+			if config.Passed(&ep, &statuses[i]) {
+				summaries[n].Uptime++
+			}
+		}
+	}
+	for i := range summaries {
+		if summaries[i].Checks > 0 {
+			summaries[i].Uptime = summaries[i].Uptime / float64(summaries[i].Checks) * 100
+		}
+	}
+
+	return c.JSON(summaries)
+}
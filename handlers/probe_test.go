@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func newProbeTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+
+	app := fiber.New()
+	RegisterEndpoints(app)
+	RegisterProbes(app)
+	return app
+}
+
+// newTestProbe stores a probe at a location no other test uses and returns it with its token
+func newTestProbe(t *testing.T) (models.Probe, string) {
+	t.Helper()
+	probe, token, err := models.NewProbe("test probe", "loc-"+uuid.New().String()[:8])
+	if err != nil {
+		t.Fatalf("failed to create probe: %v", err)
+	}
+	if err := models.DB.Create(&probe).Error; err != nil {
+		t.Fatalf("failed to store probe: %v", err)
+	}
+	return probe, token
+}
+
+func agentRequest(method, path, token, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestCreateProbe(t *testing.T) {
+	app := newProbeTestApp(t)
+
+	resp, err := app.Test(agentRequest(http.MethodPost, "/probes", "", `{"name":"Frankfurt 1","location":"eu-central"}`), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	var body ProbeWithToken
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.Token == "" || body.Location != "eu-central" {
+		t.Fatalf("expected probe with token, got %+v", body)
+	}
+
+	var stored models.Probe
+	if err := models.DB.First(&stored, "id = ?", body.ID).Error; err != nil {
+		t.Fatalf("expected probe persisted: %v", err)
+	}
+	if stored.TokenHash != models.HashProbeToken(body.Token) {
+		t.Errorf("expected the token's hash to be stored")
+	}
+
+	resp, err = app.Test(agentRequest(http.MethodPost, "/probes", "", `{"name":"bad","location":"eu central"}`), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid location, got %d", resp.StatusCode)
+	}
+}
+
+func TestAgentRequiresProbeToken(t *testing.T) {
+	app := newProbeTestApp(t)
+
+	for _, token := range []string{"", "not-a-token"} {
+		resp, err := app.Test(agentRequest(http.MethodGet, "/agent/endpoints", token, ""), -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status 401 for token %q, got %d", token, resp.StatusCode)
+		}
+	}
+}
+
+func TestAgentEndpoints(t *testing.T) {
+	app := newProbeTestApp(t)
+	probe, token := newTestProbe(t)
+
+	eps := []models.Endpoint{
+		{ID: uuid.New().String(), URL: "http://assigned", Interval: 60, ProbeLocations: models.StringArray{probe.Location}},
+		{ID: uuid.New().String(), URL: "http://everywhere", Interval: 60, ProbeLocations: models.StringArray{models.AllProbes}},
+		{ID: uuid.New().String(), URL: "http://central", Interval: 60},
+		{ID: uuid.New().String(), URL: "http://elsewhere", Interval: 60, ProbeLocations: models.StringArray{"elsewhere"}},
+	}
+	if err := models.DB.Create(&eps).Error; err != nil {
+		t.Fatalf("failed to seed endpoints: %v", err)
+	}
+
+	resp, err := app.Test(agentRequest(http.MethodGet, "/agent/endpoints", token, ""), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var body []models.Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, ep := range body {
+		got[ep.ID] = true
+	}
+	if !got[eps[0].ID] || !got[eps[1].ID] || got[eps[2].ID] || got[eps[3].ID] {
+		t.Errorf("expected only the probe's endpoints, got %v", body)
+	}
+
+	var stored models.Probe
+	models.DB.First(&stored, "id = ?", probe.ID)
+	if stored.LastSeenAt == nil {
+		t.Errorf("expected the probe's last request to be recorded")
+	}
+}
+
+func TestAgentResults(t *testing.T) {
+	app := newProbeTestApp(t)
+	probe, token := newTestProbe(t)
+
+	assigned := models.Endpoint{ID: uuid.New().String(), URL: "http://assigned", CheckType: "http", Interval: 60, ProbeLocations: models.StringArray{probe.Location}}
+	other := models.Endpoint{ID: uuid.New().String(), URL: "http://other", CheckType: "http", Interval: 60}
+	if err := models.DB.Create(&[]models.Endpoint{assigned, other}).Error; err != nil {
+		t.Fatalf("failed to seed endpoints: %v", err)
+	}
+	central := models.Status{ID: uuid.New().String(), EndpointID: assigned.ID, Code: 200, CheckedAt: time.Now()}
+	if err := models.DB.Create(&central).Error; err != nil {
+		t.Fatalf("failed to seed status: %v", err)
+	}
+
+	statusID := uuid.New().String()
+	detail, err := models.NewProbeDetail(&models.ExecMetric{ID: uuid.New().String(), Label: "time", Value: 0.1})
+	if err != nil {
+		t.Fatalf("failed to tag detail: %v", err)
+	}
+	report := models.ProbeReport{Results: []models.ProbeResult{
+		{
+			EndpointID: assigned.ID,
+			// The probe can't attribute its result to another probe
+			Status:  &models.Status{ID: statusID, Code: 503, ErrorMessage: "unavailable", ProbeID: "someone-else", CheckedAt: time.Now()},
+			Details: []models.ProbeDetail{detail},
+		},
+		{EndpointID: other.ID, Status: &models.Status{ID: uuid.New().String(), Code: 200, CheckedAt: time.Now()}},
+	}}
+	payload, _ := json.Marshal(report)
+
+	// Sending the batch again, as after a lost response, stores nothing twice
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(agentRequest(http.MethodPost, "/agent/results", token, string(payload)), -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", resp.StatusCode)
+		}
+		var body map[string]int
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body["stored"] != 1 || body["dropped"] != 1 {
+			t.Fatalf("expected 1 result stored and 1 dropped, got %v", body)
+		}
+	}
+
+	var stored models.Status
+	if err := models.DB.First(&stored, "id = ?", statusID).Error; err != nil {
+		t.Fatalf("expected probe status persisted: %v", err)
+	}
+	if stored.ProbeID != probe.ID || stored.Location != probe.Location || stored.EndpointID != assigned.ID {
+		t.Errorf("expected status tied to the probe and endpoint, got %+v", stored)
+	}
+	var metrics []models.ExecMetric
+	models.DB.Where("status_id = ?", statusID).Find(&metrics)
+	if len(metrics) != 1 || metrics[0].EndpointID != assigned.ID {
+		t.Errorf("expected the detail stored once for the status, got %+v", metrics)
+	}
+	var count int64
+	models.DB.Model(&models.Status{}).Where("endpoint_id = ?", other.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected no result stored for an endpoint not assigned to the probe, got %d", count)
+	}
+
+	// The statuses can be told apart by location
+	for location, want := range map[string]string{probe.Location: statusID, "": central.ID} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/endpoints/"+assigned.ID+"/statuses?location="+location, nil), -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		var statuses []models.Status
+		json.NewDecoder(resp.Body).Decode(&statuses)
+		if len(statuses) != 1 || statuses[0].ID != want {
+			t.Errorf("expected only status %s for location %q, got %+v", want, location, statuses)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/endpoints/"+assigned.ID+"/locations", nil), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	var summaries []LocationSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summaries); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	byLocation := make(map[string]LocationSummary)
+	for _, summary := range summaries {
+		byLocation[summary.Location] = summary
+	}
+	if len(byLocation) != 2 || byLocation[""].Uptime != 100 || byLocation[probe.Location].Uptime != 0 {
+		t.Errorf("expected the central worker up and the probe down, got %+v", summaries)
+	}
+}
+
+func TestCreateEndpointInvalidProbeSettings(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, payload := range []string{
+		`{"url":"http://example.com","interval":60,"probe_locations":["eu west"]}`,
+		`{"url":"example.com","check_type":"domain","interval":3600,"probe_locations":["*"]}`,
+		`{"url":"http://example.com","interval":60,"quorum":-1}`,
+		`{"url":"example.com","check_type":"ssl","interval":3600,"quorum":2}`,
+		// Only the central worker votes without probes, a quorum of 2 could never be met
+		`{"url":"http://example.com","interval":60,"quorum":2}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/endpoints", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %s, got %d", payload, resp.StatusCode)
+		}
+	}
+}
+
+func TestQuorumOpensAndResolvesIncident(t *testing.T) {
+	app := newProbeTestApp(t)
+	probeA, tokenA := newTestProbe(t)
+	probeB, tokenB := newTestProbe(t)
+
+	ep := models.Endpoint{
+		ID: uuid.New().String(), URL: "http://quorum", CheckType: "http", Interval: 60,
+		ProbeLocations: models.StringArray{probeA.Location, probeB.Location}, Quorum: 2,
+	}
+	if err := models.DB.Create(&ep).Error; err != nil {
+		t.Fatalf("failed to seed endpoint: %v", err)
+	}
+	if err := models.DB.Create(&models.Status{ID: uuid.New().String(), EndpointID: ep.ID, Code: 200, CheckedAt: time.Now()}).Error; err != nil {
+		t.Fatalf("failed to seed central status: %v", err)
+	}
+
+	push := func(token string, code int) {
+		t.Helper()
+		report := models.ProbeReport{Results: []models.ProbeResult{{
+			EndpointID: ep.ID,
+			Status:     &models.Status{ID: uuid.New().String(), Code: code, CheckedAt: time.Now()},
+		}}}
+		payload, _ := json.Marshal(report)
+		resp, err := app.Test(agentRequest(http.MethodPost, "/agent/results", token, string(payload)), -1)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("failed to push result: %v", err)
+		}
+	}
+	incidents := func() []models.Incident {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/endpoints/"+ep.ID+"/incidents", nil), -1)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		var body []models.Incident
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body
+	}
+
+	// One probe's bad network isn't enough
+	push(tokenA, 503)
+	if got := incidents(); len(got) != 0 {
+		t.Fatalf("expected no incident with one failing probe, got %+v", got)
+	}
+
+	push(tokenB, 503)
+	got := incidents()
+	if len(got) != 1 || got[0].ResolvedAt != nil || got[0].Quorum != 2 {
+		t.Fatalf("expected an open incident once 2 probes failed, got %+v", got)
+	}
+	failing := make(map[string]bool)
+	for _, vote := range got[0].Votes {
+		failing[vote.Location] = !vote.Passed
+	}
+	if len(got[0].Votes) != 3 || !failing[probeA.Location] || !failing[probeB.Location] || failing[""] {
+		t.Errorf("expected the incident to record each probe's result, got %+v", got[0].Votes)
+	}
+
+	// Still down, the open incident isn't duplicated
+	push(tokenA, 503)
+	if got := incidents(); len(got) != 1 {
+		t.Fatalf("expected one incident, got %d", len(got))
+	}
+
+	push(tokenA, 200)
+	got = incidents()
+	if len(got) != 1 || got[0].ResolvedAt == nil {
+		t.Fatalf("expected the incident resolved once the quorum broke, got %+v", got)
+	}
+}
+
+func TestQuorumShortOfVotesKeepsIncidentOpen(t *testing.T) {
+	app := newProbeTestApp(t)
+	probeA, tokenA := newTestProbe(t)
+	probeB, _ := newTestProbe(t)
+
+	ep := models.Endpoint{
+		ID: uuid.New().String(), URL: "http://quorum-short", CheckType: "http", Interval: 60,
+		ProbeLocations: models.StringArray{probeA.Location, probeB.Location}, Quorum: 2,
+	}
+	if err := models.DB.Create(&ep).Error; err != nil {
+		t.Fatalf("failed to seed endpoint: %v", err)
+	}
+	incident := models.Incident{
+		ID: uuid.New().String(), EndpointID: ep.ID, StartedAt: time.Now().Add(-time.Minute), Quorum: 2,
+		OpenEndpointID: &ep.ID,
+	}
+	if err := models.DB.Create(&incident).Error; err != nil {
+		t.Fatalf("failed to seed incident: %v", err)
+	}
+
+	// A single passing probe is fewer votes than the quorum, it can't tell the endpoint recovered
+	report := models.ProbeReport{Results: []models.ProbeResult{{
+		EndpointID: ep.ID,
+		Status:     &models.Status{ID: uuid.New().String(), Code: 200, CheckedAt: time.Now()},
+	}}}
+	payload, _ := json.Marshal(report)
+	resp, err := app.Test(agentRequest(http.MethodPost, "/agent/results", tokenA, string(payload)), -1)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to push result: %v", err)
+	}
+
+	var got models.Incident
+	if err := models.DB.First(&got, "id = ?", incident.ID).Error; err != nil {
+		t.Fatalf("failed to load incident: %v", err)
+	}
+	if got.ResolvedAt != nil || got.OpenEndpointID == nil {
+		t.Errorf("expected the incident to stay open with fewer votes than the quorum, got %+v", got)
+	}
+}
+
+func TestAgentReportsNetworkHealth(t *testing.T) {
+	app := newProbeTestApp(t)
+	probe, token := newTestProbe(t)
+
+	report := func(healthy bool, checkedAt time.Time) {
+		t.Helper()
+		payload, _ := json.Marshal(models.ProbeReport{Health: &models.ProbeHealth{Healthy: healthy, CheckedAt: checkedAt}})
+		resp, err := app.Test(agentRequest(http.MethodPost, "/agent/results", token, string(payload)), -1)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("failed to report health: %v", err)
+		}
+	}
+	now := time.Now()
+	report(false, now)
+	// A batch buffered before doesn't override what the probe saw last
+	report(true, now.Add(-time.Minute))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/probes", nil), -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	var probes []models.Probe
+	json.NewDecoder(resp.Body).Decode(&probes)
+	for _, p := range probes {
+		if p.ID != probe.ID {
+			continue
+		}
+		if p.NetworkHealthy == nil || *p.NetworkHealthy || p.NetworkCheckedAt == nil {
+			t.Errorf("expected the probe's latest network health, got %+v", p)
+		}
+		return
+	}
+	t.Fatalf("expected probe %s listed", probe.ID)
+}
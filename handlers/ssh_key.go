@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/monty/models"
+)
+
+func RegisterSSHKeys(app fiber.Router) {
+	app.Get("/ssh-keys", listSSHKeys)
+	app.Post("/ssh-keys", createSSHKey)
+	app.Delete("/ssh-keys/:id", deleteSSHKey)
+}
+
+func listSSHKeys(c *fiber.Ctx) error {
+	var keys []models.SSHKey
+	models.DB.Order("name").Find(&keys)
+	return c.JSON(keys)
+}
+
+func createSSHKey(c *fiber.Ctx) error {
+	var input struct {
+		Name       string `json:"name"`
+		PrivateKey string `json:"private_key"`          // PEM private key, OpenSSH or PKCS#8
+		Passphrase string `json:"passphrase,omitempty"` // for encrypted keys, not stored
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid input"})
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || input.PrivateKey == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name and private_key must be provided"})
+	}
+
+	key, err := models.NewSSHKey(input.Name, []byte(input.PrivateKey), input.Passphrase)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid ssh key"})
+	}
+
+	if err := models.DB.Create(&key).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store ssh key"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+func deleteSSHKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ssh key id required"})
+	}
+
+	var key models.SSHKey
+	if err := models.DB.First(&key, "id = ?", id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "ssh key not found"})
+	}
+
+	var inUse int64
+	models.DB.Model(&models.Endpoint{}).Where("ssh_key_id = ?", id).Count(&inUse)
+	if inUse > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "ssh key is used by endpoints"})
+	}
+
+	if err := models.DB.Delete(&key).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete ssh key"})
+	}
+
+	return c.JSON(fiber.Map{"message": "ssh key deleted successfully"})
+}
+
+// sshKeyExists reports whether id refers to a stored ssh key
+func sshKeyExists(id string) bool {
+	var count int64
+	models.DB.Model(&models.SSHKey{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSSHKeyTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	setupTestDB(t)
+
+	app := fiber.New()
+	RegisterEndpoints(app)
+	RegisterSSHKeys(app)
+	return app
+}
+
+func encryptedSSHKeyPEM(t *testing.T, passphrase string) (string, ssh.PublicKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	sshPub, _ := ssh.NewPublicKey(pub)
+	return string(pem.EncodeToMemory(block)), sshPub
+}
+
+func postJSON(t *testing.T, app *fiber.App, path, payload string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	return resp
+}
+
+func TestCreateSSHKey(t *testing.T) {
+	app := newSSHKeyTestApp(t)
+
+	keyPEM, pub := encryptedSSHKeyPEM(t, "hunter2")
+	payload, _ := json.Marshal(map[string]string{"name": "bastion", "private_key": keyPEM, "passphrase": "wrong"})
+	if resp := postJSON(t, app, "/ssh-keys", string(payload)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a wrong passphrase to be rejected, got %d", resp.StatusCode)
+	}
+
+	payload, _ = json.Marshal(map[string]string{"name": "bastion", "private_key": keyPEM, "passphrase": "hunter2"})
+	resp := postJSON(t, app, "/ssh-keys", string(payload))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if _, leaked := body["PrivateKeyPEM"]; leaked {
+		t.Fatalf("private key must not be returned")
+	}
+	if body["fingerprint"] != ssh.FingerprintSHA256(pub) || body["key_type"] != "ssh-ed25519" {
+		t.Fatalf("unexpected key metadata %v", body)
+	}
+
+	// ssh endpoints authenticate with the stored key, and it can't be deleted while in use
+	id := body["id"].(string)
+	epPayload := `{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_username":"monitor","ssh_key_id":"` + id + `"}`
+	if resp := postJSON(t, app, "/endpoints", epPayload); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/ssh-keys/"+id, nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, resp.StatusCode)
+	}
+}
+
+func TestCreateSSHEndpointValidation(t *testing.T) {
+	app := newSSHKeyTestApp(t)
+
+	for payload, want := range map[string]int{
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_host_key_fingerprint":"SHA256:9IFkyL+RfJc9jNdnn1txs5SrlCDUgw2Ox7KuhDHb51U="}`: http.StatusCreated,
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_host_key_fingerprint":"MD5:16:27:AC:A5:76:28:2D:36:63:1B:56:4D:EB:DF:A6:48"}`: http.StatusCreated,
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_host_key_fingerprint":"SHA256:tooshort"}`:                                     http.StatusBadRequest,
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_host_key_algorithm":"ssh-dss"}`:                                               http.StatusBadRequest,
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_username":"monitor"}`:                                                         http.StatusBadRequest,
+		`{"url":"127.0.0.1:1","check_type":"ssh","interval":60,"ssh_username":"monitor","ssh_key_id":"missing"}`:                                  http.StatusBadRequest,
+	} {
+		if resp := postJSON(t, app, "/endpoints", payload); resp.StatusCode != want {
+			t.Fatalf("%s: expected status %d, got %d", payload, want, resp.StatusCode)
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"log"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/monty/agent"
 	"github.com/monty/handlers"
 	"github.com/monty/models"
 	"github.com/monty/worker"
@@ -15,7 +21,20 @@ import (
 //go:embed static/*
 var staticFiles embed.FS
 
+// shutdownTimeout bounds a graceful shutdown, inside the 30 seconds container runtimes wait
+// between SIGTERM and SIGKILL
+const shutdownTimeout = 25 * time.Second
+
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// "monty agent" runs a remote probe, which reports to a central server and has no database
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent(ctx)
+		return
+	}
+
 	models.ConnectDatabase()
 	if err := models.Seed(); err != nil {
 		panic(err)
@@ -40,6 +59,11 @@ func main() {
 	api := app.Group("/api")
 	handlers.RegisterHealth(api)
 	handlers.RegisterEndpoints(api)
+	handlers.RegisterCheckTypes(api)
+	handlers.RegisterHeartbeats(api)
+	handlers.RegisterClientCertificates(api)
+	handlers.RegisterSSHKeys(api)
+	handlers.RegisterProbes(api)
 
 	// Serve React app for all other routes
 	app.Get("/*", func(c *fiber.Ctx) error {
@@ -50,26 +74,48 @@ func main() {
 	models.DB.Find(&eps)
 	var workerEps []worker.Endpoint
 	for _, ep := range eps {
-		workerEps = append(workerEps, worker.Endpoint{
-		ID:                  ep.ID,
-		URL:                 ep.URL,
-		Interval:            time.Duration(ep.Interval) * time.Second,
-		Timeout:             time.Duration(ep.Timeout) * time.Second,
-		ExpectedStatusCodes: []int(ep.ExpectedStatusCodes),
-		MaxResponseTime:     time.Duration(ep.MaxResponseTime) * time.Millisecond,
-	})
+		workerEps = append(workerEps, worker.EndpointFromModel(ep))
 	}
 	// Start server in a goroutine
 	go func() {
-		app.Listen(":3000")
+		if err := app.Listen(":3000"); err != nil {
+			log.Printf("server stopped: %v", err)
+		}
 	}()
 
 	// Start worker after a short delay to ensure server is up
 	time.Sleep(1 * time.Second)
 	worker.StartGlobalWorker(workerEps)
 
-	// Wait forever
-	select {}
+	// Run until SIGINT or SIGTERM, a second signal kills the process right away
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop taking requests first, so the API doesn't start monitors while the worker stops
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		log.Printf("failed to shut down the server: %v", err)
+	}
+	if err := worker.Shutdown(shutdownCtx); err != nil {
+		log.Printf("checks still running at the shutdown deadline were cancelled: %v", err)
+	}
+	if err := models.CloseDatabase(); err != nil {
+		log.Printf("failed to close the database: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+func runAgent(ctx context.Context) {
+	config, err := agent.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := agent.Run(ctx, config, shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Shutdown complete")
 }
 
 func getContentType(filename string) string {
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnknownCheckType = errors.New("unknown check type")
+
+// CheckConfig is the configuration side of a check type: the endpoint settings it uses, their
+// defaults and validation, and how its recorded statuses are judged. The worker registers one for
+// every type it can run, so endpoints of a type it doesn't know are rejected
+type CheckConfig interface {
+	// Name is the endpoint's check_type
+	Name() string
+	Description() string
+	// Settings returns JSON schema properties for the type-specific settings, keyed by JSON name.
+	// A type only accepts expect_failure, retries, probe_locations and quorum when it lists them
+	Settings() map[string]any
+	// ApplyDefaults fills in the type's defaults before the endpoint is validated
+	ApplyDefaults(e *Endpoint)
+	// Validate checks the type-specific settings
+	Validate(e *Endpoint) error
+	// Passed reports whether a status recorded for the endpoint was a passing check
+	Passed(e *Endpoint, s *Status) bool
+}
+
+// checkConfigs is filled while packages initialize and only read afterwards
+var checkConfigs = make(map[string]CheckConfig)
+
+// RegisterCheckConfig makes a check type available to endpoints. It's meant to be called from an
+// init function and panics when the type is registered twice
+func RegisterCheckConfig(c CheckConfig) {
+	if _, exists := checkConfigs[c.Name()]; exists {
+		panic("check type " + c.Name() + " registered twice")
+	}
+	checkConfigs[c.Name()] = c
+}
+
+// LookupCheckConfig returns the registered check type called name
+func LookupCheckConfig(name string) (CheckConfig, bool) {
+	c, ok := checkConfigs[name]
+	return c, ok
+}
+
+// CheckConfigs returns the registered check types sorted by name
+func CheckConfigs() []CheckConfig {
+	configs := make([]CheckConfig, 0, len(checkConfigs))
+	for _, c := range checkConfigs {
+		configs = append(configs, c)
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name() < configs[j].Name() })
+	return configs
+}
+
+// acceptsSetting reports whether a check type lists a setting among its own
+func acceptsSetting(c CheckConfig, name string) bool {
+	_, ok := c.Settings()[name]
+	return ok
+}
+
+// NormalizeCheckTypes turns stored endpoints whose check type isn't registered into http endpoints,
+// which is what they were checked as before check types were registered. Saving them would fail
+// with ErrUnknownCheckType otherwise
+func NormalizeCheckTypes(db *gorm.DB) error {
+	if _, ok := checkConfigs["http"]; !ok {
+		return nil // the worker's check types aren't registered in this binary
+	}
+	names := make([]string, 0, len(checkConfigs))
+	for name := range checkConfigs {
+		names = append(names, name)
+	}
+	result := db.Model(&Endpoint{}).Where("check_type IS NULL OR check_type NOT IN ?", names).UpdateColumn("check_type", "http")
+	if result.RowsAffected > 0 {
+		log.Printf("Changed %d endpoints of unknown check types to http", result.RowsAffected)
+	}
+	return result.Error
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pkcs12"
+)
+
+var ErrInvalidClientCertificate = errors.New("client certificate requires a matching certificate and private key")
+
+// ClientCertificate is a stored credential used for mutual TLS by HTTP and SSL checks
+type ClientCertificate struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	Name           string    `json:"name"`
+	CertificatePEM string    `gorm:"not null" json:"-"` // leaf first, followed by any intermediates
+	PrivateKeyPEM  string    `gorm:"not null" json:"-"`
+	Subject        string    `json:"subject"`
+	Issuer         string    `json:"issuer"`
+	SerialNumber   string    `json:"serial_number"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// NewClientCertificate validates a PEM certificate chain and private key and records the leaf's metadata
+func NewClientCertificate(name string, certPEM, keyPEM []byte) (ClientCertificate, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return ClientCertificate{}, ErrInvalidClientCertificate
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return ClientCertificate{}, ErrInvalidClientCertificate
+	}
+
+	return ClientCertificate{
+		ID:             uuid.New().String(),
+		Name:           name,
+		CertificatePEM: string(certPEM),
+		PrivateKeyPEM:  string(keyPEM),
+		Subject:        leaf.Subject.String(),
+		Issuer:         leaf.Issuer.String(),
+		SerialNumber:   leaf.SerialNumber.String(),
+		ExpiresAt:      leaf.NotAfter,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+// NewClientCertificateFromPKCS12 converts a PKCS#12 bundle into a stored client certificate
+func NewClientCertificateFromPKCS12(name string, data []byte, password string) (ClientCertificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return ClientCertificate{}, ErrInvalidClientCertificate
+	}
+
+	var keyPEM []byte
+	var certs [][]byte
+	for _, block := range blocks {
+		encoded := pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, encoded)
+		} else {
+			keyPEM = encoded
+		}
+	}
+
+	// Bundles don't guarantee the leaf comes first, use whichever certificate matches the key
+	for i := range certs {
+		chain := append([][]byte{certs[i]}, certs[:i]...)
+		chain = append(chain, certs[i+1:]...)
+		var certPEM []byte
+		for _, c := range chain {
+			certPEM = append(certPEM, c...)
+		}
+		if cert, err := NewClientCertificate(name, certPEM, keyPEM); err == nil {
+			return cert, nil
+		}
+	}
+	return ClientCertificate{}, ErrInvalidClientCertificate
+}
+
+// TLSCertificate returns the credential in the form used by tls.Config
+func (c ClientCertificate) TLSCertificate() (tls.Certificate, error) {
+	return tls.X509KeyPair([]byte(c.CertificatePEM), []byte(c.PrivateKeyPEM))
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ClusterNode is a running instance in cluster mode. Instances refresh HeartbeatAt while they run,
+// one that stops doing so is considered dead and its endpoints are taken over
+type ClusterNode struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	Hostname    string    `json:"hostname"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `gorm:"index" json:"heartbeat_at"`
+}
+
+// EndpointLease gives one instance the right to check an endpoint until ExpiresAt. The holder
+// renews it while it's the endpoint's owner, another instance may only take it once it expired
+type EndpointLease struct {
+	EndpointID string    `gorm:"primaryKey" json:"endpoint_id"`
+	NodeID     string    `gorm:"index" json:"node_id"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
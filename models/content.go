@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidContentWatch = errors.New("content watch requires a known mode and selector type")
+
+// Content watch modes
+const (
+	ContentModeChange = "change" // raise an event whenever the selected content changes
+	ContentModeStale  = "stale"  // fail when the selected content hasn't changed for ContentStaleAfter
+)
+
+// Content selector types, an empty type watches the whole body
+const (
+	ContentSelectorCSS   = "css"
+	ContentSelectorRegex = "regex"
+	ContentSelectorJSON  = "json"
+)
+
+// ContentSnapshot holds the last content seen for an endpoint
+type ContentSnapshot struct {
+	EndpointID    string    `gorm:"primaryKey" json:"endpoint_id"`
+	Hash          string    `json:"hash"` // sha256 of Content
+	Content       string    `json:"content"`
+	ChangedAt     time.Time `json:"changed_at"` // when the content last changed
+	StaleNotified bool      `json:"stale_notified"`
+	CheckedAt     time.Time `json:"checked_at"`
+}
+
+// Kinds of content change events
+const (
+	ContentEventChanged = "changed"
+	ContentEventStale   = "stale"
+)
+
+type ContentChange struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	EndpointID   string    `gorm:"index" json:"endpoint_id"`
+	Kind         string    `json:"kind"` // "changed" or "stale"
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+	Diff         string    `json:"diff"` // unified diff of the selected content
+	DetectedAt   time.Time `json:"detected_at"`
+}
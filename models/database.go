@@ -24,7 +24,19 @@ func ConnectDatabase() {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	if err := DB.AutoMigrate(&Endpoint{}, &Status{}, &SSLStatus{}, &DomainStatus{}); err != nil {
+	if err := DB.AutoMigrate(&Endpoint{}, &Status{}, &SSLStatus{}, &DomainStatus{}, &HeartbeatPing{}, &TransactionStepResult{}, &ContentSnapshot{}, &ContentChange{}, &ClientCertificate{}, &DNSResolverResult{}, &DNSSECSignature{}, &EmailAuthFinding{}, &ExecMetric{}, &SecurityHeaderFinding{}, &SSHKey{}, &NTPResult{}, &ClusterNode{}, &EndpointLease{}, &Probe{}, &Incident{}); err != nil {
 		log.Fatalf("failed to migrate: %v", err)
 	}
+	if err := NormalizeCheckTypes(DB); err != nil {
+		log.Fatalf("failed to migrate: %v", err)
+	}
+}
+
+// CloseDatabase closes the database connection once nothing writes to it anymore
+func CloseDatabase() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidResolvers = errors.New("dns resolvers must be IP addresses, optionally with a port")
+
+// DNSResolverResult is what one resolver answered during a dns_propagation check
+type DNSResolverResult struct {
+	ID            string      `gorm:"primaryKey" json:"id"`
+	StatusID      string      `gorm:"index" json:"status_id"` // the Status row of the whole check
+	EndpointID    string      `gorm:"index" json:"endpoint_id"`
+	Resolver      string      `json:"resolver"`             // host:port that was queried
+	Nameserver    string      `json:"nameserver,omitempty"` // NS name for authoritative servers
+	Authoritative bool        `json:"authoritative"`
+	Answers       StringArray `gorm:"type:json" json:"answers"` // sorted record data, TTLs left out
+	SOASerial     uint32      `json:"soa_serial"`
+	Agrees        bool        `json:"agrees"`        // answers match the consensus
+	StaleSerial   bool        `json:"stale_serial"`  // SOA serial behind the newest one seen
+	ResponseTime  int         `json:"response_time"` // milliseconds
+	ErrorMessage  string      `json:"error_message"`
+	CheckedAt     time.Time   `json:"checked_at"`
+}
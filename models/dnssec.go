@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var ErrInvalidTrustAnchor = errors.New("dnssec trust anchor must be DS or DNSKEY records for a single zone")
+
+// DefaultDNSSECTrustAnchor holds the DS records of the root zone's key-signing keys, KSK-2017 and KSK-2024
+const DefaultDNSSECTrustAnchor = `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16`
+
+// TrustAnchor is the set of DS and DNSKEY records validation starts from
+type TrustAnchor struct {
+	Zone string
+	DS   []*dns.DS
+	Keys []*dns.DNSKEY
+}
+
+// ParseTrustAnchor reads DS and DNSKEY records in zone file format, one per line. Blank lines
+// and lines starting with ; are skipped
+func ParseTrustAnchor(text string) (*TrustAnchor, error) {
+	anchor := &TrustAnchor{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil || rr == nil {
+			return nil, ErrInvalidTrustAnchor
+		}
+		owner := strings.ToLower(rr.Header().Name)
+		if anchor.Zone != "" && anchor.Zone != owner {
+			return nil, ErrInvalidTrustAnchor
+		}
+		anchor.Zone = owner
+		switch rr := rr.(type) {
+		case *dns.DS:
+			anchor.DS = append(anchor.DS, rr)
+		case *dns.DNSKEY:
+			anchor.Keys = append(anchor.Keys, rr)
+		default:
+			return nil, ErrInvalidTrustAnchor
+		}
+	}
+	if anchor.Zone == "" {
+		return nil, ErrInvalidTrustAnchor
+	}
+	return anchor, nil
+}
+
+// DNSSECSignature is an RRSIG that was verified on the way from the trust anchor to the queried record
+type DNSSECSignature struct {
+	ID              string    `gorm:"primaryKey" json:"id"`
+	StatusID        string    `gorm:"index" json:"status_id"` // the Status row of the whole check
+	EndpointID      string    `gorm:"index" json:"endpoint_id"`
+	Owner           string    `json:"owner"`        // owner name of the signed records
+	TypeCovered     string    `json:"type_covered"` // e.g. DNSKEY, DS, A
+	SignerName      string    `json:"signer_name"`  // zone whose key made the signature
+	KeyTag          uint16    `json:"key_tag"`
+	Algorithm       string    `json:"algorithm"`
+	Inception       time.Time `json:"inception"`
+	Expiration      time.Time `json:"expiration"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Records an email_auth finding can be about
+const (
+	EmailRecordSPF    = "spf"
+	EmailRecordDKIM   = "dkim"
+	EmailRecordDMARC  = "dmarc"
+	EmailRecordMTASTS = "mta_sts"
+	EmailRecordTLSRPT = "tls_rpt"
+)
+
+// Finding severities, only errors fail the check
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// EmailAuthFinding is one problem or observation from an email_auth audit
+type EmailAuthFinding struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	StatusID   string    `gorm:"index" json:"status_id"` // the Status row of the whole audit
+	EndpointID string    `gorm:"index" json:"endpoint_id"`
+	Record     string    `json:"record"`   // spf, dkim, dmarc, mta_sts or tls_rpt
+	Name       string    `json:"name"`     // DNS name the record lives at
+	Severity   string    `json:"severity"` // error, warning or info
+	Message    string    `json:"message"`
+	Value      string    `json:"value,omitempty"` // the record as published, when there is one
+	CheckedAt  time.Time `json:"checked_at"`
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"net"
+	"net/url"
+	"slices"
 "strings"
 	"time"
 
@@ -42,10 +45,31 @@ func (a *IntArray) Scan(value interface{}) error {
 
 var ErrInvalidEndpoint = errors.New("endpoint requires a non-empty url and positive interval")
 
+var ErrInvalidProxy = errors.New("proxy url must use the http, https, socks5 or socks5h scheme")
+
+var ErrInvalidSchedule = errors.New("heartbeat schedule must be a valid cron expression")
+
+var ErrInvalidAddressFamily = errors.New("address family must be auto, ipv4, ipv6 or both")
+
+var ErrInvalidExpectFailure = errors.New("expect_failure is only supported by http, tcp and ping checks")
+
+var ErrInvalidRetries = errors.New("retries must be between 0 and 10, every attempt's timeout and the retry_interval waits must fit in the interval, and heartbeat and domain checks don't support them")
+
+// MaxRetries caps how often a failed check is re-run before its failure is recorded
+const MaxRetries = 10
+
+// Address families an endpoint's connections can be restricted to
+const (
+	AddressFamilyAuto = "auto" // whatever the resolver and dialer pick
+	AddressFamilyIPv4 = "ipv4"
+	AddressFamilyIPv6 = "ipv6"
+	AddressFamilyBoth = "both" // check once over each family, recording separate results
+)
+
 type Endpoint struct {
 ID                   string      `gorm:"primaryKey" json:"id"`
 URL                  string      `gorm:"not null" json:"url"`
-CheckType            string      `gorm:"default:http" json:"check_type"` // "http", "ssl", "dns", "ping", "tcp"
+CheckType            string      `gorm:"default:http" json:"check_type"` // a registered check type, listed by GET /api/check-types
 Interval             int         `gorm:"not null" json:"interval"` // seconds
 Timeout              int         `gorm:"default:30" json:"timeout"` // seconds, default 30
 ExpectedStatusCodes  IntArray   `gorm:"type:json" json:"expected_status_codes"` // empty means 200-299
@@ -55,12 +79,58 @@ MinDaysValid         int         `gorm:"default:30" json:"min_days_valid"` // da
 CheckChain           bool        `gorm:"default:true" json:"check_chain"` // default true
 CheckDomainMatch     bool        `gorm:"default:true" json:"check_domain_match"` // default true
 AcceptableTLSVersions StringArray `gorm:"type:json" json:"acceptable_tls_versions"` // e.g., ["TLS 1.2", "TLS 1.3"]
+	ClientCertificateID  string      `json:"client_certificate_id"` // optional client certificate for mutual TLS (HTTP and SSL checks)
+	ProxyURL             string      `json:"proxy_url"` // optional http://, https:// or socks5:// proxy, credentials as user:pass@, see Redacted
+	AddressFamily        string      `gorm:"default:auto" json:"address_family"` // auto, ipv4, ipv6 or both
+	ExpectFailure        bool        `json:"expect_failure"` // pass only while the target is unreachable (or answers with expected_status_codes)
+	Retries              int         `json:"retries"` // re-run a failed check this many times before recording the failure
+	RetryInterval        int         `json:"retry_interval"` // seconds between retries, default 10
 // DNS-specific fields
 	DNSRecordType        string      `gorm:"default:A" json:"dns_record_type"` // A, AAAA, CNAME, MX, TXT, etc.
 	ExpectedDNSAnswers   IntArray   `gorm:"type:json" json:"expected_dns_answers"` // minimum number of answers expected
+	DNSResolvers         StringArray `gorm:"type:json" json:"dns_resolvers"` // resolver IPs (optionally ip:port) to compare in dns_propagation, others use the first
+	DNSCheckAuthoritative bool       `json:"dns_check_authoritative"` // also query the zone's authoritative nameservers
+	DNSSEC               bool        `json:"dnssec"` // dns checks validate the chain of trust, through the first of DNSResolvers
+	DNSSECTrustAnchor    string      `json:"dnssec_trust_anchor,omitempty"` // DS or DNSKEY records, the root KSKs when empty
+	DNSSECMinDaysValid   int         `json:"dnssec_min_days_valid"` // days, default 3
+	// Email authentication fields
+	DKIMSelectors        StringArray `gorm:"type:json" json:"dkim_selectors"` // DKIM selectors to audit, email_auth only
+	// Exec-specific fields, the endpoint's URL is the command to run
+	ExecArgs             StringArray `gorm:"type:json" json:"exec_args"` // arguments passed to the command
+	ExecEnv              StringArray `gorm:"type:json" json:"exec_env"` // KEY=value entries added to the command's environment
+	// Prometheus-specific fields
+	MetricAssertions     StringArray `gorm:"type:json" json:"metric_assertions"` // e.g. queue_depth{queue="emails"} < 1000, up exists
+	// SSH-specific fields, the endpoint's URL is host or host:port, port 22 by default
+	SSHHostKeyFingerprint string     `json:"ssh_host_key_fingerprint"` // pinned host key, SHA256:... as printed by ssh-keygen -l
+	SSHHostKeyAlgorithm  string      `json:"ssh_host_key_algorithm"` // optional, negotiate only this host key type so the pin is comparable
+	SSHUsername          string      `json:"ssh_username"` // optional, authenticate as this user
+	SSHKeyID             string      `json:"ssh_key_id"` // optional stored SSH key to authenticate with
+	// NTP-specific fields, the endpoint's URL is host or host:port, port 123 by default
+	NTPMaxOffset         int         `json:"ntp_max_offset"` // milliseconds the server's clock may be off, default 100
 	// TCP-specific fields
 	TCPPort              int         `gorm:"default:80" json:"tcp_port"` // port to connect to
+	// Heartbeat-specific fields
+	HeartbeatToken       string      `gorm:"index" json:"-"` // secret token for /api/ping/:token, only returned when generated
+	HeartbeatSchedule    string      `json:"heartbeat_schedule"` // optional cron expression, Interval is used when empty
+	HeartbeatGrace       int         `gorm:"default:60" json:"heartbeat_grace"` // seconds, default 60
+	HeartbeatMaxRuntime  int         `json:"heartbeat_max_runtime"` // seconds between start and success pings, 0 disables
+	// Transaction-specific fields
+	TransactionSteps     TransactionSteps `gorm:"type:json" json:"transaction_steps,omitempty"` // ordered HTTP steps
+	// Content change detection for HTTP endpoints
+	ContentMode          string      `json:"content_mode"` // "", "change" or "stale"
+	ContentSelectorType  string      `json:"content_selector_type"` // "", "css", "regex" or "json"
+	ContentSelector      string      `json:"content_selector"` // CSS selector, expression or JSONPath
+	ContentStaleAfter    int         `json:"content_stale_after"` // seconds, stale mode only, default 86400
+	// Security header audit for HTTP endpoints
+	SecurityHeaders      bool        `json:"security_headers"` // grade the response's security headers
+	MinSecurityGrade     string      `json:"min_security_grade"` // fail below this grade, e.g. "B", empty only records it
 	CreatedAt            time.Time   `json:"created_at"`
+	NextCheckAt          *time.Time  `json:"next_check_at,omitempty"` // when the scheduler runs the next check, empty until the first
+	// Remote probes checking the endpoint besides the central worker, by location, * for all
+	ProbeLocations       StringArray `gorm:"type:json" json:"probe_locations"`
+	// Down detection across probes, the central worker counting as one
+	Quorum               int         `json:"quorum"` // failing probes that open an incident, 0 for a majority of those reporting
+	QuorumWindow         int         `json:"quorum_window"` // seconds a probe's latest result counts, default twice the interval
 }
 
 func (e *Endpoint) BeforeSave(tx *gorm.DB) error {
@@ -82,42 +152,146 @@ func (e *Endpoint) BeforeSave(tx *gorm.DB) error {
 		e.MaxResponseTime = 5000
 	}
 
-	// SSL-specific defaults
-	if e.CheckType == "ssl" {
-	if e.Interval == 60 { // if default interval, set to 24h for SSL
-	e.Interval = 86400
+	// Type-specific defaults come first, the checks below see the values the check runs with
+	config, ok := LookupCheckConfig(e.CheckType)
+	if !ok {
+		return ErrUnknownCheckType
 	}
-	if e.MinDaysValid <= 0 {
-	e.MinDaysValid = 30
+	config.ApplyDefaults(e)
+	for _, resolver := range e.DNSResolvers {
+		host := resolver
+		if h, _, err := net.SplitHostPort(resolver); err == nil {
+			host = h
+		}
+		if net.ParseIP(strings.Trim(host, "[]")) == nil {
+			return ErrInvalidResolvers
+		}
 	}
-	if len(e.AcceptableTLSVersions) == 0 {
-	e.AcceptableTLSVersions = []string{"TLS 1.2", "TLS 1.3"}
+
+	// SSH pins are compared in ssh-keygen's format
+	if e.SSHHostKeyFingerprint != "" {
+		fingerprint, err := NormalizeHostKeyFingerprint(e.SSHHostKeyFingerprint)
+		if err != nil {
+			return err
+		}
+		e.SSHHostKeyFingerprint = fingerprint
+	}
+	if e.SSHHostKeyAlgorithm != "" && !slices.Contains(SSHHostKeyAlgorithms, e.SSHHostKeyAlgorithm) {
+		return ErrInvalidSSHHostKeyAlgorithm
 	}
+	if (e.SSHUsername == "") != (e.SSHKeyID == "") {
+		return ErrInvalidSSHAuth
+	}
+
+	if err := ValidateExecEnv(e.ExecEnv); err != nil {
+		return err
 	}
 
-	// DNS-specific defaults
-	if e.CheckType == "dns" {
-		if e.DNSRecordType == "" {
-			e.DNSRecordType = "A"
+	for _, assertion := range e.MetricAssertions {
+		if _, err := ParseMetricAssertion(assertion); err != nil {
+			return err
 		}
-		if len(e.ExpectedDNSAnswers) == 0 {
-			e.ExpectedDNSAnswers = []int{1} // expect at least 1 answer
+	}
+
+	if e.MinSecurityGrade != "" {
+		if SecurityGradeRank(e.MinSecurityGrade) == len(SecurityGrades) {
+			return ErrInvalidSecurityGrade
 		}
+		e.SecurityHeaders = true
 	}
 
-	// TCP-specific defaults
-	if e.CheckType == "tcp" {
-		if e.TCPPort <= 0 {
-			e.TCPPort = 80 // default to HTTP port
+	e.ProxyURL = strings.TrimSpace(e.ProxyURL)
+	if e.ProxyURL != "" {
+		u, err := url.Parse(e.ProxyURL)
+		if err != nil || u.Host == "" {
+			return ErrInvalidProxy
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return ErrInvalidProxy
 		}
 	}
 
-	// Domain-specific defaults
-	if e.CheckType == "domain" {
-		if e.Interval == 60 { // if default interval, set to 24h for domain
-			e.Interval = 86400
+	if e.ExpectFailure && !acceptsSetting(config, "expect_failure") {
+		return ErrInvalidExpectFailure
+	}
+
+	// Probes run the check types that work without the database
+	if len(e.ProbeLocations) > 0 && !acceptsSetting(config, "probe_locations") {
+		return ErrInvalidProbeLocations
+	}
+	if err := validateProbeLocations(e); err != nil {
+		return err
+	}
+	if (e.Quorum != 0 || e.QuorumWindow != 0) && !acceptsSetting(config, "quorum") {
+		return ErrInvalidQuorum
+	}
+	if err := validateQuorum(e); err != nil {
+		return err
+	}
+
+	// Retries have to fit before the next scheduled check, every attempt timing out and the waits
+	// in between included, and only types with transient failures worth retrying take them
+	if e.Retries > 0 && !acceptsSetting(config, "retries") {
+		return ErrInvalidRetries
+	}
+	if e.Retries > 0 && e.RetryInterval <= 0 {
+		e.RetryInterval = max(min(10, e.Interval/2), 1)
+	}
+	if e.Retries < 0 || e.Retries > MaxRetries || e.RetryInterval < 0 {
+		return ErrInvalidRetries
+	}
+	if e.Retries > 0 && e.Retries*e.RetryInterval+(e.Retries+1)*e.Timeout >= e.Interval {
+		return ErrInvalidRetries
+	}
+
+	switch e.AddressFamily {
+	case "":
+		e.AddressFamily = AddressFamilyAuto
+	case AddressFamilyAuto, AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyBoth:
+	default:
+		return ErrInvalidAddressFamily
+	}
+
+	// Content watch validation and defaults
+	if e.ContentMode != "" && !acceptsSetting(config, "content_mode") {
+		return ErrInvalidContentWatch
+	}
+	switch e.ContentMode {
+	case "", ContentModeChange, ContentModeStale:
+	default:
+		return ErrInvalidContentWatch
+	}
+	switch e.ContentSelectorType {
+	case "":
+	case ContentSelectorCSS, ContentSelectorRegex, ContentSelectorJSON:
+		if e.ContentSelector == "" {
+			return ErrInvalidContentWatch
 		}
+	default:
+		return ErrInvalidContentWatch
+	}
+	if e.ContentMode == ContentModeStale && e.ContentStaleAfter <= 0 {
+		e.ContentStaleAfter = 86400
+	}
+
+	return config.Validate(e)
+}
+
+// Redacted returns the endpoint as API responses show it, with its proxy password masked
+func (e Endpoint) Redacted() Endpoint {
+	if u, err := url.Parse(e.ProxyURL); err == nil && u.User != nil {
+		e.ProxyURL = u.Redacted()
 	}
+	return e
+}
 
-	return nil
+// UnredactProxyURL returns the proxy URL an update sets: the stored one when the update echoes
+// its redacted form, so the masked password isn't saved in place of the real one
+func UnredactProxyURL(input, stored string) string {
+	if input != stored && input == (Endpoint{ProxyURL: stored}).Redacted().ProxyURL {
+		return stored
+	}
+	return input
 }
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidExecEnv = errors.New("exec environment entries must be KEY=value and can't set PATH, loader, shell or interpreter startup variables")
+
+// execEnvKey is the form of the environment variables a plugin can be given
+var execEnvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Variables that make the dynamic loader, a shell or an interpreter run code of the caller's
+// choosing before the plugin does, which would get around EXEC_PLUGIN_DIRS
+var (
+	deniedExecEnvKeys = []string{
+		"PATH", "IFS", "ENV", "BASH_ENV", "SHELLOPTS", "BASHOPTS", "PS4",
+		"PERL5OPT", "PERL5LIB", "PERLLIB", "PYTHONPATH", "PYTHONHOME", "PYTHONSTARTUP", "RUBYOPT", "RUBYLIB", "NODE_OPTIONS",
+	}
+	deniedExecEnvPrefixes = []string{"LD_", "DYLD_", "BASH_FUNC_"}
+)
+
+// ValidateExecEnv checks the KEY=value entries an exec check adds to its plugin's environment
+func ValidateExecEnv(env []string) error {
+	for _, entry := range env {
+		key, _, ok := strings.Cut(entry, "=")
+		if !ok || !execEnvKey.MatchString(key) {
+			return ErrInvalidExecEnv
+		}
+		key = strings.ToUpper(key)
+		if slices.Contains(deniedExecEnvKeys, key) {
+			return ErrInvalidExecEnv
+		}
+		for _, prefix := range deniedExecEnvPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				return ErrInvalidExecEnv
+			}
+		}
+	}
+	return nil
+}
+
+// Nagios plugin states, the exit codes of an exec check
+const (
+	ExecOK       = 0
+	ExecWarning  = 1
+	ExecCritical = 2
+	ExecUnknown  = 3
+)
+
+// ExecStateNames maps a plugin exit code to its Nagios state
+var ExecStateNames = map[int]string{
+	ExecOK:       "OK",
+	ExecWarning:  "WARNING",
+	ExecCritical: "CRITICAL",
+	ExecUnknown:  "UNKNOWN",
+}
+
+// ExecMetric is one performance data item reported by an exec check's plugin
+type ExecMetric struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	StatusID   string    `gorm:"index" json:"status_id"` // the Status row of the run that reported it
+	EndpointID string    `gorm:"index" json:"endpoint_id"`
+	Label      string    `json:"label"`
+	Value      float64   `json:"value"`
+	Unit       string    `json:"unit,omitempty"` // s, ms, us, %, B, KB, MB, TB, c or empty
+	Warn       string    `json:"warn,omitempty"` // threshold ranges as the plugin printed them
+	Crit       string    `json:"crit,omitempty"`
+	Min        *float64  `json:"min,omitempty"`
+	Max        *float64  `json:"max,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Kinds of pings a heartbeat monitor accepts
+const (
+	PingKindStart   = "start"
+	PingKindSuccess = "success"
+	PingKindFail    = "fail"
+)
+
+type HeartbeatPing struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	EndpointID string    `gorm:"not null;index" json:"endpoint_id"`
+	Kind       string    `json:"kind"` // "start", "success", "fail"
+	Body       string    `json:"body"` // optional payload, e.g. the job's last log lines
+	RemoteAddr string    `json:"remote_addr"`
+	ReceivedAt time.Time `json:"received_at"`
+}
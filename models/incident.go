@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidQuorum = errors.New("quorum and quorum_window can't be negative, and a quorum above 1 needs probe_locations")
+
+// Incident is a period an endpoint was down: a quorum of the probes checking it, the central worker
+// counting as one, failed within the quorum window. Votes records what each of them saw when it
+// opened
+type Incident struct {
+	ID         string        `gorm:"primaryKey" json:"id"`
+	EndpointID string        `gorm:"index" json:"endpoint_id"`
+	StartedAt  time.Time     `gorm:"index" json:"started_at"`
+	ResolvedAt *time.Time    `json:"resolved_at,omitempty"` // empty while the endpoint is down
+	Quorum     int           `json:"quorum"`                // failing probes it took
+	Votes      IncidentVotes `gorm:"type:json" json:"votes"`
+	// OpenEndpointID is the endpoint's ID while the incident is open and empty once resolved, so
+	// the unique index allows one open incident per endpoint
+	OpenEndpointID *string `gorm:"uniqueIndex" json:"-"`
+}
+
+// IncidentVote is the latest result of one probe within the quorum window
+type IncidentVote struct {
+	ProbeID      string    `json:"probe_id,omitempty"` // empty for the central worker
+	Location     string    `json:"location,omitempty"`
+	StatusID     string    `json:"status_id"`
+	Passed       bool      `json:"passed"`
+	Code         int       `json:"code"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+type IncidentVotes []IncidentVote
+
+func (v IncidentVotes) Value() (driver.Value, error) {
+	return json.Marshal(v)
+}
+
+func (v *IncidentVotes) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, v)
+}
+
+// validateQuorum checks an endpoint's quorum settings. Without probes the central worker is the
+// only one voting, and a larger quorum could never be met
+func validateQuorum(e *Endpoint) error {
+	if e.Quorum < 0 || e.QuorumWindow < 0 {
+		return ErrInvalidQuorum
+	}
+	if e.Quorum > 1 && len(e.ProbeLocations) == 0 {
+		return ErrInvalidQuorum
+	}
+	return nil
+}
+
+// QuorumWindowDuration is how old a probe's result can be and still count, twice the endpoint's
+// interval unless set
+func (e *Endpoint) QuorumWindowDuration() time.Duration {
+	if e.QuorumWindow > 0 {
+		return time.Duration(e.QuorumWindow) * time.Second
+	}
+	return 2 * time.Duration(e.Interval) * time.Second
+}
+
+// QuorumVotes returns the latest result of each probe that checked the endpoint within its quorum
+// window, the central worker's under an empty probe ID. A probe checking over both address families
+// fails when its latest check over either did. A probe whose latest result is unknown, its own
+// network being down, abstains
+func QuorumVotes(db *gorm.DB, e *Endpoint, now time.Time) ([]IncidentVote, error) {
+	config, ok := LookupCheckConfig(e.CheckType)
+	if !ok {
+		return nil, ErrUnknownCheckType
+	}
+	var statuses []Status
+	err := db.Where("endpoint_id = ? AND checked_at > ?", e.ID, now.Add(-e.QuorumWindowDuration())).Order("checked_at desc").Find(&statuses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type family struct{ probeID, family string }
+	seen := make(map[family]bool)
+	byProbe := make(map[string]int)
+	abstained := make(map[string]bool)
+	var votes []IncidentVote
+	for i := range statuses {
+		s := &statuses[i]
+		if seen[family{s.ProbeID, s.AddressFamily}] || abstained[s.ProbeID] {
+			continue
+		}
+		seen[family{s.ProbeID, s.AddressFamily}] = true
+		if s.Outcome == OutcomeUnknown {
+			if _, voted := byProbe[s.ProbeID]; !voted {
+				abstained[s.ProbeID] = true
+			}
+			continue
+		}
+		passed := config.Passed(e, s)
+		n, ok := byProbe[s.ProbeID]
+		if !ok {
+			byProbe[s.ProbeID] = len(votes)
+			votes = append(votes, IncidentVote{
+				ProbeID: s.ProbeID, Location: s.Location, StatusID: s.ID, Passed: passed,
+				Code: s.Code, ErrorMessage: s.ErrorMessage, CheckedAt: s.CheckedAt,
+			})
+			continue
+		}
+		// The other family's result only matters when it failed
+		if votes[n].Passed && !passed {
+			votes[n].Passed, votes[n].StatusID, votes[n].Code, votes[n].ErrorMessage = false, s.ID, s.Code, s.ErrorMessage
+		}
+	}
+	return votes, nil
+}
+
+// RequiredQuorum is how many of votes have to fail for the endpoint to be down: its quorum, or a
+// majority of the probes that reported when it's 0
+func (e *Endpoint) RequiredQuorum(votes int) int {
+	if e.Quorum > 0 {
+		return e.Quorum
+	}
+	return votes/2 + 1
+}
+
+// UpdateIncident opens an incident for the endpoint when a quorum of its probes' latest results
+// failed, and resolves the open one once they no longer do. With fewer results in the window than
+// its quorum the endpoint's state is left as it is. Only Status results are considered, ssl and
+// domain checks don't open incidents
+func UpdateIncident(db *gorm.DB, endpointID string, now time.Time) error {
+	var e Endpoint
+	if err := db.First(&e, "id = ?", endpointID).Error; err != nil {
+		return err
+	}
+	votes, err := QuorumVotes(db, &e, now)
+	if err != nil || len(votes) == 0 {
+		return err
+	}
+	failing := 0
+	for _, vote := range votes {
+		if !vote.Passed {
+			failing++
+		}
+	}
+	required := e.RequiredQuorum(len(votes))
+	if len(votes) < required {
+		// Too few probes reported to tell either way, the endpoint keeps its state
+		log.Printf("Endpoint %s: %d of %d votes failed, fewer probes reported within the quorum window than its quorum of %d", e.ID, failing, len(votes), required)
+		return nil
+	}
+
+	if failing >= required {
+		// The unique index keeps a concurrent evaluation from opening a second one
+		incident := Incident{
+			ID: uuid.New().String(), EndpointID: e.ID, StartedAt: now, Quorum: required, Votes: votes,
+			OpenEndpointID: &e.ID,
+		}
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&incident).Error
+	}
+	return db.Model(&Incident{}).Where("open_endpoint_id = ?", e.ID).
+		Updates(map[string]any{"resolved_at": now, "open_endpoint_id": nil}).Error
+}
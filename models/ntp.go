@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// NTP leap indicator values, LeapAlarm means the server's clock isn't synchronized
+const (
+	LeapNone      = 0
+	LeapAddSecond = 1
+	LeapDelSecond = 2
+	LeapAlarm     = 3
+)
+
+// NTPUnsynchronizedStratum is the stratum a server reports while it has no time source
+const NTPUnsynchronizedStratum = 16
+
+// NTPResult is the reading of one SNTP query made by an ntp check. Times are in milliseconds
+type NTPResult struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	StatusID       string    `gorm:"index" json:"status_id"` // the Status row of the check
+	EndpointID     string    `gorm:"index" json:"endpoint_id"`
+	ServerIP       string    `json:"server_ip"`
+	Stratum        int       `json:"stratum"`
+	LeapIndicator  int       `json:"leap_indicator"`
+	ReferenceID    string    `json:"reference_id"`    // the upstream server's IP, or a source like GPS at stratum 1
+	Offset         float64   `json:"offset"`          // server clock minus the Monty host's clock
+	RoundTrip      float64   `json:"round_trip"`      // network delay of the query
+	RootDelay      float64   `json:"root_delay"`      // the server's delay to its reference clock
+	RootDispersion float64   `json:"root_dispersion"` // the server's error estimate against its reference clock
+	CheckedAt      time.Time `json:"checked_at"`
+}
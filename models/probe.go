@@ -0,0 +1,180 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidProbe = errors.New("probe requires a name and a location of letters, digits, - and _")
+
+var ErrInvalidProbeLocations = errors.New("probe_locations must be probe locations or *, and endpoints using stored client certificates or ssh keys are only checked centrally")
+
+// AllProbes in an endpoint's ProbeLocations assigns it to every probe
+const AllProbes = "*"
+
+var probeLocationPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Probe is a remote agent checking endpoints from its location and reporting the results. It
+// authenticates with a token only its hash is kept of
+type Probe struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Location   string     `gorm:"not null;index" json:"location"` // label its results carry, e.g. "eu-west"
+	TokenHash  string     `gorm:"uniqueIndex" json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"` // last request the probe made
+	// The probe's own network as its canaries last saw it, empty until it reported
+	NetworkHealthy   *bool      `json:"network_healthy,omitempty"`
+	NetworkCheckedAt *time.Time `json:"network_checked_at,omitempty"`
+}
+
+// NewProbe creates a probe and returns it along with its token, which isn't stored
+func NewProbe(name, location string) (Probe, string, error) {
+	name, location = strings.TrimSpace(name), strings.TrimSpace(location)
+	if name == "" || !probeLocationPattern.MatchString(location) {
+		return Probe{}, "", ErrInvalidProbe
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Probe{}, "", err
+	}
+	token := hex.EncodeToString(secret)
+	return Probe{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Location:  location,
+		TokenHash: HashProbeToken(token),
+		CreatedAt: time.Now(),
+	}, token, nil
+}
+
+// HashProbeToken returns the hash a probe's token is looked up by
+func HashProbeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Assigned reports whether the probe checks the endpoint
+func (p Probe) Assigned(e Endpoint) bool {
+	return slices.Contains(e.ProbeLocations, p.Location) || slices.Contains(e.ProbeLocations, AllProbes)
+}
+
+// validateProbeLocations checks an endpoint's assignment to probes. Probes have no access to stored
+// credentials, endpoints that use them stay with the central worker
+func validateProbeLocations(e *Endpoint) error {
+	if len(e.ProbeLocations) == 0 {
+		return nil
+	}
+	if e.ClientCertificateID != "" || e.SSHKeyID != "" {
+		return ErrInvalidProbeLocations
+	}
+	for _, location := range e.ProbeLocations {
+		if location != AllProbes && !probeLocationPattern.MatchString(location) {
+			return ErrInvalidProbeLocations
+		}
+	}
+	return nil
+}
+
+// ProbeReport is a batch of results a probe sends, and its network's health when it has canaries
+type ProbeReport struct {
+	Results []ProbeResult `json:"results"`
+	Health  *ProbeHealth  `json:"health,omitempty"`
+}
+
+// ProbeHealth is whether a probe's canaries were reachable when it last probed them
+type ProbeHealth struct {
+	Healthy   bool      `json:"healthy"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ProbeResult is one check result a probe reports: the endpoint checked, the status of the check, a
+// Status or for ssl checks an SSLStatus, and the detail rows that refer to it
+type ProbeResult struct {
+	EndpointID string        `json:"endpoint_id"`
+	Status     *Status       `json:"status,omitempty"`
+	SSLStatus  *SSLStatus    `json:"ssl_status,omitempty"`
+	Details    []ProbeDetail `json:"details,omitempty"`
+}
+
+// ProbeDetail is a detail row of a probe's result, tagged with its kind
+type ProbeDetail struct {
+	Kind string          `json:"kind"`
+	Row  json.RawMessage `json:"row"`
+}
+
+// probeDetailKinds are the detail rows a probe can report, by kind
+var probeDetailKinds = map[string]func() any{
+	"dns_resolver_result":     func() any { return &DNSResolverResult{} },
+	"dnssec_signature":        func() any { return &DNSSECSignature{} },
+	"email_auth_finding":      func() any { return &EmailAuthFinding{} },
+	"exec_metric":             func() any { return &ExecMetric{} },
+	"ntp_result":              func() any { return &NTPResult{} },
+	"security_header_finding": func() any { return &SecurityHeaderFinding{} },
+	"transaction_step_result": func() any { return &TransactionStepResult{} },
+}
+
+// NewProbeDetail tags a detail row for reporting
+func NewProbeDetail(row any) (ProbeDetail, error) {
+	for kind, newRow := range probeDetailKinds {
+		if reflect.TypeOf(newRow()) == reflect.TypeOf(row) {
+			data, err := json.Marshal(row)
+			return ProbeDetail{Kind: kind, Row: data}, err
+		}
+	}
+	return ProbeDetail{}, fmt.Errorf("%T can't be reported by probes", row)
+}
+
+// Rows returns the rows to store for a result probe reported, its status first. The rows are tied
+// to the probe and the result's endpoint whatever else the probe sent
+func (r ProbeResult) Rows(probe Probe) ([]any, error) {
+	endpointID := r.EndpointID
+	var rows []any
+	var statusID string
+	switch {
+	case r.Status != nil:
+		r.Status.EndpointID, r.Status.ProbeID, r.Status.Location = endpointID, probe.ID, probe.Location
+		statusID = r.Status.ID
+		rows = append(rows, r.Status)
+	case r.SSLStatus != nil:
+		r.SSLStatus.EndpointID, r.SSLStatus.ProbeID, r.SSLStatus.Location = endpointID, probe.ID, probe.Location
+		statusID = r.SSLStatus.ID
+		rows = append(rows, r.SSLStatus)
+	default:
+		return nil, errors.New("result has no status")
+	}
+	if statusID == "" {
+		return nil, errors.New("result status has no id")
+	}
+
+	for _, detail := range r.Details {
+		newRow, ok := probeDetailKinds[detail.Kind]
+		if !ok {
+			return nil, fmt.Errorf("unknown detail kind %q", detail.Kind)
+		}
+		row := newRow()
+		if err := json.Unmarshal(detail.Row, row); err != nil {
+			return nil, fmt.Errorf("%s: %v", detail.Kind, err)
+		}
+		// Every detail row has these fields
+		v := reflect.ValueOf(row).Elem()
+		v.FieldByName("StatusID").SetString(statusID)
+		v.FieldByName("EndpointID").SetString(endpointID)
+		if v.FieldByName("ID").String() == "" {
+			return nil, fmt.Errorf("%s has no id", detail.Kind)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
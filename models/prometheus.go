@@ -0,0 +1,185 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidMetricAssertion = errors.New("metric assertions must look like name{label=\"value\"} < 1000, name exists or name absent")
+
+// MetricAssertion is a parsed prometheus check assertion, a series selector compared to a number or
+// tested for existence
+type MetricAssertion struct {
+	Metric   string
+	Matchers []LabelMatcher
+	Op       string // <, <=, >, >=, ==, !=, exists or absent
+	Value    float64
+}
+
+// LabelMatcher selects series by one label, with PromQL's =, !=, =~ and !~ operators
+type LabelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*`)
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// ParseMetricAssertion reads an assertion such as queue_depth{queue="emails"} < 1000
+func ParseMetricAssertion(text string) (*MetricAssertion, error) {
+	rest := strings.TrimSpace(text)
+	name := metricNamePattern.FindString(rest)
+	if name == "" {
+		return nil, ErrInvalidMetricAssertion
+	}
+	a := &MetricAssertion{Metric: name}
+	rest = strings.TrimSpace(rest[len(name):])
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if a.Matchers, rest, err = parseLabelMatchers(rest[1:]); err != nil {
+			return nil, err
+		}
+	}
+
+	rest = strings.TrimSpace(rest)
+	switch rest {
+	case "exists", "absent":
+		a.Op = rest
+		return a, nil
+	}
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if strings.HasPrefix(rest, op) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(rest[len(op):]), 64)
+			if err != nil {
+				return nil, ErrInvalidMetricAssertion
+			}
+			a.Op, a.Value = op, value
+			return a, nil
+		}
+	}
+	return nil, ErrInvalidMetricAssertion
+}
+
+// parseLabelMatchers reads matchers up to the closing brace and returns what follows it
+func parseLabelMatchers(rest string) ([]LabelMatcher, string, error) {
+	var matchers []LabelMatcher
+	for {
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "}") {
+			return matchers, rest[1:], nil
+		}
+		name := labelNamePattern.FindString(rest)
+		if name == "" {
+			return nil, "", ErrInvalidMetricAssertion
+		}
+		rest = strings.TrimSpace(rest[len(name):])
+
+		m := LabelMatcher{Name: name}
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, "", ErrInvalidMetricAssertion
+		}
+		rest = strings.TrimSpace(rest[len(m.Op):])
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, "", ErrInvalidMetricAssertion
+		}
+		if m.Value, err = strconv.Unquote(quoted); err != nil {
+			return nil, "", ErrInvalidMetricAssertion
+		}
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if m.Op == "=~" || m.Op == "!~" {
+			// Anchored like PromQL's regex matchers
+			if m.re, err = regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				return nil, "", ErrInvalidMetricAssertion
+			}
+		}
+		matchers = append(matchers, m)
+
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+		} else if !strings.HasPrefix(rest, "}") {
+			return nil, "", ErrInvalidMetricAssertion
+		}
+	}
+}
+
+// Matches reports whether a series with the given name and labels is selected. Missing labels
+// match as the empty string, as in PromQL
+func (a *MetricAssertion) Matches(name string, labels map[string]string) bool {
+	if name != a.Metric {
+		return false
+	}
+	for _, m := range a.Matchers {
+		value := labels[m.Name]
+		var ok bool
+		switch m.Op {
+		case "=":
+			ok = value == m.Value
+		case "!=":
+			ok = value != m.Value
+		case "=~":
+			ok = m.re.MatchString(value)
+		case "!~":
+			ok = !m.re.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Holds reports whether value satisfies a comparison assertion. NaN never does
+func (a *MetricAssertion) Holds(value float64) bool {
+	if math.IsNaN(value) {
+		return false
+	}
+	switch a.Op {
+	case "<":
+		return value < a.Value
+	case "<=":
+		return value <= a.Value
+	case ">":
+		return value > a.Value
+	case ">=":
+		return value >= a.Value
+	case "==":
+		return value == a.Value
+	case "!=":
+		return value != a.Value
+	}
+	return false
+}
+
+func (a *MetricAssertion) String() string {
+	var b strings.Builder
+	b.WriteString(a.Metric)
+	if len(a.Matchers) > 0 {
+		b.WriteString("{")
+		for i, m := range a.Matchers {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "%s%s%q", m.Name, m.Op, m.Value)
+		}
+		b.WriteString("}")
+	}
+	if a.Op == "exists" || a.Op == "absent" {
+		return b.String() + " " + a.Op
+	}
+	return fmt.Sprintf("%s %s %s", b.String(), a.Op, strconv.FormatFloat(a.Value, 'g', -1, 64))
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrInvalidSecurityGrade = errors.New("security grade must be one of A+, A, B, C, D or F")
+
+// SecurityGrades from best to worst, with the lowest score that earns each
+var SecurityGrades = []struct {
+	Grade    string
+	MinScore int
+}{
+	{"A+", 95},
+	{"A", 85},
+	{"B", 70},
+	{"C", 55},
+	{"D", 40},
+	{"F", 0},
+}
+
+// SecurityGradeRank orders grades, lower is better. Unknown grades rank below F
+func SecurityGradeRank(grade string) int {
+	for i, g := range SecurityGrades {
+		if g.Grade == grade {
+			return i
+		}
+	}
+	return len(SecurityGrades)
+}
+
+// SecurityHeaderFinding is one problem found by an HTTP check's security header audit
+type SecurityHeaderFinding struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	StatusID   string    `gorm:"index" json:"status_id"` // the Status row of the audited response
+	EndpointID string    `gorm:"index" json:"endpoint_id"`
+	Header     string    `json:"header"`   // e.g. Strict-Transport-Security, Set-Cookie
+	Severity   string    `json:"severity"` // error, warning or info
+	Message    string    `json:"message"`
+	Value      string    `json:"value,omitempty"` // the header as served, when there is one
+	Penalty    int       `json:"penalty"`         // points taken off the score of 100
+	CheckedAt  time.Time `json:"checked_at"`
+}
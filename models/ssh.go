@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrInvalidSSHKey = errors.New("ssh key requires a valid private key, and its passphrase when encrypted")
+
+var ErrInvalidSSHHostKey = errors.New("ssh host key fingerprint must be SHA256:<base64> or an MD5 hex fingerprint")
+
+var ErrInvalidSSHHostKeyAlgorithm = errors.New("ssh host key algorithm must be ssh-ed25519, ecdsa-sha2-nistp256/384/521, rsa-sha2-256, rsa-sha2-512 or ssh-rsa")
+
+var ErrInvalidSSHAuth = errors.New("ssh authentication needs both ssh_username and ssh_key_id")
+
+// SSHHostKeyAlgorithms are the host key algorithms an ssh check can be restricted to
+var SSHHostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA,
+}
+
+var (
+	sha256FingerprintPattern = regexp.MustCompile(`^SHA256:[A-Za-z0-9+/]{43}$`)
+	md5FingerprintPattern    = regexp.MustCompile(`^([0-9a-f]{2}:){15}[0-9a-f]{2}$`)
+)
+
+// NormalizeHostKeyFingerprint returns a pinned host key fingerprint in the form ssh-keygen prints:
+// SHA256 without base64 padding, or lowercase MD5 hex without its prefix
+func NormalizeHostKeyFingerprint(fingerprint string) (string, error) {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = strings.TrimRight(fingerprint, "=")
+		if !sha256FingerprintPattern.MatchString(fingerprint) {
+			return "", ErrInvalidSSHHostKey
+		}
+		return fingerprint, nil
+	}
+	fingerprint = strings.ToLower(strings.TrimPrefix(fingerprint, "MD5:"))
+	if !md5FingerprintPattern.MatchString(fingerprint) {
+		return "", ErrInvalidSSHHostKey
+	}
+	return fingerprint, nil
+}
+
+// SSHKey is a stored private key ssh checks authenticate with
+type SSHKey struct {
+	ID            string    `gorm:"primaryKey" json:"id"`
+	Name          string    `json:"name"`
+	PrivateKeyPEM string    `gorm:"not null" json:"-"` // OpenSSH or PKCS#8 PEM, stored unencrypted
+	KeyType       string    `json:"key_type"`          // e.g. ssh-ed25519
+	PublicKey     string    `json:"public_key"`        // authorized_keys line to install on servers
+	Fingerprint   string    `json:"fingerprint"`       // SHA256 fingerprint of the public key
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewSSHKey validates a PEM private key and records its public half. Encrypted keys are decrypted
+// with passphrase so checks don't need it
+func NewSSHKey(name string, keyPEM []byte, passphrase string) (SSHKey, error) {
+	var raw interface{}
+	var err error
+	if passphrase != "" {
+		raw, err = ssh.ParseRawPrivateKeyWithPassphrase(keyPEM, []byte(passphrase))
+	} else {
+		raw, err = ssh.ParseRawPrivateKey(keyPEM)
+	}
+	if err != nil {
+		return SSHKey{}, ErrInvalidSSHKey
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return SSHKey{}, ErrInvalidSSHKey
+	}
+	if passphrase != "" {
+		block, err := ssh.MarshalPrivateKey(raw, name)
+		if err != nil {
+			return SSHKey{}, ErrInvalidSSHKey
+		}
+		keyPEM = pem.EncodeToMemory(block)
+	}
+
+	pub := signer.PublicKey()
+	return SSHKey{
+		ID:            uuid.New().String(),
+		Name:          name,
+		PrivateKeyPEM: string(keyPEM),
+		KeyType:       pub.Type(),
+		PublicKey:     strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+		Fingerprint:   ssh.FingerprintSHA256(pub),
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// Signer returns the key in the form used by ssh.PublicKeys
+func (k SSHKey) Signer() (ssh.Signer, error) {
+	return ssh.ParsePrivateKey([]byte(k.PrivateKeyPEM))
+}
@@ -14,6 +14,15 @@ type SSLStatus struct {
 	Subject              string    `json:"subject"`
 	TLSVersion           string    `json:"tls_version"`
 	SerialNumber         string    `json:"serial_number"`
-	ErrorMessage         string    `json:"error_message"`
-	CheckedAt            time.Time `json:"checked_at"`
+	// Client certificate presented for mutual TLS, if any
+	ClientCertificateExpiresAt       *time.Time `json:"client_certificate_expires_at,omitempty"`
+	ClientCertificateDaysUntilExpiry *int       `json:"client_certificate_days_until_expiry,omitempty"`
+	RemoteIP                         string     `json:"remote_ip,omitempty"`
+	AddressFamily                    string     `json:"address_family,omitempty"`
+	ErrorMessage                     string     `json:"error_message"`
+	Attempts                         int        `gorm:"default:1" json:"attempts"`       // runs the result took, more than 1 when failures were retried
+	ProbeID                          string     `gorm:"index" json:"probe_id,omitempty"` // probe that checked, empty for the central worker
+	Location                         string     `gorm:"index" json:"location,omitempty"` // the probe's location
+	Outcome                          string     `gorm:"index" json:"outcome,omitempty"`  // OutcomeUnknown, or empty when the result counts
+	CheckedAt                        time.Time  `json:"checked_at"`
 }
@@ -1,6 +1,14 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutcomeUnknown marks a result taken while the checker's own network was down, its canaries
+// unreachable. It says nothing about the endpoint, so it counts neither as up nor as down
+const OutcomeUnknown = "unknown"
 
 type Status struct {
 	ID            string    `gorm:"primaryKey" json:"id"`
@@ -8,5 +16,23 @@ type Status struct {
 	Code          int       `json:"code"`
 	ResponseTime  int       `json:"response_time"`  // milliseconds
 	ErrorMessage  string    `json:"error_message"`
+	RemoteIP      string    `json:"remote_ip,omitempty"`      // address actually connected to, the proxy's when proxied
+	AddressFamily string    `json:"address_family,omitempty"` // ipv4 or ipv6
+	Output        string    `json:"output,omitempty"`         // plugin output of exec checks
+	SecurityGrade string    `json:"security_grade,omitempty"` // security header grade of HTTP checks that audit them
+	SSHBanner     string    `json:"ssh_banner,omitempty"`     // server version line of ssh checks
+	SSHHostKey    string    `json:"ssh_host_key,omitempty"`   // host key type and SHA256 fingerprint of ssh checks
+	// ExpectedFailure is what kept an expect_failure endpoint unreachable when its check passed
+	ExpectedFailure string  `json:"expected_failure,omitempty"`
+	Attempts      int       `gorm:"default:1" json:"attempts"` // runs the result took, more than 1 when failures were retried
+	ProbeID       string    `gorm:"index" json:"probe_id,omitempty"` // probe that checked, empty for the central worker
+	Location      string    `gorm:"index" json:"location,omitempty"` // the probe's location
+	Outcome       string    `gorm:"index" json:"outcome,omitempty"` // OutcomeUnknown, or empty when the result counts
 	CheckedAt     time.Time `json:"checked_at"`
 }
+
+// KnownResults leaves out the results whose outcome is unknown, rows from before outcomes were
+// recorded have none
+func KnownResults(db *gorm.DB) *gorm.DB {
+	return db.Where("outcome IS NULL OR outcome <> ?", OutcomeUnknown)
+}
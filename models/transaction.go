@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"time"
+)
+
+var ErrInvalidTransaction = errors.New("transaction requires at least one step with valid extractions and assertions")
+
+// TransactionVariablePattern matches a {{name}} placeholder for an extracted variable
+var TransactionVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// transactionVariableName is what an extraction can be named so placeholders can refer to it
+var transactionVariableName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Sources a transaction step can extract or assert values from
+const (
+	SourceJSON   = "json"   // JSONPath into the response body, e.g. $.data.token
+	SourceRegex  = "regex"  // regular expression on the body, first capture group wins
+	SourceHeader = "header" // response header name
+	SourceCookie = "cookie" // cookie name set by the response
+)
+
+// TransactionSelector picks a value out of a step's response
+type TransactionSelector struct {
+	Source string `json:"source"` // "json", "regex", "header", "cookie"
+	Path   string `json:"path"`   // JSONPath, expression, header or cookie name
+}
+
+// TransactionExtraction stores a selected value as a variable usable as {{name}} in later steps
+type TransactionExtraction struct {
+	TransactionSelector
+	Name string `json:"name"`
+}
+
+// TransactionAssertion requires a selected value to exist, and to equal Equals when set
+type TransactionAssertion struct {
+	TransactionSelector
+	Equals string `json:"equals,omitempty"`
+}
+
+type TransactionStep struct {
+	Name                string                  `json:"name"`
+	Method              string                  `json:"method"` // default GET
+	URL                 string                  `json:"url"`    // relative URLs resolve against the endpoint URL
+	Headers             map[string]string       `json:"headers,omitempty"`
+	Body                string                  `json:"body,omitempty"`
+	ExpectedStatusCodes []int                   `json:"expected_status_codes,omitempty"` // empty means 2xx/3xx
+	MaxResponseTime     int                     `json:"max_response_time,omitempty"`     // milliseconds, 0 uses the endpoint's
+	BodyContains        string                  `json:"body_contains,omitempty"`
+	Assertions          []TransactionAssertion  `json:"assertions,omitempty"`
+	Extract             []TransactionExtraction `json:"extract,omitempty"`
+}
+
+// TransactionSteps represents the ordered steps of a transaction stored as JSON in the database
+type TransactionSteps []TransactionStep
+
+func (s TransactionSteps) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *TransactionSteps) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// Validate checks that every step can be executed
+func (s TransactionSteps) Validate() error {
+	if len(s) == 0 {
+		return ErrInvalidTransaction
+	}
+	for _, step := range s {
+		for _, ex := range step.Extract {
+			if !transactionVariableName.MatchString(ex.Name) || !ex.valid() {
+				return ErrInvalidTransaction
+			}
+		}
+		for _, as := range step.Assertions {
+			if !as.valid() {
+				return ErrInvalidTransaction
+			}
+		}
+	}
+	return nil
+}
+
+// valid reports whether the selector has a known source and a path it can evaluate, regular
+// expressions have to compile
+func (s TransactionSelector) valid() bool {
+	if s.Path == "" {
+		return false
+	}
+	switch s.Source {
+	case SourceRegex:
+		_, err := regexp.Compile(s.Path)
+		return err == nil
+	case SourceJSON, SourceHeader, SourceCookie:
+		return true
+	}
+	return false
+}
+
+// TransactionStepResult records the outcome of one step of a transaction check
+type TransactionStepResult struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	StatusID     string    `gorm:"index" json:"status_id"` // the Status row of the whole transaction
+	EndpointID   string    `gorm:"index" json:"endpoint_id"`
+	StepIndex    int       `json:"step_index"`
+	Name         string    `json:"name"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	Code         int       `json:"code"`
+	ResponseTime int       `json:"response_time"` // milliseconds
+	ErrorMessage string    `json:"error_message"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
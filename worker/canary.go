@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// canaryTTL is how long the canaries' verdict is reused before failing checks probe them again
+const canaryTTL = 10 * time.Second
+
+// canaryInterval is how often the canaries are probed while checks pass, keeping their health known
+const canaryInterval = time.Minute
+
+// canaryTimeout bounds the connection to a canary
+const canaryTimeout = 5 * time.Second
+
+// dialCanary connects to a canary, replaced in tests
+var dialCanary = (&net.Dialer{}).DialContext
+
+// CanaryStats describes the checker's own network as its canaries last saw it
+type CanaryStats struct {
+	Healthy   bool           `json:"healthy"`    // at least one canary was reachable
+	CheckedAt time.Time      `json:"checked_at"` // zero until they were first probed
+	Canaries  []CanaryResult `json:"canaries"`
+}
+
+// CanaryResult is a canary's last connection attempt
+type CanaryResult struct {
+	Target       string `json:"target"`
+	Reachable    bool   `json:"reachable"`
+	ResponseTime int    `json:"response_time"` // milliseconds
+	Error        string `json:"error,omitempty"`
+}
+
+// canary tells a failing endpoint from a checker that lost its network. The targets are well-known
+// hosts that are practically always up: when none of them can be reached either, a failed check
+// says nothing about its endpoint. They are probed when a check fails, unless they were within
+// canaryTTL, and every canaryInterval
+type canary struct {
+	targets []string // host:port, connected to over TCP
+
+	mu      sync.Mutex
+	last    CanaryStats
+	probing chan struct{} // closed when the probe in progress stored its verdict, nil when none is
+}
+
+func newCanary(targets []string) *canary {
+	return &canary{targets: targets, last: CanaryStats{Healthy: true}}
+}
+
+// newCanaryFromEnv returns the canaries CANARY_TARGETS lists, comma separated, nil when it's unset
+func newCanaryFromEnv() *canary {
+	var targets []string
+	for _, target := range strings.Split(os.Getenv("CANARY_TARGETS"), ",") {
+		if target = strings.TrimSpace(target); target == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			log.Printf("ignoring invalid canary target %q, expected host:port", target)
+			continue
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	log.Printf("Canaries: %s", strings.Join(targets, ", "))
+	return newCanary(targets)
+}
+
+// healthy reports whether the checker's network works, probing the canaries unless they were
+// probed within canaryTTL. Concurrent callers wait for one probe. The lock is only held to read and
+// store the verdict, so Stats answers while the canaries are dialled
+func (c *canary) healthy(ctx context.Context) bool {
+	c.mu.Lock()
+	if !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < canaryTTL {
+		defer c.mu.Unlock()
+		return c.last.Healthy
+	}
+	if probing := c.probing; probing != nil {
+		c.mu.Unlock()
+		select {
+		case <-probing:
+		case <-ctx.Done():
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.last.Healthy
+	}
+	probing := make(chan struct{})
+	c.probing = probing
+	targets := append([]string(nil), c.targets...)
+	c.mu.Unlock()
+
+	results := make([]CanaryResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probeCanary(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probing = nil
+	close(probing) // the waiters read the verdict once it's stored and the lock released
+	if ctx.Err() != nil {
+		// A cancelled probe says nothing about the network
+		return c.last.Healthy
+	}
+
+	healthy := false
+	for _, result := range results {
+		healthy = healthy || result.Reachable
+	}
+	if healthy != c.last.Healthy {
+		if healthy {
+			log.Printf("Canaries reachable again, failed checks count again")
+		} else {
+			log.Printf("No canary reachable, failed checks are recorded as unknown")
+		}
+	}
+	c.last = CanaryStats{Healthy: healthy, CheckedAt: time.Now(), Canaries: results}
+	return healthy
+}
+
+func probeCanary(ctx context.Context, target string) CanaryResult {
+	ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialCanary(ctx, "tcp", target)
+	result := CanaryResult{Target: target, ResponseTime: int(time.Since(start).Milliseconds())}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Reachable = true
+	return result
+}
+
+// Stats returns the canaries' last verdict
+func (c *canary) Stats() CanaryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.last
+	stats.Canaries = append([]CanaryResult(nil), c.last.Canaries...)
+	return stats
+}
+
+// canaryLoop probes the canaries when the worker starts and every canaryInterval until it stops
+func (w *Worker) canaryLoop() {
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(canaryInterval)
+	defer ticker.Stop()
+	for {
+		w.canary.healthy(ctx)
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// markUnknown records a result whose check ran while the canaries were unreachable as unknown.
+// Failures are, and so are the passes of endpoints expected to be unreachable. Domain results are
+// left as they are: the domain check doesn't go over the network, its registration data is
+// simulated, so an outage can't fail it
+func (w *Worker) markUnknown(ctx context.Context, ep Endpoint, result *Result) {
+	if w.canary == nil || (result.Passed && !ep.ExpectFailure) || w.canary.healthy(ctx) {
+		return
+	}
+	switch {
+	case result.Status != nil:
+		result.Status.Outcome = models.OutcomeUnknown
+	case result.SSLStatus != nil:
+		result.SSLStatus.Outcome = models.OutcomeUnknown
+	}
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// closedAddr returns an address nothing listens on
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func openAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+func TestCanaryHealthy(t *testing.T) {
+	// One reachable canary is enough
+	c := newCanary([]string{closedAddr(t), openAddr(t)})
+	if !c.healthy(context.Background()) {
+		t.Fatalf("expected healthy with a reachable canary, got %+v", c.Stats())
+	}
+	if stats := c.Stats(); len(stats.Canaries) != 2 || stats.Canaries[0].Reachable || !stats.Canaries[1].Reachable {
+		t.Errorf("expected each canary's result, got %+v", stats.Canaries)
+	}
+
+	c = newCanary([]string{closedAddr(t), closedAddr(t)})
+	if c.healthy(context.Background()) {
+		t.Fatalf("expected unhealthy with no canary reachable")
+	}
+	// The verdict is reused, the canaries aren't probed for every failing check
+	checkedAt := c.Stats().CheckedAt
+	c.healthy(context.Background())
+	if !c.Stats().CheckedAt.Equal(checkedAt) {
+		t.Errorf("expected the verdict reused within %s", canaryTTL)
+	}
+}
+
+func TestCanaryProbeDoesNotBlockStats(t *testing.T) {
+	dialing, release := make(chan struct{}, 2), make(chan struct{})
+	var dials atomic.Int32
+	original := dialCanary
+	dialCanary = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials.Add(1)
+		dialing <- struct{}{}
+		<-release
+		return nil, errors.New("network is unreachable")
+	}
+	defer func() { dialCanary = original }()
+
+	c := newCanary([]string{"canary.test:443"})
+	verdicts := make(chan bool, 2)
+	go func() { verdicts <- c.healthy(context.Background()) }()
+	<-dialing
+	go func() { verdicts <- c.healthy(context.Background()) }()
+
+	stats := make(chan CanaryStats, 1)
+	go func() { stats <- c.Stats() }()
+	select {
+	case got := <-stats:
+		if !got.Healthy || !got.CheckedAt.IsZero() {
+			t.Errorf("expected the verdict before the probe, got %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stats waited for the canaries to be dialled")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if <-verdicts {
+			t.Errorf("expected both callers to get the probe's unhealthy verdict")
+		}
+	}
+	if got := dials.Load(); got != 1 {
+		t.Errorf("expected concurrent callers to share one probe, got %d dials", got)
+	}
+}
+
+func TestFailureRecordedUnknownWhileCanariesFail(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, _ := flakyServer(t, 10)
+	stored := models.Endpoint{ID: uuid.New().String(), URL: srv.URL, CheckType: "http", Interval: 60}
+	if err := models.DB.Create(&stored).Error; err != nil {
+		t.Fatalf("failed to save endpoint: %v", err)
+	}
+	ep := EndpointFromModel(stored)
+	ep.Timeout, ep.MaxResponseTime = time.Second, time.Second
+
+	w := NewWorker(time.Hour)
+	w.canary = newCanary([]string{closedAddr(t)})
+	w.runCheck(context.Background(), ep)
+
+	statuses := statusesOf(t, ep.ID)
+	if len(statuses) != 1 || statuses[0].Code != 503 || statuses[0].Outcome != models.OutcomeUnknown {
+		t.Fatalf("expected the failure recorded as unknown, got %+v", statuses)
+	}
+	var incidents int64
+	models.DB.Model(&models.Incident{}).Where("endpoint_id = ?", ep.ID).Count(&incidents)
+	if incidents != 0 {
+		t.Errorf("expected no incident opened by an unknown result, got %d", incidents)
+	}
+
+	// With its network back, the worker's failures count again
+	w.canary = newCanary([]string{openAddr(t)})
+	w.runCheck(context.Background(), ep)
+	var failure models.Status
+	models.DB.Where("endpoint_id = ?", ep.ID).Order("checked_at desc").First(&failure)
+	if failure.Outcome != "" {
+		t.Errorf("expected a failure recorded with reachable canaries, got outcome %q", failure.Outcome)
+	}
+	models.DB.Model(&models.Incident{}).Where("endpoint_id = ?", ep.ID).Count(&incidents)
+	if incidents != 1 {
+		t.Errorf("expected the failure to open an incident, got %d", incidents)
+	}
+}
+
+func TestPassRecordedWithoutProbingCanaries(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, _ := flakyServer(t, 0)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: time.Second, MaxResponseTime: time.Second}
+
+	w := NewWorker(time.Hour)
+	w.canary = newCanary([]string{closedAddr(t)})
+	w.runCheck(context.Background(), ep)
+
+	if statuses := statusesOf(t, ep.ID); len(statuses) != 1 || statuses[0].Outcome != "" {
+		t.Fatalf("expected a pass recorded as is, got %+v", statuses)
+	}
+	if !w.canary.Stats().CheckedAt.IsZero() {
+		t.Errorf("expected the canaries not probed for a passing check")
+	}
+}
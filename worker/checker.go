@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/monty/models"
+	"gorm.io/gorm"
+)
+
+// Checker is a check type. Besides its configuration (models.CheckConfig) it runs checks: Check
+// probes the endpoint once, over a single address family, and returns what it found without
+// saving anything. Adding a protocol means implementing Checker and passing it to RegisterChecker
+// from an init function
+type Checker interface {
+	models.CheckConfig
+	Check(ctx context.Context, w *Worker, ep Endpoint) Result
+}
+
+// Result is what one check run found. The worker records the run's status, Status or, for ssl and
+// domain checks, SSLStatus or DomainStatus, and then Details, rows that refer to the status by ID
+type Result struct {
+	Passed       bool
+	Status       *models.Status
+	SSLStatus    *models.SSLStatus
+	DomainStatus *models.DomainStatus
+	Details      []any // pointers to rows, created in order
+}
+
+// checkers is filled while the package initializes and only read afterwards
+var checkers = make(map[string]Checker)
+
+// RegisterChecker makes a check type available to endpoints and the worker
+func RegisterChecker(c Checker) {
+	models.RegisterCheckConfig(c)
+	checkers[c.Name()] = c
+}
+
+// LookupChecker returns the check type called name
+func LookupChecker(name string) (Checker, bool) {
+	c, ok := checkers[name]
+	return c, ok
+}
+
+// Checkers returns the registered check types sorted by name
+func Checkers() []Checker {
+	list := make([]Checker, 0, len(checkers))
+	for _, c := range checkers {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// commonSettings are the settings every check type uses
+var commonSettings = map[string]any{
+	"url":        stringSetting("what to check, its form depends on the check type"),
+	"check_type": stringSetting("the check type"),
+	"interval":   intSetting("seconds between checks", 1),
+	"timeout":    intSetting("seconds a check may take, default 30", 1),
+}
+
+// Schema returns the JSON schema of an endpoint of the check type
+func Schema(c Checker) map[string]any {
+	properties := make(map[string]any, len(commonSettings))
+	for name, setting := range commonSettings {
+		properties[name] = setting
+	}
+	for name, setting := range c.Settings() {
+		properties[name] = setting
+	}
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       c.Name(),
+		"description": c.Description(),
+		"type":        "object",
+		"required":    []string{"url", "interval"},
+		"properties":  properties,
+	}
+}
+
+// checkedByFamily reports whether a check type runs once per address family when an endpoint asks
+// for both, which is the case for the types that take an address_family
+func checkedByFamily(c Checker) bool {
+	_, ok := c.Settings()["address_family"]
+	return ok
+}
+
+// record saves a check's result as the given attempt, or hands it to the worker's remote
+func (w *Worker) record(ep Endpoint, result Result, attempts int) {
+	var status any
+	switch {
+	case result.Status != nil:
+		result.Status.Attempts = attempts
+		status = result.Status
+	case result.SSLStatus != nil:
+		result.SSLStatus.Attempts = attempts
+		status = result.SSLStatus
+	case result.DomainStatus != nil:
+		status = result.DomainStatus
+	default:
+		return
+	}
+	if w.remote != nil {
+		w.remote.Record(ep, result)
+		return
+	}
+
+	if err := models.DB.Create(status).Error; err != nil {
+		log.Printf("failed to save status for %s: %v", ep.URL, err)
+		return
+	}
+	for _, detail := range result.Details {
+		if err := models.DB.Create(detail).Error; err != nil {
+			log.Printf("failed to save %T for %s: %v", detail, ep.URL, err)
+		}
+	}
+	if result.Status != nil {
+		updateIncident(ep.ID)
+	}
+}
+
+// updateIncident re-evaluates whether a quorum of the endpoint's probes sees it down
+func updateIncident(endpointID string) {
+	err := models.UpdateIncident(models.DB, endpointID, time.Now())
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("failed to update incidents of endpoint %s: %v", endpointID, err)
+	}
+}
+
+// ProbeResult converts a check's result for reporting by a probe. Domain statuses aren't reported,
+// probes don't run domain checks
+func ProbeResult(ep Endpoint, result Result) (models.ProbeResult, error) {
+	report := models.ProbeResult{EndpointID: ep.ID, Status: result.Status, SSLStatus: result.SSLStatus}
+	if report.Status == nil && report.SSLStatus == nil {
+		return report, errors.New("result has no status a probe reports")
+	}
+	for _, row := range result.Details {
+		detail, err := models.NewProbeDetail(row)
+		if err != nil {
+			return report, err
+		}
+		report.Details = append(report.Details, detail)
+	}
+	return report, nil
+}
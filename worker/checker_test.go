@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+var errBadGreeting = errors.New("greeting must be hello")
+
+// greeting is a check type registered by the tests, once since tests may run more than once per process
+func init() {
+	RegisterChecker(&checkType{
+		name:        "greeting",
+		description: "Test check type",
+		settings:    settings(retrySettings, map[string]any{"greeting": stringSetting("what to say")}),
+		validate: func(e *models.Endpoint) error {
+			if e.URL != "hello" {
+				return errBadGreeting
+			}
+			return nil
+		},
+		check: func(w *Worker, ctx context.Context, ep Endpoint) Result {
+			status := models.Status{ID: uuid.New().String(), EndpointID: ep.ID, Code: 42}
+			return Result{Passed: true, Status: &status}
+		},
+	})
+}
+
+func TestRunCheckRecordsRegisteredCheckerResult(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	// A check type added outside the built-in ones saves, runs and records like them
+	if err := db.Create(&models.Endpoint{ID: uuid.New().String(), URL: "hello", CheckType: "greeting", Interval: 60}).Error; err != nil {
+		t.Fatalf("expected endpoint of a registered type to save: %v", err)
+	}
+	if err := db.Create(&models.Endpoint{ID: uuid.New().String(), URL: "bye", CheckType: "greeting", Interval: 60}).Error; !errors.Is(err, errBadGreeting) {
+		t.Fatalf("expected the type's validation to run, got %v", err)
+	}
+	if err := db.Create(&models.Endpoint{ID: uuid.New().String(), URL: "hello", CheckType: "greeting", Interval: 60, ExpectFailure: true}).Error; !errors.Is(err, models.ErrInvalidExpectFailure) {
+		t.Fatalf("expected expect_failure to be refused by a type without it, got %v", err)
+	}
+
+	ep := Endpoint{ID: uuid.New().String(), URL: "hello", CheckType: "greeting"}
+	(&Worker{}).runCheck(context.Background(), ep)
+	if status := latestStatus(t, ep.ID); status.Code != 42 || status.Attempts != 1 {
+		t.Errorf("expected the checker's status recorded as attempt 1, got code %d attempt %d", status.Code, status.Attempts)
+	}
+}
+
+func TestRecordUpdatesIncidents(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	// Checked by the central worker alone, its own failure is a majority
+	model := models.Endpoint{ID: uuid.New().String(), URL: "http://example.com", CheckType: "http", Interval: 60}
+	if err := db.Create(&model).Error; err != nil {
+		t.Fatalf("failed to save endpoint: %v", err)
+	}
+	ep := EndpointFromModel(model)
+	w := &Worker{}
+	record := func(code int) {
+		status := models.Status{ID: uuid.New().String(), EndpointID: ep.ID, Code: code, CheckedAt: time.Now()}
+		w.record(ep, Result{Status: &status}, 1)
+	}
+	incidents := func() []models.Incident {
+		var incidents []models.Incident
+		db.Where("endpoint_id = ?", ep.ID).Find(&incidents)
+		return incidents
+	}
+
+	record(500)
+	if got := incidents(); len(got) != 1 || got[0].ResolvedAt != nil || len(got[0].Votes) != 1 || got[0].Votes[0].Code != 500 {
+		t.Fatalf("expected an open incident with the failing result, got %+v", got)
+	}
+	record(200)
+	if got := incidents(); len(got) != 1 || got[0].ResolvedAt == nil {
+		t.Fatalf("expected the incident resolved, got %+v", got)
+	}
+}
+
+// fakeRemote is a probe agent's remote
+type fakeRemote struct {
+	endpoints []models.Endpoint
+	recorded  []Result
+}
+
+func (r *fakeRemote) Endpoints() ([]models.Endpoint, error) { return r.endpoints, nil }
+
+func (r *fakeRemote) Record(ep Endpoint, result Result) { r.recorded = append(r.recorded, result) }
+
+func TestRemoteWorkerReportsToRemote(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	remote := &fakeRemote{endpoints: []models.Endpoint{{ID: uuid.New().String(), URL: "hello", CheckType: "greeting", Interval: 60, ContentMode: models.ContentModeChange}}}
+	w := NewRemoteWorker(remote, time.Minute)
+
+	endpoints, err := w.endpoints()
+	if err != nil || len(endpoints) != 1 {
+		t.Fatalf("expected the remote's endpoint, got %v, %v", endpoints, err)
+	}
+	if endpoints[0].ContentMode != "" {
+		t.Errorf("expected content tracking, which needs the database, to be left to the central worker")
+	}
+
+	ep := EndpointFromModel(endpoints[0])
+	w.runCheck(context.Background(), ep)
+	if len(remote.recorded) != 1 || remote.recorded[0].Status.Code != 42 || remote.recorded[0].Status.Attempts != 1 {
+		t.Fatalf("expected the result handed to the remote, got %+v", remote.recorded)
+	}
+	var count int64
+	db.Model(&models.Status{}).Where("endpoint_id = ?", ep.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("expected nothing saved to the database, got %d statuses", count)
+	}
+
+	report, err := ProbeResult(ep, remote.recorded[0])
+	if err != nil || report.EndpointID != ep.ID || report.Status == nil {
+		t.Errorf("expected the result converted for reporting, got %+v, %v", report, err)
+	}
+}
+
+func TestCheckTypeDefaults(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	for _, tc := range []struct {
+		ep    models.Endpoint
+		check func(e models.Endpoint) bool
+	}{
+		{models.Endpoint{URL: "example.com", CheckType: "ssl", Interval: 60}, func(e models.Endpoint) bool {
+			return e.Interval == 86400 && e.MinDaysValid == 30 && len(e.AcceptableTLSVersions) == 2
+		}},
+		{models.Endpoint{URL: "example.com", CheckType: "dns_propagation", Interval: 60}, func(e models.Endpoint) bool {
+			return e.DNSRecordType == "A" && len(e.DNSResolvers) == 3
+		}},
+		{models.Endpoint{URL: "example.com", CheckType: "ntp", Interval: 60}, func(e models.Endpoint) bool {
+			return e.NTPMaxOffset == 100
+		}},
+		{models.Endpoint{URL: "backup", CheckType: "heartbeat", Interval: 60}, func(e models.Endpoint) bool {
+			return e.HeartbeatToken != "" && e.HeartbeatGrace == 60
+		}},
+	} {
+		tc.ep.ID = uuid.New().String()
+		if err := db.Create(&tc.ep).Error; err != nil {
+			t.Fatalf("%s: failed to save endpoint: %v", tc.ep.CheckType, err)
+		}
+		if !tc.check(tc.ep) {
+			t.Errorf("%s: defaults not applied: %+v", tc.ep.CheckType, tc.ep)
+		}
+	}
+
+	bad := models.Endpoint{ID: uuid.New().String(), URL: "backup", CheckType: "heartbeat", Interval: 60, HeartbeatSchedule: "every day"}
+	if err := db.Create(&bad).Error; !errors.Is(err, models.ErrInvalidSchedule) {
+		t.Errorf("expected invalid schedule error, got %v", err)
+	}
+}
+
+func TestHTTPCheckerPassed(t *testing.T) {
+	ep := &models.Endpoint{MaxResponseTime: 1000}
+	for _, tc := range []struct {
+		status models.Status
+		want   bool
+	}{
+		{models.Status{Code: 200, ResponseTime: 100}, true},
+		{models.Status{Code: 500, ResponseTime: 100}, false},
+		{models.Status{Code: 200, ResponseTime: 2000}, false},
+		{models.Status{ErrorMessage: "connection refused"}, false},
+	} {
+		if got := httpChecker.Passed(ep, &tc.status); got != tc.want {
+			t.Errorf("%+v: passed = %v, expected %v", tc.status, got, tc.want)
+		}
+	}
+
+	expectFailure := &models.Endpoint{ExpectFailure: true}
+	if !httpChecker.Passed(expectFailure, &models.Status{ExpectedFailure: "connection refused"}) {
+		t.Error("expected an expect_failure check that stayed unreachable to pass")
+	}
+}
@@ -0,0 +1,348 @@
+package worker
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"github.com/robfig/cron/v3"
+)
+
+// checkType is a Checker assembled from functions, which is how the built-in types are defined.
+// Only name, description and check are required
+type checkType struct {
+	name        string
+	description string
+	settings    map[string]any
+	defaults    func(e *models.Endpoint)
+	validate    func(e *models.Endpoint) error
+	passed      func(e *models.Endpoint, s *models.Status) bool // nil passes statuses without an error
+	check       func(w *Worker, ctx context.Context, ep Endpoint) Result
+}
+
+func (c *checkType) Name() string             { return c.name }
+func (c *checkType) Description() string      { return c.description }
+func (c *checkType) Settings() map[string]any { return c.settings }
+
+func (c *checkType) ApplyDefaults(e *models.Endpoint) {
+	if c.defaults != nil {
+		c.defaults(e)
+	}
+}
+
+func (c *checkType) Validate(e *models.Endpoint) error {
+	if c.validate == nil {
+		return nil
+	}
+	return c.validate(e)
+}
+
+func (c *checkType) Passed(e *models.Endpoint, s *models.Status) bool {
+	if c.passed == nil {
+		return s.ErrorMessage == ""
+	}
+	return c.passed(e, s)
+}
+
+func (c *checkType) Check(ctx context.Context, w *Worker, ep Endpoint) Result {
+	return c.check(w, ctx, ep)
+}
+
+// Schema helpers, each returns the JSON schema of one setting
+func stringSetting(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func enumSetting(description string, values ...string) map[string]any {
+	return map[string]any{"type": "string", "description": description, "enum": values}
+}
+
+func intSetting(description string, minimum int) map[string]any {
+	return map[string]any{"type": "integer", "description": description, "minimum": minimum}
+}
+
+func boolSetting(description string) map[string]any {
+	return map[string]any{"type": "boolean", "description": description}
+}
+
+func stringListSetting(description string) map[string]any {
+	return map[string]any{"type": "array", "description": description, "items": map[string]any{"type": "string"}}
+}
+
+func intListSetting(description string) map[string]any {
+	return map[string]any{"type": "array", "description": description, "items": map[string]any{"type": "integer"}}
+}
+
+// settings merges groups of settings into one map
+func settings(groups ...map[string]any) map[string]any {
+	merged := make(map[string]any)
+	for _, group := range groups {
+		for name, setting := range group {
+			merged[name] = setting
+		}
+	}
+	return merged
+}
+
+// Settings shared by several check types
+var (
+	retrySettings = map[string]any{
+		"retries":        intSetting("re-run a failed check this many times before recording the failure, at most 10", 0),
+		"retry_interval": intSetting("seconds between retries, default 10", 1),
+	}
+	familySettings = map[string]any{
+		"address_family": enumSetting("addresses to connect over, both checks each family separately",
+			models.AddressFamilyAuto, models.AddressFamilyIPv4, models.AddressFamilyIPv6, models.AddressFamilyBoth),
+	}
+	expectFailureSettings = map[string]any{
+		"expect_failure": boolSetting("pass only while the target is unreachable"),
+	}
+	proxySettings = map[string]any{
+		"proxy_url": stringSetting("http://, https:// or socks5:// proxy to connect through, credentials as user:pass@"),
+	}
+	clientCertificateSettings = map[string]any{
+		"client_certificate_id": stringSetting("client certificate to present for mutual TLS"),
+	}
+	statusCodeSettings = map[string]any{
+		"expected_status_codes": intListSetting("passing status codes, 2xx and 3xx when empty"),
+		"max_response_time":     intSetting("milliseconds, default 5000", 1),
+	}
+	probeSettings = map[string]any{
+		"probe_locations": stringListSetting("locations of the remote probes checking the endpoint besides the central worker, * for all"),
+	}
+	quorumSettings = map[string]any{
+		"quorum":        intSetting("failing probes, the central worker included, that open an incident, a majority of those reporting when 0", 0),
+		"quorum_window": intSetting("seconds a probe's latest result counts towards the quorum, default twice the interval", 0),
+	}
+	resolverSettings = map[string]any{
+		"dns_resolvers": stringListSetting("resolver IPs, optionally ip:port, the system resolver when empty"),
+	}
+)
+
+// httpChecker checks endpoints whose type isn't registered, which were always checked over HTTP
+var httpChecker = &checkType{
+	name:        "http",
+	description: "Request the URL and check the status code and response time",
+	settings: settings(statusCodeSettings, clientCertificateSettings, proxySettings, familySettings,
+		expectFailureSettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"content_mode":          enumSetting("watch the content for changes, or for staying the same too long", "", models.ContentModeChange, models.ContentModeStale),
+			"content_selector_type": enumSetting("how content_selector picks the watched content", "", models.ContentSelectorCSS, models.ContentSelectorRegex, models.ContentSelectorJSON),
+			"content_selector":      stringSetting("CSS selector, regular expression or JSONPath"),
+			"content_stale_after":   intSetting("seconds, stale mode only, default 86400", 1),
+			"security_headers":      boolSetting("grade the response's security headers"),
+			"min_security_grade":    enumSetting("fail below this security header grade", "A+", "A", "B", "C", "D", "F"),
+		}),
+	passed: func(e *models.Endpoint, s *models.Status) bool {
+		if e.ExpectFailure || s.ErrorMessage != "" {
+			return s.ErrorMessage == "" // an expect_failure check passed when the target stayed unreachable
+		}
+		expectedCodes := []int(e.ExpectedStatusCodes)
+		if len(expectedCodes) == 0 {
+			expectedCodes = defaultExpectedStatusCodes
+		}
+		return slices.Contains(expectedCodes, s.Code) && s.ResponseTime <= e.MaxResponseTime
+	},
+	check: (*Worker).CheckHTTPEndpoint,
+}
+
+func init() {
+	RegisterChecker(httpChecker)
+	RegisterChecker(&checkType{
+		name:        "ssl",
+		description: "Check the TLS certificate's expiry, chain, host name and protocol version",
+		settings: settings(clientCertificateSettings, proxySettings, familySettings, retrySettings, probeSettings, map[string]any{
+			"min_days_valid":          intSetting("days the certificate has to stay valid, default 30", 1),
+			"check_chain":             boolSetting("verify the certificate chain, default true"),
+			"check_domain_match":      boolSetting("verify the certificate matches the host, default true"),
+			"acceptable_tls_versions": stringListSetting(`e.g. ["TLS 1.2", "TLS 1.3"], the default`),
+		}),
+		defaults: func(e *models.Endpoint) {
+			if e.Interval == 60 { // if default interval, set to 24h for SSL
+				e.Interval = 86400
+			}
+			if e.MinDaysValid <= 0 {
+				e.MinDaysValid = 30
+			}
+			if len(e.AcceptableTLSVersions) == 0 {
+				e.AcceptableTLSVersions = []string{"TLS 1.2", "TLS 1.3"}
+			}
+		},
+		check: (*Worker).CheckSSLEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "dns",
+		description: "Resolve a record and check the number of answers, optionally validating DNSSEC",
+		settings: settings(resolverSettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"dns_record_type":       stringSetting("A, AAAA, CNAME, MX, TXT, etc., default A"),
+			"expected_dns_answers":  intListSetting("minimum number of answers, default [1]"),
+			"dnssec":                boolSetting("validate the chain of trust, through the first of dns_resolvers"),
+			"dnssec_trust_anchor":   stringSetting("DS or DNSKEY records, the root KSKs when empty"),
+			"dnssec_min_days_valid": intSetting("days signatures have to stay valid, default 3", 1),
+		}),
+		defaults: func(e *models.Endpoint) {
+			if e.DNSRecordType == "" {
+				e.DNSRecordType = "A"
+			}
+			if len(e.ExpectedDNSAnswers) == 0 {
+				e.ExpectedDNSAnswers = []int{1} // expect at least 1 answer
+			}
+			if e.DNSSEC && e.DNSSECMinDaysValid <= 0 {
+				e.DNSSECMinDaysValid = 3
+			}
+		},
+		validate: func(e *models.Endpoint) error {
+			if e.DNSSEC && e.DNSSECTrustAnchor != "" {
+				if _, err := models.ParseTrustAnchor(e.DNSSECTrustAnchor); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		passed: func(e *models.Endpoint, s *models.Status) bool {
+			if e.DNSSEC || len(e.ExpectedDNSAnswers) == 0 {
+				return s.ErrorMessage == ""
+			}
+			return s.ErrorMessage == "" && s.Code >= e.ExpectedDNSAnswers[0] // Code is the answer count
+		},
+		check: (*Worker).CheckDNSEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "dns_propagation",
+		description: "Compare a record's answers across resolvers and, optionally, the zone's nameservers",
+		settings: settings(resolverSettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"dns_record_type":         stringSetting("A, AAAA, CNAME, MX, TXT, etc., default A"),
+			"dns_check_authoritative": boolSetting("also query the zone's authoritative nameservers"),
+		}),
+		defaults: func(e *models.Endpoint) {
+			if e.DNSRecordType == "" {
+				e.DNSRecordType = "A"
+			}
+			// Compare the big public resolvers unless told otherwise
+			if len(e.DNSResolvers) == 0 && !e.DNSCheckAuthoritative {
+				e.DNSResolvers = models.StringArray{"8.8.8.8", "1.1.1.1", "9.9.9.9"}
+			}
+		},
+		check: (*Worker).CheckDNSPropagationEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "email_auth",
+		description: "Audit a domain's SPF, DKIM, DMARC, MTA-STS and TLS-RPT records",
+		settings: settings(resolverSettings, proxySettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"dkim_selectors": stringListSetting("DKIM selectors to audit"),
+		}),
+		check: (*Worker).CheckEmailAuthEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "exec",
+		description: "Run a Nagios-compatible plugin, the URL is the command",
+		settings: settings(retrySettings, probeSettings, quorumSettings, map[string]any{
+			"exec_args": stringListSetting("arguments passed to the command"),
+			"exec_env":  stringListSetting("KEY=value entries added to the command's environment"),
+		}),
+		validate: func(e *models.Endpoint) error {
+			return ExecCommandAllowed(e.URL)
+		},
+		check: (*Worker).CheckExecEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "prometheus",
+		description: "Scrape a metrics page and evaluate assertions on its samples",
+		settings: settings(clientCertificateSettings, proxySettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"metric_assertions": stringListSetting(`e.g. queue_depth{queue="emails"} < 1000, up exists`),
+		}),
+		check: (*Worker).CheckPrometheusEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "domain",
+		description: "Check the domain's registration and expiry",
+		settings:    map[string]any{},
+		defaults: func(e *models.Endpoint) {
+			if e.Interval == 60 { // if default interval, set to 24h for domain
+				e.Interval = 86400
+			}
+		},
+		check: (*Worker).CheckDomainEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "ping",
+		description: "Check the host is reachable",
+		settings:    settings(proxySettings, familySettings, expectFailureSettings, retrySettings, probeSettings, quorumSettings),
+		check:       (*Worker).CheckPingEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "tcp",
+		description: "Connect to a TCP port",
+		settings: settings(proxySettings, familySettings, expectFailureSettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"tcp_port": intSetting("port to connect to, default 80", 1),
+		}),
+		defaults: func(e *models.Endpoint) {
+			if e.TCPPort <= 0 {
+				e.TCPPort = 80 // default to HTTP port
+			}
+		},
+		check: (*Worker).CheckTCPEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "ssh",
+		description: "Run the SSH handshake, optionally pinning the host key and authenticating",
+		settings: settings(proxySettings, familySettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"ssh_host_key_fingerprint": stringSetting("pinned host key, SHA256:... as printed by ssh-keygen -l"),
+			"ssh_host_key_algorithm":   enumSetting("negotiate only this host key type", models.SSHHostKeyAlgorithms...),
+			"ssh_username":             stringSetting("authenticate as this user, with ssh_key_id"),
+			"ssh_key_id":               stringSetting("stored SSH key to authenticate with"),
+		}),
+		check: (*Worker).CheckSSHEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "ntp",
+		description: "Query an NTP server and check it's synchronized with a small clock offset",
+		settings: settings(familySettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"ntp_max_offset": intSetting("milliseconds the server's clock may be off, default 100", 1),
+		}),
+		defaults: func(e *models.Endpoint) {
+			if e.NTPMaxOffset <= 0 {
+				e.NTPMaxOffset = 100
+			}
+		},
+		check: (*Worker).CheckNTPEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "heartbeat",
+		description: "Expect pings to /api/ping/:token on schedule, from cron jobs and the like",
+		settings: map[string]any{
+			"heartbeat_schedule":    stringSetting("cron expression the pings follow, the interval is used when empty"),
+			"heartbeat_grace":       intSetting("seconds a ping may be late, default 60", 1),
+			"heartbeat_max_runtime": intSetting("seconds between start and success pings, 0 disables", 0),
+		},
+		defaults: func(e *models.Endpoint) {
+			if e.HeartbeatToken == "" {
+				e.HeartbeatToken = uuid.New().String()
+			}
+			if e.HeartbeatGrace <= 0 {
+				e.HeartbeatGrace = 60
+			}
+		},
+		validate: func(e *models.Endpoint) error {
+			if e.HeartbeatSchedule != "" {
+				if _, err := cron.ParseStandard(e.HeartbeatSchedule); err != nil {
+					return models.ErrInvalidSchedule
+				}
+			}
+			return nil
+		},
+		check: (*Worker).CheckHeartbeatEndpoint,
+	})
+	RegisterChecker(&checkType{
+		name:        "transaction",
+		description: "Run a sequence of HTTP steps, passing values between them",
+		settings: settings(clientCertificateSettings, proxySettings, retrySettings, probeSettings, quorumSettings, map[string]any{
+			"transaction_steps": map[string]any{"type": "array", "description": "ordered HTTP steps", "items": map[string]any{"type": "object"}},
+			"max_response_time": intSetting("milliseconds a step may take, default 5000", 1),
+		}),
+		validate: func(e *models.Endpoint) error {
+			return e.TransactionSteps.Validate()
+		},
+		check: (*Worker).CheckTransactionEndpoint,
+	})
+}
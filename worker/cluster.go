@@ -0,0 +1,261 @@
+package worker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/monty/models"
+	"gorm.io/gorm/clause"
+)
+
+// defaultLeaseTTL is how long an endpoint lease, and a node's heartbeat, stays valid without being
+// renewed, overridden by CLUSTER_LEASE_TTL. Nodes renew at a third of it
+const defaultLeaseTTL = 30 * time.Second
+
+// deadNodeRetention is how long a node that stopped heartbeating, or a lease nobody renewed, stays
+// listed before it's removed
+const deadNodeRetention = 24 * time.Hour
+
+// ClusterStats describes this node's view of the cluster
+type ClusterStats struct {
+	NodeID  string   `json:"node_id"`
+	Members []string `json:"members"` // live nodes, this one included
+	Owned   int      `json:"owned"`   // endpoints this node holds the lease of
+}
+
+// cluster splits the endpoints between the instances sharing a database, so each is checked by one
+// of them. Nodes heartbeat in cluster_nodes, each endpoint is assigned to a live node by rendezvous
+// hashing and checked by whoever holds its lease in endpoint_leases. A node only takes a lease
+// that's free, expired or its own, releases those that moved to another node, and stops checking
+// everything once it couldn't renew its leases for a TTL. Clocks are assumed to be in sync
+type cluster struct {
+	nodeID    string
+	hostname  string
+	startedAt time.Time
+	ttl       time.Duration
+
+	mu         sync.Mutex
+	members    []string        // live nodes at the last sync, sorted
+	owned      map[string]bool // endpoints whose lease this node holds
+	validUntil time.Time       // when the leases taken at the last successful sync expire
+}
+
+func newCluster(nodeID string, ttl time.Duration) *cluster {
+	hostname, _ := os.Hostname()
+	if nodeID == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		nodeID = hostname + "-" + hex.EncodeToString(suffix)
+	}
+	if ttl <= 0 {
+		ttl = defaultLeaseTTL
+	}
+	return &cluster{
+		nodeID:    nodeID,
+		hostname:  hostname,
+		startedAt: time.Now().UTC(),
+		ttl:       ttl,
+		members:   []string{nodeID},
+		owned:     make(map[string]bool),
+	}
+}
+
+// newClusterFromEnv returns the cluster CLUSTER_MODE asks for, nil when running standalone
+func newClusterFromEnv() *cluster {
+	switch os.Getenv("CLUSTER_MODE") {
+	case "", "0", "false":
+		return nil
+	}
+	c := newCluster(os.Getenv("CLUSTER_NODE_ID"), time.Duration(envInt("CLUSTER_LEASE_TTL", 0))*time.Second)
+	log.Printf("Cluster mode, node %s with %s leases", c.nodeID, c.ttl)
+	return c
+}
+
+// renewInterval is how often the node heartbeats and renews its leases
+func (c *cluster) renewInterval() time.Duration {
+	return c.ttl / 3
+}
+
+// owner returns the live node an endpoint is assigned to: the member scoring highest for it, so
+// a node joining or leaving only moves the endpoints it wins or held
+func owner(endpointID string, members []string) string {
+	best, bestScore := "", uint64(0)
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(member))
+		h.Write([]byte{0})
+		h.Write([]byte(endpointID))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = member, score
+		}
+	}
+	return best
+}
+
+// sync heartbeats, releases the leases of endpoints assigned to other nodes, takes or renews those
+// assigned to this one and returns the endpoints this node holds the lease of. When the database
+// can't be reached the node keeps its endpoints until their leases expire
+func (c *cluster) sync(endpointIDs []string) (map[string]bool, error) {
+	now := time.Now().UTC()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	owned, members, err := c.syncLocked(endpointIDs, now)
+	if err != nil {
+		if now.After(c.validUntil) {
+			c.owned = make(map[string]bool)
+		}
+		return c.owned, err
+	}
+	c.owned, c.members, c.validUntil = owned, members, now.Add(c.ttl)
+	return owned, nil
+}
+
+func (c *cluster) syncLocked(endpointIDs []string, now time.Time) (map[string]bool, []string, error) {
+	db := models.DB
+	node := models.ClusterNode{ID: c.nodeID, Hostname: c.hostname, StartedAt: c.startedAt, HeartbeatAt: now}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"heartbeat_at"}),
+	}).Create(&node).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	// Forget nodes, and leases, nobody has renewed in a long time
+	if err := db.Where("heartbeat_at < ?", now.Add(-deadNodeRetention)).Delete(&models.ClusterNode{}).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := db.Where("expires_at < ?", now.Add(-deadNodeRetention)).Delete(&models.EndpointLease{}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var members []string
+	if err := db.Model(&models.ClusterNode{}).Where("heartbeat_at > ?", now.Add(-c.ttl)).Order("id").Pluck("id", &members).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// Hand over what another node is assigned now, it takes the lease at its next sync
+	assigned := make(map[string]bool)
+	for _, id := range endpointIDs {
+		if owner(id, members) == c.nodeID {
+			assigned[id] = true
+		}
+	}
+	var held []string
+	if err := db.Model(&models.EndpointLease{}).Where("node_id = ?", c.nodeID).Pluck("endpoint_id", &held).Error; err != nil {
+		return nil, nil, err
+	}
+	var released []string
+	for _, id := range held {
+		if !assigned[id] {
+			released = append(released, id)
+		}
+	}
+	if len(released) > 0 {
+		if err := db.Where("node_id = ? AND endpoint_id IN ?", c.nodeID, released).Delete(&models.EndpointLease{}).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	leases := make([]models.EndpointLease, 0, len(assigned))
+	for id := range assigned {
+		leases = append(leases, models.EndpointLease{EndpointID: id, NodeID: c.nodeID, ExpiresAt: now.Add(c.ttl)})
+	}
+	if err := c.claim(leases, now); err != nil {
+		return nil, nil, err
+	}
+
+	var ownedIDs []string
+	if err := db.Model(&models.EndpointLease{}).Where("node_id = ? AND expires_at > ?", c.nodeID, now).Pluck("endpoint_id", &ownedIDs).Error; err != nil {
+		return nil, nil, err
+	}
+	owned := make(map[string]bool, len(ownedIDs))
+	for _, id := range ownedIDs {
+		owned[id] = true
+	}
+	return owned, members, nil
+}
+
+// claim takes or renews leases in one statement per batch. A lease held by another node is only
+// overwritten once it expired, so two nodes never hold the same endpoint
+func (c *cluster) claim(leases []models.EndpointLease, now time.Time) error {
+	if len(leases) == 0 {
+		return nil
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].EndpointID < leases[j].EndpointID })
+	return models.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "endpoint_id"}},
+		Where: clause.Where{Exprs: []clause.Expression{clause.Or(
+			clause.Eq{Column: clause.Column{Table: "endpoint_leases", Name: "node_id"}, Value: c.nodeID},
+			clause.Lt{Column: clause.Column{Table: "endpoint_leases", Name: "expires_at"}, Value: now},
+		)}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_id", "expires_at"}),
+	}).CreateInBatches(&leases, 500).Error
+}
+
+// acquire takes the lease of an endpoint the API just created or changed when it's assigned to
+// this node, and reports whether the node holds it. Endpoints assigned elsewhere are picked up by
+// their owner's next sync
+func (c *cluster) acquire(endpointID string) bool {
+	now := time.Now().UTC()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.owned[endpointID] {
+		return true
+	}
+	if owner(endpointID, c.members) != c.nodeID {
+		return false
+	}
+	lease := models.EndpointLease{EndpointID: endpointID, NodeID: c.nodeID, ExpiresAt: now.Add(c.ttl)}
+	if err := c.claim([]models.EndpointLease{lease}, now); err != nil {
+		log.Printf("Failed to take the lease of endpoint %s: %v", endpointID, err)
+		return false
+	}
+	var held models.EndpointLease
+	if err := models.DB.First(&held, "endpoint_id = ?", endpointID).Error; err != nil || held.NodeID != c.nodeID {
+		return false
+	}
+	c.owned[endpointID] = true
+	return true
+}
+
+// lapsed reports whether the leases taken at the last successful sync have expired, forgetting
+// them when they have
+func (c *cluster) lapsed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().UTC().Before(c.validUntil) {
+		return false
+	}
+	c.owned = make(map[string]bool)
+	return true
+}
+
+// leave releases the node's leases and removes it from the members, so the other nodes take its
+// endpoints over at their next sync instead of waiting for the leases to expire
+func (c *cluster) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := models.DB.Where("node_id = ?", c.nodeID).Delete(&models.EndpointLease{}).Error; err != nil {
+		log.Printf("Failed to release the node's leases: %v", err)
+	}
+	if err := models.DB.Delete(&models.ClusterNode{}, "id = ?", c.nodeID).Error; err != nil {
+		log.Printf("Failed to leave the cluster: %v", err)
+	}
+	c.owned = make(map[string]bool)
+}
+
+// Stats returns the node's view of the cluster at the last sync
+func (c *cluster) Stats() ClusterStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClusterStats{NodeID: c.nodeID, Members: append([]string(nil), c.members...), Owned: len(c.owned)}
+}
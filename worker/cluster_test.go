@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"gorm.io/gorm"
+)
+
+// setupClusterDB returns the test database without nodes or leases left by other tests
+func setupClusterDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	models.DB = db
+	db.Exec("DELETE FROM cluster_nodes")
+	db.Exec("DELETE FROM endpoint_leases")
+	return db
+}
+
+func endpointIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = uuid.New().String()
+	}
+	return ids
+}
+
+// syncAll runs a sync on every node, failing the test on errors
+func syncAll(t *testing.T, ids []string, nodes ...*cluster) []map[string]bool {
+	t.Helper()
+	owned := make([]map[string]bool, len(nodes))
+	for i, node := range nodes {
+		var err error
+		if owned[i], err = node.sync(ids); err != nil {
+			t.Fatalf("sync of %s failed: %v", node.nodeID, err)
+		}
+	}
+	return owned
+}
+
+// checkPartition fails the test unless every endpoint is owned by exactly one of the nodes
+func checkPartition(t *testing.T, ids []string, owned ...map[string]bool) {
+	t.Helper()
+	for _, id := range ids {
+		owners := 0
+		for _, o := range owned {
+			if o[id] {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("endpoint %s is owned by %d nodes", id, owners)
+		}
+	}
+}
+
+func TestClusterSplitsEndpointsBetweenNodes(t *testing.T) {
+	setupClusterDB(t)
+	ids := endpointIDs(50)
+
+	a := newCluster("node-a", time.Minute)
+	owned := syncAll(t, ids, a)
+	if len(owned[0]) != len(ids) {
+		t.Fatalf("expected a single node to own all %d endpoints, got %d", len(ids), len(owned[0]))
+	}
+
+	// b joins: it can't take a's leases, a hands over b's share, then b takes it
+	b := newCluster("node-b", time.Minute)
+	owned = syncAll(t, ids, b)
+	if len(owned[0]) != 0 {
+		t.Fatalf("expected b to wait for a to release its leases, got %d", len(owned[0]))
+	}
+	owned = syncAll(t, ids, a, b)
+	checkPartition(t, ids, owned...)
+	if len(owned[0]) == 0 || len(owned[1]) == 0 {
+		t.Fatalf("expected both nodes to own endpoints, got %d and %d", len(owned[0]), len(owned[1]))
+	}
+
+	// Further syncs keep the split stable
+	again := syncAll(t, ids, a, b)
+	if len(again[0]) != len(owned[0]) || len(again[1]) != len(owned[1]) {
+		t.Errorf("expected the split to stay, got %d/%d after %d/%d", len(again[0]), len(again[1]), len(owned[0]), len(owned[1]))
+	}
+}
+
+func TestClusterTakesOverFromDeadNode(t *testing.T) {
+	setupClusterDB(t)
+	ids := endpointIDs(20)
+
+	a := newCluster("node-a", 300*time.Millisecond)
+	b := newCluster("node-b", 300*time.Millisecond)
+	syncAll(t, ids, a, b)
+	owned := syncAll(t, ids, a, b)
+	checkPartition(t, ids, owned...)
+
+	// a stops heartbeating, once its heartbeat and leases expired b checks everything
+	time.Sleep(400 * time.Millisecond)
+	owned = syncAll(t, ids, b)
+	if len(owned[0]) != len(ids) {
+		t.Fatalf("expected b to take over all %d endpoints, got %d", len(ids), len(owned[0]))
+	}
+	if stats := b.Stats(); len(stats.Members) != 1 || stats.Members[0] != "node-b" {
+		t.Errorf("expected b to be the only member, got %v", stats.Members)
+	}
+}
+
+func TestClusterLeaveHandsOverRightAway(t *testing.T) {
+	setupClusterDB(t)
+	ids := endpointIDs(20)
+
+	a := newCluster("node-a", time.Minute)
+	b := newCluster("node-b", time.Minute)
+	syncAll(t, ids, a, b)
+	syncAll(t, ids, a, b)
+
+	a.leave()
+	owned := syncAll(t, ids, b)
+	if len(owned[0]) != len(ids) {
+		t.Fatalf("expected b to own all %d endpoints after a left, got %d", len(ids), len(owned[0]))
+	}
+}
+
+func TestClusterAcquireOnlyAssignedEndpoints(t *testing.T) {
+	setupClusterDB(t)
+	a := newCluster("node-a", time.Minute)
+	b := newCluster("node-b", time.Minute)
+	syncAll(t, nil, a, b)
+	syncAll(t, nil, a, b)
+
+	// A new endpoint is started by the node it's assigned to, whichever node created it
+	for i := 0; i < 10; i++ {
+		id := uuid.New().String()
+		gotA, gotB := a.acquire(id), b.acquire(id)
+		if gotA == gotB {
+			t.Fatalf("endpoint %s: expected exactly one node to acquire it, a %v b %v", id, gotA, gotB)
+		}
+		if want := owner(id, []string{"node-a", "node-b"}); (want == "node-a") != gotA {
+			t.Fatalf("endpoint %s: expected %s to acquire it", id, want)
+		}
+	}
+}
+
+func TestClusterWorkersMonitorDisjointEndpoints(t *testing.T) {
+	db := setupClusterDB(t)
+	db.Exec("DELETE FROM endpoints")
+	for i := 0; i < 12; i++ {
+		ep := models.Endpoint{ID: uuid.New().String(), URL: fmt.Sprintf("job-%d", i), CheckType: "heartbeat", Interval: 3600}
+		if err := db.Create(&ep).Error; err != nil {
+			t.Fatalf("failed to create endpoint: %v", err)
+		}
+	}
+
+	newNode := func(id string) *Worker {
+		w := NewWorker(time.Hour)
+		w.cluster = newCluster(id, time.Minute)
+		return w
+	}
+	a, b := newNode("node-a"), newNode("node-b")
+	defer b.Shutdown(context.Background())
+	defer a.Shutdown(context.Background())
+	for i := 0; i < 2; i++ {
+		a.discoverEndpoints()
+		b.discoverEndpoints()
+	}
+
+	a.mu.RLock()
+	b.mu.RLock()
+	defer a.mu.RUnlock()
+	defer b.mu.RUnlock()
+	if len(a.monitored)+len(b.monitored) != 12 {
+		t.Fatalf("expected 12 monitors between the nodes, got %d and %d", len(a.monitored), len(b.monitored))
+	}
+	for id := range a.monitored {
+		if _, dup := b.monitored[id]; dup {
+			t.Fatalf("endpoint %s is monitored by both nodes", id)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/net/html"
+)
+
+// maxContentBodySize caps how much of a watched response body is read
+const maxContentBodySize = 1 << 20
+
+// trackContent compares the selected part of body with the endpoint's last snapshot, records
+// change events and returns a non-empty problem when the content should fail the check
+func (w *Worker) trackContent(ep Endpoint, body []byte, now time.Time) string {
+	content, err := selectContent(body, ep.ContentSelectorType, ep.ContentSelector)
+	if err != nil {
+		return err.Error()
+	}
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+
+	var snapshots []models.ContentSnapshot
+	if err := models.DB.Where("endpoint_id = ?", ep.ID).Limit(1).Find(&snapshots).Error; err != nil {
+		log.Printf("failed to load content snapshot for %s: %v", ep.URL, err)
+		return ""
+	}
+	if len(snapshots) == 0 {
+		// First sighting, nothing to compare against yet
+		snapshot := models.ContentSnapshot{EndpointID: ep.ID, Hash: hash, Content: content, ChangedAt: now, CheckedAt: now}
+		if err := models.DB.Create(&snapshot).Error; err != nil {
+			log.Printf("failed to save content snapshot for %s: %v", ep.URL, err)
+		}
+		return ""
+	}
+	snapshot := snapshots[0]
+
+	problem := ""
+	if snapshot.Hash != hash {
+		if ep.ContentMode == models.ContentModeChange {
+			w.saveContentChange(ep, models.ContentChange{
+				ID:           uuid.New().String(),
+				EndpointID:   ep.ID,
+				Kind:         models.ContentEventChanged,
+				PreviousHash: snapshot.Hash,
+				Hash:         hash,
+				Diff:         contentDiff(snapshot.Content, content, snapshot.ChangedAt, now),
+				DetectedAt:   now,
+			})
+			log.Printf("Content changed for %s", ep.URL)
+		}
+		snapshot.Hash = hash
+		snapshot.Content = content
+		snapshot.ChangedAt = now
+		snapshot.StaleNotified = false
+	} else if ep.ContentMode == models.ContentModeStale && now.Sub(snapshot.ChangedAt) > ep.ContentStaleAfter {
+		problem = fmt.Sprintf("content unchanged since %s", snapshot.ChangedAt.Format(time.RFC3339))
+		if !snapshot.StaleNotified {
+			w.saveContentChange(ep, models.ContentChange{
+				ID:           uuid.New().String(),
+				EndpointID:   ep.ID,
+				Kind:         models.ContentEventStale,
+				PreviousHash: hash,
+				Hash:         hash,
+				DetectedAt:   now,
+			})
+			snapshot.StaleNotified = true
+		}
+	}
+
+	snapshot.CheckedAt = now
+	if err := models.DB.Save(&snapshot).Error; err != nil {
+		log.Printf("failed to save content snapshot for %s: %v", ep.URL, err)
+	}
+	return problem
+}
+
+func (w *Worker) saveContentChange(ep Endpoint, change models.ContentChange) {
+	if err := models.DB.Create(&change).Error; err != nil {
+		log.Printf("failed to save content change for %s: %v", ep.URL, err)
+	}
+}
+
+// selectContent narrows a response body down to the part being watched
+func selectContent(body []byte, selectorType, selector string) (string, error) {
+	switch selectorType {
+	case "":
+		return string(body), nil
+	case models.ContentSelectorCSS:
+		sel, err := cascadia.Compile(selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid CSS selector %q: %v", selector, err)
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return "", err
+		}
+		nodes := sel.MatchAll(doc)
+		if len(nodes) == 0 {
+			return "", fmt.Errorf("CSS selector %q matched nothing", selector)
+		}
+		parts := make([]string, len(nodes))
+		for i, node := range nodes {
+			parts[i] = nodeText(node)
+		}
+		return strings.Join(parts, "\n"), nil
+	case models.ContentSelectorRegex:
+		re, err := regexp.Compile(selector)
+		if err != nil {
+			return "", fmt.Errorf("invalid regex %q: %v", selector, err)
+		}
+		matches := re.FindAllSubmatch(body, -1)
+		if len(matches) == 0 {
+			return "", fmt.Errorf("regex %q matched nothing", selector)
+		}
+		parts := make([]string, len(matches))
+		for i, match := range matches {
+			parts[i] = string(match[len(match)-1])
+		}
+		return strings.Join(parts, "\n"), nil
+	case models.ContentSelectorJSON:
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", fmt.Errorf("response is not JSON: %v", err)
+		}
+		value, err := lookupJSONPath(doc, selector)
+		if err != nil {
+			return "", err
+		}
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			// Indent nested values so diffs are line by line
+			data, _ := json.MarshalIndent(value, "", "  ")
+			return string(data), nil
+		}
+		return jsonValueString(value), nil
+	default:
+		return "", fmt.Errorf("unknown content selector type %q", selectorType)
+	}
+}
+
+// nodeText returns the text of an HTML node with whitespace collapsed line by line
+func nodeText(node *html.Node) string {
+	var buf strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(node)
+
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func contentDiff(previous, current string, previousAt, currentAt time.Time) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous),
+		B:        difflib.SplitLines(current),
+		FromFile: "previous",
+		FromDate: previousAt.Format(time.RFC3339),
+		ToFile:   "current",
+		ToDate:   currentAt.Format(time.RFC3339),
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func TestSelectContent(t *testing.T) {
+	page := []byte(`<html><body>
+		<div id="status"><span class="state">All systems
+			operational</span><script>var ts = 1;</script></div>
+		<p class="updated">Updated 5 minutes ago</p>
+	</body></html>`)
+
+	tests := []struct {
+		body         []byte
+		selectorType string
+		selector     string
+		expected     string
+		err          bool
+	}{
+		{[]byte("User-agent: *\nDisallow: /admin\n"), "", "", "User-agent: *\nDisallow: /admin\n", false},
+		{page, models.ContentSelectorCSS, "#status", "All systems\noperational", false},
+		{page, models.ContentSelectorCSS, "table", "", true},
+		{[]byte("Expires: 2025-01-01\nContact: x\nExpires: 2026-01-01"), models.ContentSelectorRegex, `Expires: (\S+)`, "2025-01-01\n2026-01-01", false},
+		{[]byte(`{"status":{"indicator":"none","updated":"now"}}`), models.ContentSelectorJSON, "$.status.indicator", "none", false},
+		{[]byte(`{"components":[{"name":"api"}]}`), models.ContentSelectorJSON, "$.components", "[\n  {\n    \"name\": \"api\"\n  }\n]", false},
+		{[]byte(`not json`), models.ContentSelectorJSON, "$.a", "", true},
+	}
+
+	for _, test := range tests {
+		content, err := selectContent(test.body, test.selectorType, test.selector)
+		if test.err {
+			if err == nil {
+				t.Errorf("selectContent(%s, %s) expected error", test.selectorType, test.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("selectContent(%s, %s) returned error: %v", test.selectorType, test.selector, err)
+			continue
+		}
+		if content != test.expected {
+			t.Errorf("selectContent(%s, %s) = %q, expected %q", test.selectorType, test.selector, content, test.expected)
+		}
+	}
+}
+
+func TestTrackContentChange(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	ep := Endpoint{ID: uuid.New().String(), URL: "https://example.com/robots.txt", ContentMode: models.ContentModeChange}
+	now := time.Now()
+
+	if problem := w.trackContent(ep, []byte("User-agent: *\nDisallow: /admin\n"), now); problem != "" {
+		t.Fatalf("unexpected problem on first snapshot: %s", problem)
+	}
+	if problem := w.trackContent(ep, []byte("User-agent: *\nDisallow: /admin\n"), now.Add(time.Minute)); problem != "" {
+		t.Fatalf("unexpected problem for unchanged content: %s", problem)
+	}
+	if problem := w.trackContent(ep, []byte("User-agent: *\nDisallow: /\n"), now.Add(2*time.Minute)); problem != "" {
+		t.Fatalf("a change should not fail the check: %s", problem)
+	}
+
+	var changes []models.ContentChange
+	db.Where("endpoint_id = ?", ep.ID).Find(&changes)
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 content change, got %d", len(changes))
+	}
+	if changes[0].Kind != models.ContentEventChanged {
+		t.Fatalf("expected change event, got %s", changes[0].Kind)
+	}
+	if !strings.Contains(changes[0].Diff, "-Disallow: /admin\n+Disallow: /\n") {
+		t.Fatalf("expected unified diff of the change, got:\n%s", changes[0].Diff)
+	}
+}
+
+func TestTrackContentStale(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	ep := Endpoint{ID: uuid.New().String(), URL: "https://example.com/.well-known/security.txt", ContentMode: models.ContentModeStale, ContentStaleAfter: time.Hour}
+	now := time.Now()
+	body := []byte("Contact: mailto:security@example.com\n")
+
+	w.trackContent(ep, body, now)
+	if problem := w.trackContent(ep, body, now.Add(30*time.Minute)); problem != "" {
+		t.Fatalf("content should not be stale yet: %s", problem)
+	}
+	for i := 2; i <= 3; i++ {
+		if problem := w.trackContent(ep, body, now.Add(time.Duration(i)*time.Hour)); !strings.Contains(problem, "content unchanged since") {
+			t.Fatalf("expected stale problem, got %q", problem)
+		}
+	}
+
+	var changes []models.ContentChange
+	db.Where("endpoint_id = ?", ep.ID).Find(&changes)
+	if len(changes) != 1 || changes[0].Kind != models.ContentEventStale {
+		t.Fatalf("expected a single stale event, got %+v", changes)
+	}
+
+	if problem := w.trackContent(ep, []byte("Contact: mailto:psirt@example.com\n"), now.Add(4*time.Hour)); problem != "" {
+		t.Fatalf("changed content should no longer be stale: %s", problem)
+	}
+}
+
+func TestCheckHTTPEndpointWatchesContent(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":{"indicator":"minor"}}`))
+	}))
+	defer server.Close()
+
+	ep := Endpoint{
+		ID: uuid.New().String(), URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second,
+		ContentMode: models.ContentModeChange, ContentSelectorType: models.ContentSelectorJSON, ContentSelector: "$.status.indicator",
+	}
+	w.runCheck(context.Background(), ep)
+
+	var snapshot models.ContentSnapshot
+	if err := db.First(&snapshot, "endpoint_id = ?", ep.ID).Error; err != nil {
+		t.Fatalf("expected content snapshot to be saved: %v", err)
+	}
+	if snapshot.Content != "minor" {
+		t.Fatalf("expected selected content %q, got %q", "minor", snapshot.Content)
+	}
+}
@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// contextDialer is implemented by net.Dialer and the proxy dialers checks connect through
+type contextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// parseProxyURL parses an endpoint's proxy setting, returning nil when no proxy is configured
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// newDialer returns the dialer raw TCP and TLS checks use, routed through the endpoint's proxy if it has one
+func newDialer(ep Endpoint) (contextDialer, error) {
+	direct := &familyDialer{dialer: &net.Dialer{Timeout: ep.Timeout}, family: ep.AddressFamily}
+
+	proxyURL, err := parseProxyURL(ep.ProxyURL)
+	if err != nil || proxyURL == nil {
+		return direct, err
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, direct)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(contextDialer), nil
+	default:
+		return &connectDialer{proxyURL: proxyURL, forward: direct}, nil
+	}
+}
+
+// connectDialer tunnels connections through an HTTP proxy using CONNECT
+type connectDialer struct {
+	proxyURL *url.URL
+	forward  contextDialer
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	proxyAddr := d.proxyURL.Host
+	if d.proxyURL.Port() == "" {
+		port := "80"
+		if d.proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(d.proxyURL.Hostname(), port)
+	}
+
+	conn, err := d.forward.DialContext(ctx, network, proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to proxy: %v", err)
+	}
+	if d.proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy TLS handshake: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	// Abort the CONNECT exchange if the context ends before the proxy answers
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.proxyURL.User != nil {
+		password, _ := d.proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("proxy CONNECT: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT to %s: %s", address, resp.Status)
+	}
+	if reader.Buffered() > 0 {
+		// The proxy already relayed bytes from the target, don't lose them
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// timeoutContext bounds a check by timeout, a zero timeout means no limit like net.Dialer's
+func timeoutContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dialTCP opens a plain TCP connection for a check, bounded by the endpoint's timeout
+func dialTCP(ctx context.Context, ep Endpoint, address string) (net.Conn, error) {
+	dialer, err := newDialer(ep)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := timeoutContext(ctx, ep.Timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// dialTLS opens a TLS connection for a check and completes the handshake within the endpoint's timeout
+func dialTLS(ctx context.Context, ep Endpoint, host, port string, config *tls.Config) (*tls.Conn, error) {
+	dialer, err := newDialer(ep)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := timeoutContext(ctx, ep.Timeout)
+	defer cancel()
+
+	rawConn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	conn := tls.Client(rawConn, config)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,247 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// startConnectProxy runs a minimal HTTP CONNECT proxy requiring user:secret and counts tunnels
+func startConnectProxy(t *testing.T) (string, *int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var tunnels int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil {
+					return
+				}
+				expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != expected {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(&tunnels, 1)
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				relay(conn, reader, target)
+			}()
+		}
+	}()
+
+	return "http://user:secret@" + ln.Addr().String(), &tunnels
+}
+
+// startSOCKS5Proxy runs a minimal SOCKS5 proxy with username/password auth and counts tunnels
+func startSOCKS5Proxy(t *testing.T) (string, *int32) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var tunnels int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				buf := make([]byte, 512)
+
+				// Greeting: version, method count, methods; pick username/password
+				if _, err := io.ReadFull(reader, buf[:2]); err != nil {
+					return
+				}
+				io.ReadFull(reader, buf[:buf[1]])
+				conn.Write([]byte{5, 2})
+
+				// Username/password sub-negotiation
+				io.ReadFull(reader, buf[:2])
+				user := make([]byte, buf[1])
+				io.ReadFull(reader, user)
+				io.ReadFull(reader, buf[:1])
+				pass := make([]byte, buf[0])
+				io.ReadFull(reader, pass)
+				if string(user) != "user" || string(pass) != "secret" {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+
+				// Connect request: version, command, reserved, address type, address, port
+				io.ReadFull(reader, buf[:4])
+				var host string
+				switch buf[3] {
+				case 1:
+					io.ReadFull(reader, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					io.ReadFull(reader, buf[:1])
+					name := make([]byte, buf[0])
+					io.ReadFull(reader, name)
+					host = string(name)
+				default:
+					return
+				}
+				io.ReadFull(reader, buf[:2])
+				port := binary.BigEndian.Uint16(buf[:2])
+
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				atomic.AddInt32(&tunnels, 1)
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				relay(conn, reader, target)
+			}()
+		}
+	}()
+
+	return "socks5://user:secret@" + ln.Addr().String(), &tunnels
+}
+
+func relay(client net.Conn, clientReader io.Reader, target net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(target, clientReader); done <- struct{}{} }()
+	go func() { io.Copy(client, target); done <- struct{}{} }()
+	<-done
+}
+
+func TestChecksThroughProxy(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer httpServer.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	_, tcpPort, _ := net.SplitHostPort(httpServer.Listener.Addr().String())
+	port, _ := strconv.Atoi(tcpPort)
+
+	// The test server's own certificate isn't trusted, trust it for this test
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	original := defaultTransport.TLSClientConfig
+	defaultTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() { defaultTransport.TLSClientConfig = original }()
+
+	connectURL, connectTunnels := startConnectProxy(t)
+	socksURL, socksTunnels := startSOCKS5Proxy(t)
+
+	for _, proxy := range []struct {
+		url     string
+		tunnels *int32
+	}{
+		{connectURL, connectTunnels},
+		{socksURL, socksTunnels},
+	} {
+		base := Endpoint{
+			Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second, ProxyURL: proxy.url,
+			AddressFamily: models.AddressFamilyIPv4,
+		}
+
+		tcp := base
+		tcp.ID, tcp.CheckType, tcp.URL, tcp.TCPPort = uuid.New().String(), "tcp", "127.0.0.1", port
+		w.runCheck(context.Background(), tcp)
+
+		ssl := base
+		ssl.ID, ssl.CheckType, ssl.URL, ssl.AcceptableTLSVersions = uuid.New().String(), "ssl", tlsServer.URL, []string{"TLS 1.3"}
+		w.runCheck(context.Background(), ssl)
+
+		https := base
+		https.ID, https.URL = uuid.New().String(), tlsServer.URL
+		w.runCheck(context.Background(), https)
+
+		var tcpStatus models.Status
+		if err := db.First(&tcpStatus, "endpoint_id = ?", tcp.ID).Error; err != nil || tcpStatus.ErrorMessage != "" {
+			t.Errorf("%s: TCP check through proxy failed: %v %s", proxy.url, err, tcpStatus.ErrorMessage)
+		}
+		var sslStatus models.SSLStatus
+		if err := db.First(&sslStatus, "endpoint_id = ?", ssl.ID).Error; err != nil || sslStatus.TLSVersion != "TLS 1.3" {
+			t.Errorf("%s: SSL check through proxy failed: %v %s", proxy.url, err, sslStatus.ErrorMessage)
+		}
+		var httpStatus models.Status
+		if err := db.First(&httpStatus, "endpoint_id = ?", https.ID).Error; err != nil || httpStatus.Code != http.StatusOK {
+			t.Errorf("%s: HTTP check through proxy failed: %v %s", proxy.url, err, httpStatus.ErrorMessage)
+		}
+		if got := atomic.LoadInt32(proxy.tunnels); got != 3 {
+			t.Errorf("%s: expected 3 tunnels through the proxy, got %d", proxy.url, got)
+		}
+		// The connections only show the proxy's address, which isn't the endpoint's
+		for _, got := range [][2]string{
+			{tcpStatus.RemoteIP, tcpStatus.AddressFamily},
+			{sslStatus.RemoteIP, sslStatus.AddressFamily},
+			{httpStatus.RemoteIP, httpStatus.AddressFamily},
+		} {
+			if got != [2]string{} {
+				t.Errorf("%s: expected no remote IP or family through the proxy, got %v", proxy.url, got)
+			}
+		}
+	}
+}
+
+func TestConnectDialerRejectedCredentials(t *testing.T) {
+	proxyURL, _ := startConnectProxy(t)
+	ep := Endpoint{Timeout: 5 * time.Second, ProxyURL: "http://user:wrong@" + proxyURL[len("http://user:secret@"):]}
+
+	_, err := dialTCP(context.Background(), ep, "127.0.0.1:1")
+	if err == nil || err.Error() != "proxy CONNECT to 127.0.0.1:1: 407 Proxy Authentication Required" {
+		t.Fatalf("expected proxy authentication error, got %v", err)
+	}
+}
+
+func TestNewHTTPTransportProxy(t *testing.T) {
+	transport, _, err := newHTTPTransport(Endpoint{ProxyURL: "socks5://127.0.0.1:1080"})
+	if err != nil {
+		t.Fatalf("newHTTPTransport returned error: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	proxyURL, err := transport.Proxy(req)
+	if err != nil || proxyURL == nil || proxyURL.String() != "socks5://127.0.0.1:1080" {
+		t.Fatalf("expected requests to use the endpoint proxy, got %v (%v)", proxyURL, err)
+	}
+
+	if _, _, err := newHTTPTransport(Endpoint{ProxyURL: "ftp://proxy"}); err == nil {
+		t.Fatalf("expected unsupported proxy scheme to be rejected")
+	}
+}
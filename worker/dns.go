@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsPort is the port nameservers found through NS lookups are queried on
+var dnsPort = "53"
+
+// dnsName extracts the domain name a DNS-based check is about from an endpoint URL
+func dnsName(rawURL string) string {
+	name := strings.TrimPrefix(rawURL, "http://")
+	name = strings.TrimPrefix(name, "https://")
+	if i := strings.IndexAny(name, "/?#"); i >= 0 {
+		name = name[:i]
+	}
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
+	}
+	return dns.Fqdn(strings.ToLower(name))
+}
+
+// resolverAddress adds the default DNS port to a resolver that doesn't name one
+func resolverAddress(resolver string) string {
+	if _, _, err := net.SplitHostPort(resolver); err == nil {
+		return resolver
+	}
+	return net.JoinHostPort(strings.Trim(resolver, "[]"), dnsPort)
+}
+
+// systemResolver returns the first nameserver configured in /etc/resolv.conf
+func systemResolver() (string, error) {
+	config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return "", err
+	}
+	if len(config.Servers) == 0 {
+		return "", fmt.Errorf("no nameservers in /etc/resolv.conf")
+	}
+	return net.JoinHostPort(config.Servers[0], config.Port), nil
+}
+
+// queryDNS asks server a single question
+func queryDNS(ctx context.Context, ep Endpoint, server, name string, qtype uint16) (*dns.Msg, time.Duration, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.SetEdns0(4096, false)
+	return exchangeDNS(ctx, ep, server, msg)
+}
+
+// exchangeDNS sends msg to server, retrying over TCP when the UDP answer was truncated
+func exchangeDNS(ctx context.Context, ep Endpoint, server string, msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	client := &dns.Client{Timeout: ep.Timeout}
+	resp, rtt, err := client.ExchangeContext(ctx, msg, server)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, rtt, err = client.ExchangeContext(ctx, msg, server)
+	}
+	if err != nil {
+		return nil, rtt, err
+	}
+	return resp, rtt, nil
+}
+
+// recordData returns the answer records as sorted "TYPE data" strings, leaving out owner
+// names and TTLs so answers from different resolvers compare equal
+func recordData(records []dns.RR) []string {
+	data := make([]string, 0, len(records))
+	for _, rr := range records {
+		header := rr.Header()
+		value := strings.TrimPrefix(rr.String(), header.String())
+		data = append(data, dns.TypeToString[header.Rrtype]+" "+value)
+	}
+	sort.Strings(data)
+	return data
+}
+
+// soaSerial returns the serial of the SOA record in the answer or authority section, 0 if none
+func soaSerial(msg *dns.Msg) uint32 {
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Serial
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,274 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/monty/models"
+)
+
+// dnsTarget is a server a propagation check queries
+type dnsTarget struct {
+	address       string
+	nameserver    string
+	authoritative bool
+	err           string // set when the target couldn't be located
+}
+
+// CheckDNSPropagationEndpoint asks every configured resolver, and optionally each of the
+// zone's authoritative nameservers, for the same record and reports the ones that disagree
+// with the consensus or serve an older SOA serial
+func (w *Worker) CheckDNSPropagationEndpoint(ctx context.Context, ep Endpoint) Result {
+	name := dnsName(ep.URL)
+	qtype, ok := dns.StringToType[strings.ToUpper(ep.DNSRecordType)]
+	if !ok {
+		qtype = dns.TypeA
+	}
+
+	var problems []string
+	targets := make([]dnsTarget, 0, len(ep.DNSResolvers))
+	for _, resolver := range ep.DNSResolvers {
+		targets = append(targets, dnsTarget{address: resolverAddress(resolver)})
+	}
+	if ep.DNSCheckAuthoritative {
+		nameservers, err := findNameservers(ctx, ep, name)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		targets = append(targets, nameservers...)
+	}
+
+	results := make([]models.DNSResolverResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target dnsTarget) {
+			defer wg.Done()
+			results[i] = queryResolver(ctx, ep, target, name, qtype)
+		}(i, target)
+	}
+	wg.Wait()
+
+	problems = append(problems, comparePropagation(results)...)
+	if len(targets) == 0 && len(problems) == 0 {
+		problems = append(problems, "no resolvers to query")
+	}
+
+	agreeing := 0
+	responseTime := 0
+	for _, result := range results {
+		if result.Agrees {
+			agreeing++
+		}
+		if result.ResponseTime > responseTime {
+			responseTime = result.ResponseTime
+		}
+	}
+
+	now := time.Now()
+	errorMessage := strings.Join(problems, "; ")
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         agreeing, // Resolvers agreeing with the consensus
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		CheckedAt:    now,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+	for i := range results {
+		results[i].StatusID = status.ID
+		results[i].CheckedAt = now
+		result.Details = append(result.Details, &results[i])
+	}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ DNS propagation check PASSED for %s (%s) - %d resolvers agree", ep.URL, ep.DNSRecordType, agreeing)
+	} else {
+		log.Printf("✗ DNS propagation check FAILED for %s (%s): %s", ep.URL, ep.DNSRecordType, errorMessage)
+	}
+	return result
+}
+
+func queryResolver(ctx context.Context, ep Endpoint, target dnsTarget, name string, qtype uint16) models.DNSResolverResult {
+	result := models.DNSResolverResult{
+		ID:            uuid.New().String(),
+		EndpointID:    ep.ID,
+		Resolver:      target.address,
+		Nameserver:    target.nameserver,
+		Authoritative: target.authoritative,
+		Answers:       models.StringArray{},
+	}
+	if target.err != "" {
+		result.ErrorMessage = target.err
+		return result
+	}
+
+	resp, rtt, err := queryDNS(ctx, ep, target.address, name, qtype)
+	result.ResponseTime = int(rtt.Milliseconds())
+	if err != nil {
+		result.ErrorMessage = err.Error()
+		return result
+	}
+	switch {
+	case resp.Rcode == dns.RcodeNameError:
+		// NXDOMAIN is an answer too, a record that's gone everywhere but one resolver should show up
+		result.Answers = models.StringArray{"NXDOMAIN"}
+	case resp.Rcode != dns.RcodeSuccess:
+		result.ErrorMessage = dns.RcodeToString[resp.Rcode]
+		return result
+	default:
+		result.Answers = models.StringArray(recordData(resp.Answer))
+	}
+	if target.authoritative && !resp.Authoritative {
+		result.ErrorMessage = "lame delegation: answer not authoritative"
+		return result
+	}
+
+	// The serial rides along in the authority section of negative answers, ask for it otherwise
+	if result.SOASerial = soaSerial(resp); result.SOASerial == 0 {
+		if soaResp, _, err := queryDNS(ctx, ep, target.address, name, dns.TypeSOA); err == nil {
+			result.SOASerial = soaSerial(soaResp)
+		}
+	}
+	return result
+}
+
+// comparePropagation marks which results agree with the consensus answer and which serve a
+// stale SOA serial, returning a description of every resolver that's out of line
+func comparePropagation(results []models.DNSResolverResult) []string {
+	// Authoritative servers are the source of truth when they were asked, otherwise the majority wins
+	consensus, best := "", 0
+	for _, authoritativeOnly := range []bool{true, false} {
+		counts := make(map[string]int)
+		for _, result := range results {
+			if result.ErrorMessage != "" || (authoritativeOnly && !result.Authoritative) {
+				continue
+			}
+			key := strings.Join(result.Answers, "\n")
+			counts[key]++
+			if counts[key] > best {
+				consensus, best = key, counts[key]
+			}
+		}
+		if best > 0 {
+			break
+		}
+	}
+
+	var newest uint32
+	for _, result := range results {
+		if result.ErrorMessage == "" && result.SOASerial > newest {
+			newest = result.SOASerial
+		}
+	}
+
+	var problems []string
+	for i := range results {
+		result := &results[i]
+		label := result.Resolver
+		if result.Nameserver != "" {
+			label = fmt.Sprintf("%s (%s)", strings.TrimSuffix(result.Nameserver, "."), result.Resolver)
+		}
+		if result.ErrorMessage != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", label, result.ErrorMessage))
+			continue
+		}
+		result.Agrees = strings.Join(result.Answers, "\n") == consensus
+		if !result.Agrees {
+			problems = append(problems, fmt.Sprintf("%s disagrees: %s", label, answersSummary(result.Answers)))
+		}
+		if result.SOASerial != 0 && result.SOASerial < newest {
+			result.StaleSerial = true
+			problems = append(problems, fmt.Sprintf("%s has stale SOA serial %d (newest %d)", label, result.SOASerial, newest))
+		}
+	}
+	return problems
+}
+
+func answersSummary(answers []string) string {
+	if len(answers) == 0 {
+		return "no records"
+	}
+	return strings.Join(answers, ", ")
+}
+
+// findNameservers looks up the NS records of the closest zone enclosing name and resolves the
+// addresses of each nameserver, restricted to the endpoint's address family
+func findNameservers(ctx context.Context, ep Endpoint, name string) ([]dnsTarget, error) {
+	resolver := ""
+	if len(ep.DNSResolvers) > 0 {
+		resolver = resolverAddress(ep.DNSResolvers[0])
+	} else {
+		var err error
+		if resolver, err = systemResolver(); err != nil {
+			return nil, fmt.Errorf("finding nameservers: %v", err)
+		}
+	}
+
+	var hosts []string
+	zone := name
+	for {
+		resp, _, err := queryDNS(ctx, ep, resolver, zone, dns.TypeNS)
+		if err != nil {
+			return nil, fmt.Errorf("NS lookup for %s: %v", zone, err)
+		}
+		for _, rr := range resp.Answer {
+			if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+				hosts = append(hosts, ns.Ns)
+			}
+		}
+		if len(hosts) > 0 {
+			break
+		}
+		next, end := dns.NextLabel(zone, 0)
+		if end {
+			return nil, fmt.Errorf("no NS records found for %s or its parents", name)
+		}
+		zone = zone[next:]
+	}
+
+	qtypes := []uint16{dns.TypeA}
+	switch ep.AddressFamily {
+	case models.AddressFamilyIPv6:
+		qtypes = []uint16{dns.TypeAAAA}
+	case models.AddressFamilyBoth:
+		qtypes = []uint16{dns.TypeA, dns.TypeAAAA}
+	}
+
+	var targets []dnsTarget
+	for _, host := range hosts {
+		found := false
+		for _, qtype := range qtypes {
+			resp, _, err := queryDNS(ctx, ep, resolver, host, qtype)
+			if err != nil {
+				continue
+			}
+			for _, rr := range resp.Answer {
+				var ip string
+				switch rr := rr.(type) {
+				case *dns.A:
+					ip = rr.A.String()
+				case *dns.AAAA:
+					ip = rr.AAAA.String()
+				default:
+					continue
+				}
+				found = true
+				targets = append(targets, dnsTarget{address: resolverAddress(ip), nameserver: host, authoritative: true})
+			}
+		}
+		if !found {
+			// Keep the nameserver in the results so a dangling NS record is reported
+			targets = append(targets, dnsTarget{nameserver: host, authoritative: true, err: "nameserver has no address records"})
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/monty/models"
+)
+
+// startDNSServer serves records (and the RRSIGs covering them) over UDP on addr, answering
+// NODATA with the zone's SOA when nothing matches, and returns the address it listens on
+func startDNSServer(t *testing.T, addr string, authoritative bool, records ...string) string {
+	t.Helper()
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("bad test record %q: %v", record, err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = authoritative
+		q := r.Question[0]
+		for _, rr := range rrs {
+			sig, isSig := rr.(*dns.RRSIG)
+			if strings.EqualFold(rr.Header().Name, q.Name) && (rr.Header().Rrtype == q.Qtype || isSig && sig.TypeCovered == q.Qtype) {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if len(m.Answer) == 0 {
+			for _, rr := range rrs {
+				if rr.Header().Rrtype == dns.TypeSOA {
+					m.Ns = append(m.Ns, rr)
+				}
+			}
+		}
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("listen %s: %v", addr, err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func soaRecord(serial string) string {
+	return "example.test. 300 IN SOA ns1.example.test. admin.example.test. " + serial + " 3600 600 86400 300"
+}
+
+func TestDNSPropagationDisagreement(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	current := startDNSServer(t, "127.0.0.1:0", false, "www.example.test. 60 IN A 192.0.2.1", soaRecord("2024010102"))
+	alsoCurrent := startDNSServer(t, "127.0.0.1:0", false, "www.example.test. 30 IN A 192.0.2.1", soaRecord("2024010102"))
+	stale := startDNSServer(t, "127.0.0.1:0", false, "www.example.test. 60 IN A 192.0.2.9", soaRecord("2024010101"))
+
+	ep := Endpoint{
+		ID:            uuid.New().String(),
+		CheckType:     "dns_propagation",
+		URL:           "www.example.test",
+		DNSRecordType: "A",
+		DNSResolvers:  []string{current, alsoCurrent, stale},
+		Timeout:       2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.Code != 2 {
+		t.Errorf("expected 2 agreeing resolvers, got %d", status.Code)
+	}
+	if !strings.Contains(status.ErrorMessage, stale+" disagrees: A 192.0.2.9") ||
+		!strings.Contains(status.ErrorMessage, stale+" has stale SOA serial 2024010101") {
+		t.Errorf("expected the stale resolver to be reported, got %q", status.ErrorMessage)
+	}
+
+	var results []models.DNSResolverResult
+	db.Where("status_id = ?", status.ID).Find(&results)
+	if len(results) != 3 {
+		t.Fatalf("expected a result per resolver, got %d", len(results))
+	}
+	for _, result := range results {
+		isStale := result.Resolver == stale
+		if result.Agrees == isStale || result.StaleSerial != isStale {
+			t.Errorf("unexpected result for %s: %+v", result.Resolver, result)
+		}
+		if isStale && result.SOASerial != 2024010101 {
+			t.Errorf("expected serial recorded, got %d", result.SOASerial)
+		}
+	}
+}
+
+func TestDNSPropagationAuthoritative(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	// Both nameservers have to listen on the same port, which stands in for 53
+	ns1 := startDNSServer(t, "127.0.0.1:0", true, "www.example.test. 60 IN A 192.0.2.1", soaRecord("2024010102"))
+	_, port, _ := net.SplitHostPort(ns1)
+	startDNSServer(t, "127.0.0.2:"+port, false, "www.example.test. 60 IN A 192.0.2.1", soaRecord("2024010102"))
+	original := dnsPort
+	dnsPort = port
+	defer func() { dnsPort = original }()
+
+	resolver := startDNSServer(t, "127.0.0.1:0", false,
+		"www.example.test. 60 IN A 192.0.2.1",
+		"example.test. 300 IN NS ns1.example.test.",
+		"example.test. 300 IN NS ns2.example.test.",
+		"ns1.example.test. 300 IN A 127.0.0.1",
+		"ns2.example.test. 300 IN A 127.0.0.2",
+		soaRecord("2024010102"),
+	)
+
+	ep := Endpoint{
+		ID:                    uuid.New().String(),
+		CheckType:             "dns_propagation",
+		URL:                   "https://www.example.test/",
+		DNSRecordType:         "A",
+		DNSResolvers:          []string{resolver},
+		DNSCheckAuthoritative: true,
+		Timeout:               2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.Code != 2 {
+		t.Errorf("expected the resolver and ns1 to agree, got %d", status.Code)
+	}
+	want := "ns2.example.test (127.0.0.2:" + port + "): lame delegation: answer not authoritative"
+	if status.ErrorMessage != want {
+		t.Errorf("expected %q, got %q", want, status.ErrorMessage)
+	}
+
+	var results []models.DNSResolverResult
+	db.Where("status_id = ? AND authoritative = ?", status.ID, true).Find(&results)
+	if len(results) != 2 {
+		t.Fatalf("expected both nameservers queried, got %d", len(results))
+	}
+}
+
+func TestDNSName(t *testing.T) {
+	for in, want := range map[string]string{
+		"example.com":                  "example.com.",
+		"https://WWW.Example.com/path": "www.example.com.",
+		"http://example.com:8080?x=1":  "example.com.",
+	} {
+		if got := dnsName(in); got != want {
+			t.Errorf("dnsName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/monty/models"
+)
+
+// CheckDNSSECEndpoint validates the chain of trust from the endpoint's trust anchor down to the
+// queried record and fails when it's broken or a signature along the way is about to expire
+func (w *Worker) CheckDNSSECEndpoint(ctx context.Context, ep Endpoint) Result {
+	start := time.Now()
+	validator := &dnssecValidator{ctx: ctx, ep: ep, now: start}
+	answers, err := validator.validate()
+	responseTime := int(time.Since(start).Milliseconds())
+
+	var problems []string
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	// Warn ahead of the earliest signature lapsing, the way MinDaysValid works for certificates
+	var earliest *models.DNSSECSignature
+	for i := range validator.signatures {
+		if earliest == nil || validator.signatures[i].Expiration.Before(earliest.Expiration) {
+			earliest = &validator.signatures[i]
+		}
+	}
+	if earliest != nil && earliest.DaysUntilExpiry < ep.DNSSECMinDaysValid {
+		problems = append(problems, fmt.Sprintf("RRSIG on %s %s expires in %d days (%s)",
+			earliest.Owner, earliest.TypeCovered, earliest.DaysUntilExpiry, earliest.Expiration.Format(time.RFC3339)))
+	}
+
+	errorMessage := strings.Join(problems, "; ")
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         len(answers), // Use answer count as "code", like plain DNS checks
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		CheckedAt:    start,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+	for i := range validator.signatures {
+		validator.signatures[i].StatusID = status.ID
+		result.Details = append(result.Details, &validator.signatures[i])
+	}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ DNSSEC check PASSED for %s (%s) - %d answers, %d signatures verified", ep.URL, ep.DNSRecordType, len(answers), len(validator.signatures))
+	} else {
+		log.Printf("✗ DNSSEC check FAILED for %s (%s): %s", ep.URL, ep.DNSRecordType, errorMessage)
+	}
+	return result
+}
+
+// dnssecValidator walks the delegation chain from a trust anchor to a name, collecting every
+// signature it verifies on the way. Denial of existence (NSEC/NSEC3) is not validated, a
+// missing DS is taken at face value and reported as an insecure delegation
+type dnssecValidator struct {
+	ctx        context.Context // the check's, ends the validator's queries when cancelled
+	ep         Endpoint
+	now        time.Time
+	server     string
+	signatures []models.DNSSECSignature
+}
+
+// validate returns the validated answers for the endpoint's record
+func (v *dnssecValidator) validate() ([]string, error) {
+	if len(v.ep.DNSResolvers) > 0 {
+		v.server = resolverAddress(v.ep.DNSResolvers[0])
+	} else {
+		var err error
+		if v.server, err = systemResolver(); err != nil {
+			return nil, err
+		}
+	}
+
+	anchorText := v.ep.DNSSECTrustAnchor
+	if anchorText == "" {
+		anchorText = models.DefaultDNSSECTrustAnchor
+	}
+	anchor, err := models.ParseTrustAnchor(anchorText)
+	if err != nil {
+		return nil, err
+	}
+
+	name := dnsName(v.ep.URL)
+	if !dns.IsSubDomain(anchor.Zone, name) {
+		return nil, fmt.Errorf("%s is not under trust anchor %s", name, anchor.Zone)
+	}
+
+	zone := anchor.Zone
+	keys, err := v.zoneKeys(zone, anchor.DS, anchor.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step down one label at a time, following each signed delegation
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(zone) - 1; i >= 0; i-- {
+		child := dns.Fqdn(strings.Join(labels[i:], "."))
+		dsSet, dsSigs, err := v.fetch(child, dns.TypeDS)
+		if err != nil {
+			return nil, err
+		}
+		if len(dsSet) == 0 {
+			apex, _, err := v.fetch(child, dns.TypeSOA)
+			if err != nil {
+				return nil, err
+			}
+			if len(apex) > 0 {
+				return nil, fmt.Errorf("insecure delegation: %s has no DS record in %s", child, zone)
+			}
+			continue // Not a zone cut, child is still inside zone
+		}
+		if err := v.verify(dsSet, dsSigs, keys); err != nil {
+			return nil, err
+		}
+		ds := make([]*dns.DS, 0, len(dsSet))
+		for _, rr := range dsSet {
+			ds = append(ds, rr.(*dns.DS))
+		}
+		if keys, err = v.zoneKeys(child, ds, nil); err != nil {
+			return nil, err
+		}
+		zone = child
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(v.ep.DNSRecordType)]
+	if !ok {
+		qtype = dns.TypeA
+	}
+	rrset, sigs, err := v.fetch(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if len(rrset) == 0 {
+		return nil, fmt.Errorf("no %s records for %s", dns.TypeToString[qtype], name)
+	}
+	if err := v.verify(rrset, sigs, keys); err != nil {
+		return nil, err
+	}
+	return recordData(rrset), nil
+}
+
+// zoneKeys fetches a zone's DNSKEY set and returns it once a key matching one of the trusted DS
+// records (or one of the trusted keys) is found to have signed it
+func (v *dnssecValidator) zoneKeys(zone string, trustedDS []*dns.DS, trustedKeys []*dns.DNSKEY) ([]*dns.DNSKEY, error) {
+	rrset, sigs, err := v.fetch(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	if len(rrset) == 0 {
+		return nil, fmt.Errorf("no DNSKEY records for %s", zone)
+	}
+
+	keys := make([]*dns.DNSKEY, 0, len(rrset))
+	var entryKeys []*dns.DNSKEY
+	for _, rr := range rrset {
+		key := rr.(*dns.DNSKEY)
+		keys = append(keys, key)
+		if keyTrusted(key, trustedDS, trustedKeys) {
+			entryKeys = append(entryKeys, key)
+		}
+	}
+	if len(entryKeys) == 0 {
+		return nil, fmt.Errorf("no DNSKEY for %s matches its DS records", zone)
+	}
+	if err := v.verify(rrset, sigs, entryKeys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func keyTrusted(key *dns.DNSKEY, trustedDS []*dns.DS, trustedKeys []*dns.DNSKEY) bool {
+	for _, ds := range trustedDS {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+			return true
+		}
+	}
+	for _, trusted := range trustedKeys {
+		if trusted.Algorithm == key.Algorithm && trusted.PublicKey == key.PublicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks that one of sigs over rrset was made by one of keys and is currently valid,
+// recording the signature that was used
+func (v *dnssecValidator) verify(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	header := rrset[0].Header()
+	what := fmt.Sprintf("%s %s", header.Name, dns.TypeToString[header.Rrtype])
+
+	reason := "no RRSIG"
+	for _, sig := range sigs {
+		for _, key := range keys {
+			if sig.KeyTag != key.KeyTag() || sig.Algorithm != key.Algorithm || !strings.EqualFold(sig.SignerName, key.Hdr.Name) {
+				continue
+			}
+			if err := sig.Verify(key, rrset); err != nil {
+				reason = fmt.Sprintf("bad signature by key %d: %v", sig.KeyTag, err)
+				continue
+			}
+			if !sig.ValidityPeriod(v.now) {
+				reason = fmt.Sprintf("signature by key %d outside its validity period %s - %s", sig.KeyTag,
+					signatureTime(sig.Inception).Format(time.RFC3339), signatureTime(sig.Expiration).Format(time.RFC3339))
+				continue
+			}
+			v.record(sig)
+			return nil
+		}
+		if reason == "no RRSIG" {
+			reason = "no RRSIG by a trusted key"
+		}
+	}
+	return fmt.Errorf("%s: %s", what, reason)
+}
+
+func (v *dnssecValidator) record(sig *dns.RRSIG) {
+	expiration := signatureTime(sig.Expiration)
+	v.signatures = append(v.signatures, models.DNSSECSignature{
+		ID:              uuid.New().String(),
+		EndpointID:      v.ep.ID,
+		Owner:           sig.Hdr.Name,
+		TypeCovered:     dns.TypeToString[sig.TypeCovered],
+		SignerName:      sig.SignerName,
+		KeyTag:          sig.KeyTag,
+		Algorithm:       dns.AlgorithmToString[sig.Algorithm],
+		Inception:       signatureTime(sig.Inception),
+		Expiration:      expiration,
+		DaysUntilExpiry: int(expiration.Sub(v.now).Hours() / 24),
+		CheckedAt:       v.now,
+	})
+}
+
+// signatureTime converts an RRSIG timestamp, unsigned seconds since the epoch until they wrap in 2106
+func signatureTime(t uint32) time.Time {
+	return time.Unix(int64(t), 0).UTC()
+}
+
+// fetch returns the RRset of qtype owned by name together with the RRSIGs covering it, asking for
+// DNSSEC records and disabling the resolver's own validation so broken chains can be diagnosed
+func (v *dnssecValidator) fetch(name string, qtype uint16) ([]dns.RR, []*dns.RRSIG, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.SetEdns0(4096, true)
+	msg.CheckingDisabled = true
+
+	resp, _, err := exchangeDNS(v.ctx, v.ep, v.server, msg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s query: %v", name, dns.TypeToString[qtype], err)
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, nil, fmt.Errorf("%s %s query: %s", name, dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])
+	}
+
+	var rrset []dns.RR
+	var sigs []*dns.RRSIG
+	for _, rr := range resp.Answer {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if sig.TypeCovered == qtype {
+				sigs = append(sigs, sig)
+			}
+		} else if rr.Header().Rrtype == qtype {
+			rrset = append(rrset, rr)
+		}
+	}
+	return rrset, sigs, nil
+}
@@ -0,0 +1,191 @@
+package worker
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/monty/models"
+)
+
+type testZoneKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newTestZoneKey(t *testing.T, zone string) testZoneKey {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return testZoneKey{key: key, signer: priv.(crypto.Signer)}
+}
+
+// sign returns the records of rrset followed by their RRSIG, all in zone file format
+func (k testZoneKey) sign(t *testing.T, expiration time.Time, rrset ...dns.RR) []string {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrset[0].Header().Ttl},
+		KeyTag:     k.key.KeyTag(),
+		SignerName: k.key.Hdr.Name,
+		Algorithm:  k.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := sig.Sign(k.signer, rrset); err != nil {
+		t.Fatalf("sign %s: %v", rrset[0].Header().Name, err)
+	}
+	records := make([]string, 0, len(rrset)+1)
+	for _, rr := range rrset {
+		records = append(records, rr.String())
+	}
+	return append(records, sig.String())
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("bad test record %q: %v", s, err)
+	}
+	return rr
+}
+
+type signedZoneOptions struct {
+	recordExpiration time.Time
+	omitDS           bool
+}
+
+// startSignedZone serves test. delegating to example.test., both signed, and returns the
+// resolver address and a trust anchor for test.
+func startSignedZone(t *testing.T, opts signedZoneOptions) (string, string) {
+	parent := newTestZoneKey(t, "test.")
+	child := newTestZoneKey(t, "example.test.")
+	expiration := time.Now().Add(30 * 24 * time.Hour)
+
+	var records []string
+	records = append(records, parent.sign(t, expiration, parent.key)...)
+	if !opts.omitDS {
+		records = append(records, parent.sign(t, expiration, child.key.ToDS(dns.SHA256))...)
+	}
+	records = append(records, child.sign(t, expiration, child.key)...)
+	records = append(records, soaRecord("2024010101"))
+	records = append(records, child.sign(t, opts.recordExpiration, mustRR(t, "www.example.test. 300 IN A 192.0.2.1"))...)
+
+	return startDNSServer(t, "127.0.0.1:0", true, records...), parent.key.ToDS(dns.SHA256).String()
+}
+
+func TestDNSSECValidChain(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	resolver, anchor := startSignedZone(t, signedZoneOptions{recordExpiration: time.Now().Add(10 * 24 * time.Hour)})
+	ep := Endpoint{
+		ID:                 uuid.New().String(),
+		URL:                "www.example.test",
+		CheckType:          "dns",
+		DNSRecordType:      "A",
+		DNSResolvers:       []string{resolver},
+		DNSSEC:             true,
+		DNSSECTrustAnchor:  anchor,
+		DNSSECMinDaysValid: 3,
+		Timeout:            2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.ErrorMessage != "" || status.Code != 1 {
+		t.Fatalf("expected a validated answer, got code %d: %s", status.Code, status.ErrorMessage)
+	}
+
+	var signatures []models.DNSSECSignature
+	db.Where("status_id = ?", status.ID).Order("expiration").Find(&signatures)
+	if len(signatures) != 4 {
+		t.Fatalf("expected DNSKEY, DS, DNSKEY and A signatures, got %d", len(signatures))
+	}
+	if signatures[0].TypeCovered != "A" || signatures[0].DaysUntilExpiry != 9 {
+		t.Errorf("expected the A signature to expire first in 9 days, got %+v", signatures[0])
+	}
+}
+
+func TestDNSSECFailures(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	cases := []struct {
+		name string
+		opts signedZoneOptions
+		want string
+	}{
+		{"expiring signature", signedZoneOptions{recordExpiration: time.Now().Add(36 * time.Hour)}, "RRSIG on www.example.test. A expires in 1 days"},
+		{"expired signature", signedZoneOptions{recordExpiration: time.Now().Add(-time.Minute)}, "www.example.test. A: signature by key"},
+		{"insecure delegation", signedZoneOptions{recordExpiration: time.Now().Add(10 * 24 * time.Hour), omitDS: true}, "insecure delegation: example.test. has no DS record in test."},
+	}
+	for _, c := range cases {
+		resolver, anchor := startSignedZone(t, c.opts)
+		ep := Endpoint{
+			ID:                 uuid.New().String(),
+			CheckType:          "dns",
+			URL:                "www.example.test",
+			DNSRecordType:      "A",
+			DNSResolvers:       []string{resolver},
+			DNSSEC:             true,
+			DNSSECTrustAnchor:  anchor,
+			DNSSECMinDaysValid: 3,
+			Timeout:            2 * time.Second,
+		}
+		w.runCheck(context.Background(), ep)
+
+		var status models.Status
+		if err := db.First(&status, "endpoint_id = ?", ep.ID).Error; err != nil {
+			t.Fatalf("%s: expected status saved: %v", c.name, err)
+		}
+		if !strings.Contains(status.ErrorMessage, c.want) {
+			t.Errorf("%s: expected %q in %q", c.name, c.want, status.ErrorMessage)
+		}
+	}
+
+	// A trust anchor for some other key breaks the chain at the top
+	resolver, _ := startSignedZone(t, signedZoneOptions{recordExpiration: time.Now().Add(10 * 24 * time.Hour)})
+	other := newTestZoneKey(t, "test.")
+	ep := Endpoint{
+		ID:                uuid.New().String(),
+		CheckType:         "dns",
+		URL:               "www.example.test",
+		DNSResolvers:      []string{resolver},
+		DNSSEC:            true,
+		DNSSECTrustAnchor: other.key.ToDS(dns.SHA256).String(),
+		Timeout:           2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+	var status models.Status
+	db.First(&status, "endpoint_id = ?", ep.ID)
+	if status.ErrorMessage != "no DNSKEY for test. matches its DS records" {
+		t.Errorf("expected an anchor mismatch, got %q", status.ErrorMessage)
+	}
+}
+
+func TestParseTrustAnchor(t *testing.T) {
+	anchor, err := models.ParseTrustAnchor(models.DefaultDNSSECTrustAnchor)
+	if err != nil || anchor.Zone != "." || len(anchor.DS) != 2 {
+		t.Fatalf("expected the root anchors to parse, got %+v (%v)", anchor, err)
+	}
+	for _, bad := range []string{"", "example.com. IN A 192.0.2.1", ". IN DS 20326 8 2 E06D\nexample. IN DS 1 8 2 AB"} {
+		if _, err := models.ParseTrustAnchor(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
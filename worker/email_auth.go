@@ -0,0 +1,538 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/miekg/dns"
+	"github.com/monty/models"
+)
+
+// spfLookupLimit is the number of DNS-querying SPF terms a receiver evaluates before giving up (RFC 7208 4.6.4)
+const spfLookupLimit = 10
+
+// mtaSTSPolicyURL is where a domain's MTA-STS policy is published, %s being the domain
+var mtaSTSPolicyURL = "https://mta-sts.%s/.well-known/mta-sts.txt"
+
+// maxMTASTSPolicySize caps how much of an MTA-STS policy is read, RFC 8461 policies are tiny
+const maxMTASTSPolicySize = 64 * 1024
+
+// CheckEmailAuthEndpoint audits a domain's SPF, DKIM, DMARC, MTA-STS and TLS-RPT records and
+// stores every finding, failing the check when any of them is an error
+func (w *Worker) CheckEmailAuthEndpoint(ctx context.Context, ep Endpoint) Result {
+	start := time.Now()
+	audit := &emailAudit{ctx: ctx, ep: ep, domain: strings.TrimSuffix(dnsName(ep.URL), ".")}
+	err := audit.run()
+	responseTime := int(time.Since(start).Milliseconds())
+
+	var errors []string
+	if err != nil {
+		errors = append(errors, err.Error())
+	}
+	for _, finding := range audit.findings {
+		if finding.Severity == models.SeverityError {
+			errors = append(errors, fmt.Sprintf("%s: %s", finding.Record, finding.Message))
+		}
+	}
+
+	errorMessage := strings.Join(errors, "; ")
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         len(audit.findings), // Number of findings, errors or not
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		CheckedAt:    start,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+	for i := range audit.findings {
+		audit.findings[i].StatusID = status.ID
+		audit.findings[i].CheckedAt = start
+		result.Details = append(result.Details, &audit.findings[i])
+	}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ Email auth check PASSED for %s (%d findings)", audit.domain, len(audit.findings))
+	} else {
+		log.Printf("✗ Email auth check FAILED for %s: %s", audit.domain, errorMessage)
+	}
+	return result
+}
+
+type emailAudit struct {
+	ctx      context.Context // the check's, ends the audit's queries when cancelled
+	ep       Endpoint
+	domain   string
+	server   string
+	findings []models.EmailAuthFinding
+}
+
+func (a *emailAudit) add(record, name, severity, value, format string, args ...interface{}) {
+	a.findings = append(a.findings, models.EmailAuthFinding{
+		ID:         uuid.New().String(),
+		EndpointID: a.ep.ID,
+		Record:     record,
+		Name:       name,
+		Severity:   severity,
+		Message:    fmt.Sprintf(format, args...),
+		Value:      value,
+	})
+}
+
+func (a *emailAudit) run() error {
+	if len(a.ep.DNSResolvers) > 0 {
+		a.server = resolverAddress(a.ep.DNSResolvers[0])
+	} else {
+		var err error
+		if a.server, err = systemResolver(); err != nil {
+			return err
+		}
+	}
+
+	a.checkSPF()
+	for _, selector := range a.ep.DKIMSelectors {
+		a.checkDKIM(selector)
+	}
+	a.checkDMARC()
+	a.checkMTASTS()
+	a.checkTLSRPT()
+	return nil
+}
+
+// txtRecords returns the TXT records at name that start with the version tag prefix
+// (case-insensitively), each with its strings joined
+func (a *emailAudit) txtRecords(name, prefix string) ([]string, error) {
+	resp, _, err := queryDNS(a.ctx, a.ep, a.server, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("TXT lookup for %s: %s", name, dns.RcodeToString[resp.Rcode])
+	}
+	var records []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			record := strings.Join(txt.Txt, "")
+			if hasVersionPrefix(record, prefix) {
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+// hasVersionPrefix reports whether record starts with the version tag prefix, which has to end
+// there: "v=spf1" doesn't match "v=spf10"
+func hasVersionPrefix(record, prefix string) bool {
+	if len(record) < len(prefix) || !strings.EqualFold(record[:len(prefix)], prefix) {
+		return false
+	}
+	rest := record[len(prefix):]
+	return prefix == "" || rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == ';'
+}
+
+var emailRecordNames = map[string]string{
+	models.EmailRecordSPF:    "SPF",
+	models.EmailRecordDKIM:   "DKIM",
+	models.EmailRecordDMARC:  "DMARC",
+	models.EmailRecordMTASTS: "MTA-STS",
+	models.EmailRecordTLSRPT: "TLS-RPT",
+}
+
+// lookupOne fetches the single record a domain is allowed to publish at name, reporting
+// missing and duplicate records. The returned record is empty when there's nothing to parse
+func (a *emailAudit) lookupOne(record, name, prefix, missingSeverity string) string {
+	records, err := a.txtRecords(name, prefix)
+	switch {
+	case err != nil:
+		a.add(record, name, models.SeverityError, "", "lookup failed: %v", err)
+	case len(records) == 0:
+		a.add(record, name, missingSeverity, "", "no %s record published", emailRecordNames[record])
+	case len(records) > 1:
+		a.add(record, name, models.SeverityError, strings.Join(records, " | "), "%d %s records published, receivers treat that as an error", len(records), emailRecordNames[record])
+	default:
+		return records[0]
+	}
+	return ""
+}
+
+// parseTags splits a "k=v; k=v" record as used by DKIM, DMARC, MTA-STS and TLS-RPT
+func parseTags(record string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, dup := tags[key]; dup {
+			return nil, fmt.Errorf("duplicate tag %q", key)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+func (a *emailAudit) checkSPF() {
+	record := a.lookupOne(models.EmailRecordSPF, a.domain, "v=spf1", models.SeverityError)
+	if record == "" {
+		return
+	}
+
+	spf := &spfEvaluation{audit: a, path: map[string]bool{strings.ToLower(a.domain): true}}
+	all := spf.evaluate(a.domain, record)
+	if spf.lookups > spfLookupLimit {
+		a.add(models.EmailRecordSPF, a.domain, models.SeverityError, record,
+			"SPF needs %d DNS lookups, receivers give up after %d", spf.lookups, spfLookupLimit)
+	}
+
+	switch all {
+	case "+":
+		a.add(models.EmailRecordSPF, a.domain, models.SeverityError, record, "+all lets any host send mail for the domain")
+	case "?":
+		a.add(models.EmailRecordSPF, a.domain, models.SeverityWarning, record, "?all is neutral and doesn't protect the domain")
+	case "":
+		a.add(models.EmailRecordSPF, a.domain, models.SeverityWarning, record, "no all mechanism or redirect, unmatched senders are neutral")
+	}
+}
+
+// spfEvaluation walks an SPF record and everything it includes, counting DNS lookups. path
+// holds the domains currently being evaluated so include and redirect loops are caught
+type spfEvaluation struct {
+	audit   *emailAudit
+	lookups int
+	path    map[string]bool
+}
+
+// evaluate checks one SPF record and returns the qualifier of its all mechanism (or of the
+// record it redirects to), empty when there is none
+func (s *spfEvaluation) evaluate(domain, record string) string {
+	a := s.audit
+	all := ""
+	redirect := ""
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+		if strings.HasPrefix(lower, "redirect=") {
+			redirect = term[len("redirect="):]
+			s.lookups++
+			continue
+		}
+		if strings.HasPrefix(lower, "exp=") {
+			continue
+		}
+
+		qualifier := "+"
+		if strings.ContainsAny(lower[:1], "+-~?") {
+			qualifier, lower, term = lower[:1], lower[1:], term[1:]
+		}
+		name, arg, _ := strings.Cut(lower, ":")
+		if strings.Contains(name, "=") {
+			continue // Unknown modifiers are ignored by receivers
+		}
+		if slash := strings.Index(name, "/"); slash >= 0 {
+			name = name[:slash] // a/24, mx/24
+		}
+		switch name {
+		case "all":
+			all = qualifier
+		case "include":
+			s.lookups++
+			if arg == "" {
+				a.add(models.EmailRecordSPF, domain, models.SeverityError, record, "include without a domain")
+				continue
+			}
+			s.include(domain, arg)
+		case "a", "mx", "exists":
+			s.lookups++
+		case "ptr":
+			s.lookups++
+			a.add(models.EmailRecordSPF, domain, models.SeverityWarning, record, "ptr mechanism is deprecated and slow for receivers")
+		case "ip4", "ip6":
+			if _, _, err := net.ParseCIDR(arg); err != nil && net.ParseIP(arg) == nil {
+				a.add(models.EmailRecordSPF, domain, models.SeverityError, record, "invalid address in %q", term)
+			}
+		default:
+			a.add(models.EmailRecordSPF, domain, models.SeverityError, record, "unknown mechanism %q", term)
+		}
+	}
+
+	if redirect != "" && all == "" {
+		// redirect is ignored when the record has an all mechanism
+		target := strings.ToLower(strings.TrimSuffix(redirect, "."))
+		if s.path[target] {
+			a.add(models.EmailRecordSPF, domain, models.SeverityError, record, "redirect loop through %s", redirect)
+			return all
+		}
+		records, err := a.txtRecords(target, "v=spf1")
+		if err != nil || len(records) != 1 {
+			a.add(models.EmailRecordSPF, domain, models.SeverityError, record, "redirect=%s doesn't lead to exactly one SPF record", redirect)
+			return all
+		}
+		s.path[target] = true
+		defer delete(s.path, target)
+		return s.evaluate(target, records[0])
+	}
+	return all
+}
+
+func (s *spfEvaluation) include(domain, target string) {
+	a := s.audit
+	key := strings.ToLower(strings.TrimSuffix(target, "."))
+	if s.path[key] {
+		a.add(models.EmailRecordSPF, domain, models.SeverityError, "", "include loop through %s", target)
+		return
+	}
+	s.path[key] = true
+	defer delete(s.path, key)
+	records, err := a.txtRecords(target, "v=spf1")
+	switch {
+	case err != nil:
+		a.add(models.EmailRecordSPF, target, models.SeverityError, "", "include:%s lookup failed: %v", target, err)
+	case len(records) != 1:
+		a.add(models.EmailRecordSPF, target, models.SeverityError, "", "include:%s has %d SPF records, it needs exactly one", target, len(records))
+	default:
+		s.evaluate(target, records[0])
+	}
+}
+
+func (a *emailAudit) checkDKIM(selector string) {
+	name := selector + "._domainkey." + a.domain
+	record := a.lookupOne(models.EmailRecordDKIM, name, "", models.SeverityError) // v=DKIM1 is optional
+	if record == "" {
+		return
+	}
+	tags, err := parseTags(record)
+	if err != nil {
+		a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "syntax error: %v", err)
+		return
+	}
+
+	if strings.Contains(tags["t"], "y") {
+		a.add(models.EmailRecordDKIM, name, models.SeverityWarning, record, "selector %s is in testing mode (t=y)", selector)
+	}
+	keyData, ok := tags["p"]
+	if !ok {
+		a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s has no p= public key", selector)
+		return
+	}
+	if keyData == "" {
+		a.add(models.EmailRecordDKIM, name, models.SeverityWarning, record, "selector %s key has been revoked", selector)
+		return
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(keyData), ""))
+	if err != nil {
+		a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s public key isn't valid base64", selector)
+		return
+	}
+
+	switch keyType := strings.ToLower(tags["k"]); keyType {
+	case "", "rsa":
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			if pub, err = x509.ParsePKCS1PublicKey(der); err != nil {
+				a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s public key can't be parsed: %v", selector, err)
+				return
+			}
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s key isn't RSA as k= says", selector)
+			return
+		}
+		bits := rsaKey.N.BitLen()
+		if bits < 1024 {
+			a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s uses a %d-bit RSA key, receivers ignore keys under 1024 bits", selector, bits)
+		} else if bits < 2048 {
+			a.add(models.EmailRecordDKIM, name, models.SeverityWarning, record, "selector %s uses a %d-bit RSA key, 2048 bits is recommended", selector, bits)
+		}
+	case "ed25519":
+		if len(der) != 32 {
+			a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s Ed25519 key is %d bytes, expected 32", selector, len(der))
+		}
+	default:
+		a.add(models.EmailRecordDKIM, name, models.SeverityError, record, "selector %s has unknown key type %q", selector, keyType)
+	}
+}
+
+func (a *emailAudit) checkDMARC() {
+	name := "_dmarc." + a.domain
+	record := a.lookupOne(models.EmailRecordDMARC, name, "v=DMARC1", models.SeverityError)
+	if record == "" {
+		return
+	}
+	tags, err := parseTags(record)
+	if err != nil {
+		a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "syntax error: %v", err)
+		return
+	}
+
+	policy := strings.ToLower(tags["p"])
+	switch policy {
+	case "reject":
+	case "quarantine":
+		a.add(models.EmailRecordDMARC, name, models.SeverityInfo, record, "policy is quarantine, reject gives the strongest protection")
+	case "none":
+		a.add(models.EmailRecordDMARC, name, models.SeverityWarning, record, "policy is none, spoofed mail is only reported")
+	case "":
+		a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "p= policy is missing")
+	default:
+		a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "unknown policy p=%s", tags["p"])
+	}
+
+	if sp, ok := tags["sp"]; ok {
+		switch strings.ToLower(sp) {
+		case "none":
+			if policy != "none" {
+				a.add(models.EmailRecordDMARC, name, models.SeverityWarning, record, "subdomain policy sp=none leaves subdomains open to spoofing")
+			}
+		case "quarantine", "reject":
+		default:
+			a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "unknown subdomain policy sp=%s", sp)
+		}
+	}
+	if pct, ok := tags["pct"]; ok {
+		n, err := strconv.Atoi(pct)
+		if err != nil || n < 0 || n > 100 {
+			a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "pct=%s isn't a percentage", pct)
+		} else if n < 100 {
+			a.add(models.EmailRecordDMARC, name, models.SeverityWarning, record, "policy only applies to %d%% of failing mail", n)
+		}
+	}
+	if rua, ok := tags["rua"]; !ok {
+		a.add(models.EmailRecordDMARC, name, models.SeverityWarning, record, "no rua= address, aggregate reports aren't collected")
+	} else {
+		for _, uri := range strings.Split(rua, ",") {
+			uri = strings.TrimSpace(uri)
+			if !strings.HasPrefix(strings.ToLower(uri), "mailto:") {
+				a.add(models.EmailRecordDMARC, name, models.SeverityError, record, "rua %s must be a mailto: URI", uri)
+			}
+		}
+	}
+}
+
+func (a *emailAudit) checkMTASTS() {
+	name := "_mta-sts." + a.domain
+	record := a.lookupOne(models.EmailRecordMTASTS, name, "v=STSv1", models.SeverityInfo)
+	if record == "" {
+		return
+	}
+	tags, err := parseTags(record)
+	if err != nil {
+		a.add(models.EmailRecordMTASTS, name, models.SeverityError, record, "syntax error: %v", err)
+		return
+	}
+	if tags["id"] == "" {
+		a.add(models.EmailRecordMTASTS, name, models.SeverityError, record, "id= is missing, senders won't notice policy updates")
+	}
+
+	policyURL := fmt.Sprintf(mtaSTSPolicyURL, a.domain)
+	policy, err := a.fetchMTASTSPolicy(policyURL)
+	if err != nil {
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityError, "", "policy unavailable: %v", err)
+		return
+	}
+
+	switch policy["mode"] {
+	case "enforce":
+	case "testing":
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityWarning, "", "policy is in testing mode, TLS failures are only reported")
+	case "none":
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityWarning, "", "policy mode is none")
+	default:
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityError, "", "policy has invalid mode %q", policy["mode"])
+	}
+	if policy["version"] != "STSv1" {
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityError, "", "policy version is %q, expected STSv1", policy["version"])
+	}
+	if policy["mx"] == "" && policy["mode"] != "none" {
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityError, "", "policy lists no mx patterns")
+	}
+	if maxAge, err := strconv.Atoi(policy["max_age"]); err != nil {
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityError, "", "policy max_age %q isn't a number", policy["max_age"])
+	} else if maxAge < 86400 {
+		a.add(models.EmailRecordMTASTS, policyURL, models.SeverityWarning, "", "policy max_age of %ds is under a day", maxAge)
+	}
+}
+
+// fetchMTASTSPolicy downloads and parses an MTA-STS policy, collecting repeated mx lines
+func (a *emailAudit) fetchMTASTSPolicy(policyURL string) (map[string]string, error) {
+	transport, _, err := newHTTPTransport(a.ep)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Timeout:   a.ep.Timeout,
+		Transport: transport,
+		// RFC 8461 3.3, policy fetches must not follow redirects
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodGet, policyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", policyURL, resp.Status)
+	}
+
+	policy := make(map[string]string)
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxMTASTSPolicySize))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "mx" && policy[key] != "" {
+			value = policy[key] + " " + value
+		}
+		policy[key] = value
+	}
+	return policy, scanner.Err()
+}
+
+func (a *emailAudit) checkTLSRPT() {
+	name := "_smtp._tls." + a.domain
+	record := a.lookupOne(models.EmailRecordTLSRPT, name, "v=TLSRPTv1", models.SeverityInfo)
+	if record == "" {
+		return
+	}
+	tags, err := parseTags(record)
+	if err != nil {
+		a.add(models.EmailRecordTLSRPT, name, models.SeverityError, record, "syntax error: %v", err)
+		return
+	}
+	rua := tags["rua"]
+	if rua == "" {
+		a.add(models.EmailRecordTLSRPT, name, models.SeverityError, record, "rua= is missing, reports have nowhere to go")
+		return
+	}
+	for _, uri := range strings.Split(rua, ",") {
+		uri = strings.ToLower(strings.TrimSpace(uri))
+		if !strings.HasPrefix(uri, "mailto:") && !strings.HasPrefix(uri, "https:") {
+			a.add(models.EmailRecordTLSRPT, name, models.SeverityError, record, "rua %s must be a mailto: or https: URI", uri)
+		}
+	}
+}
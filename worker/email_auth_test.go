@@ -0,0 +1,210 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// dkimRecord returns a DKIM TXT record for a fresh RSA key, split into strings short enough for a TXT record
+func dkimRecord(t *testing.T, name string, bits int) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	data := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	var chunks []string
+	for len(data) > 200 {
+		chunks = append(chunks, `"`+data[:200]+`"`)
+		data = data[200:]
+	}
+	chunks = append(chunks, `"`+data+`"`)
+	return name + " 300 IN TXT " + strings.Join(chunks, " ")
+}
+
+func startMTASTSPolicy(t *testing.T, policy string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, policy)
+	}))
+	t.Cleanup(srv.Close)
+	original := mtaSTSPolicyURL
+	mtaSTSPolicyURL = srv.URL + "/.well-known/mta-sts.txt?domain=%s"
+	t.Cleanup(func() { mtaSTSPolicyURL = original })
+}
+
+func emailAuthFindings(t *testing.T, ep Endpoint) (models.Status, []models.EmailAuthFinding) {
+	t.Helper()
+	status := latestStatus(t, ep.ID)
+	var findings []models.EmailAuthFinding
+	models.DB.Where("status_id = ?", status.ID).Find(&findings)
+	if status.Code != len(findings) {
+		t.Errorf("expected code to count the %d findings, got %d", len(findings), status.Code)
+	}
+	return status, findings
+}
+
+func TestEmailAuthHealthyDomain(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	startMTASTSPolicy(t, "version: STSv1\nmode: enforce\nmx: mx1.example.test\nmx: mx2.example.test\nmax_age: 604800\n")
+	resolver := startDNSServer(t, "127.0.0.1:0", false,
+		`example.test. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 include:_spf.mail.test -all"`,
+		`example.test. 300 IN TXT "google-site-verification=abc"`,
+		`_spf.mail.test. 300 IN TXT "v=spf1 ip6:2001:db8::/32 ~all"`,
+		dkimRecord(t, "mail._domainkey.example.test.", 2048),
+		`_dmarc.example.test. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:dmarc@example.test"`,
+		`_mta-sts.example.test. 300 IN TXT "v=STSv1; id=20240101"`,
+		`_smtp._tls.example.test. 300 IN TXT "v=TLSRPTv1; rua=mailto:tls@example.test"`,
+	)
+
+	ep := Endpoint{
+		ID:            uuid.New().String(),
+		CheckType:     "email_auth",
+		URL:           "example.test",
+		DNSResolvers:  []string{resolver},
+		DKIMSelectors: []string{"mail"},
+		Timeout:       2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status, findings := emailAuthFindings(t, ep)
+	if status.ErrorMessage != "" {
+		t.Errorf("expected a clean audit, got %q", status.ErrorMessage)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no findings, got %+v", findings)
+	}
+}
+
+func TestEmailAuthWeakDomain(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	startMTASTSPolicy(t, "version: STSv1\nmode: testing\nmx: mx.example.test\nmax_age: 3600\n")
+	resolver := startDNSServer(t, "127.0.0.1:0", false,
+		`example.test. 300 IN TXT "v=spf1 a mx include:one.test include:two.test foo:bar +all"`,
+		`one.test. 300 IN TXT "v=spf1 a mx ptr exists:%{i}.one.test include:two.test ?all"`,
+		`two.test. 300 IN TXT "v=spf1 a mx a:x.two.test mx:y.two.test -all"`,
+		dkimRecord(t, "old._domainkey.example.test.", 1024),
+		`revoked._domainkey.example.test. 300 IN TXT "v=DKIM1; p="`,
+		`_dmarc.example.test. 300 IN TXT "v=DMARC1; p=none; pct=50"`,
+		`_mta-sts.example.test. 300 IN TXT "v=STSv1; id=1"`,
+		`_smtp._tls.example.test. 300 IN TXT "v=TLSRPTv1"`,
+	)
+
+	ep := Endpoint{
+		ID:            uuid.New().String(),
+		CheckType:     "email_auth",
+		URL:           "https://example.test/",
+		DNSResolvers:  []string{resolver},
+		DKIMSelectors: []string{"old", "revoked", "missing"},
+		Timeout:       2 * time.Second,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status, findings := emailAuthFindings(t, ep)
+	for _, want := range []string{
+		`spf: unknown mechanism "foo:bar"`,
+		"spf: SPF needs 17 DNS lookups, receivers give up after 10",
+		"spf: +all lets any host send mail for the domain",
+		"dkim: no DKIM record published",
+		"tls_rpt: rua= is missing, reports have nowhere to go",
+	} {
+		if !strings.Contains(status.ErrorMessage, want) {
+			t.Errorf("expected %q in %q", want, status.ErrorMessage)
+		}
+	}
+
+	warnings := map[string]bool{}
+	for _, finding := range findings {
+		if finding.Severity == models.SeverityWarning {
+			warnings[finding.Message] = true
+		}
+	}
+	for _, want := range []string{
+		"ptr mechanism is deprecated and slow for receivers",
+		"selector old uses a 1024-bit RSA key, 2048 bits is recommended",
+		"selector revoked key has been revoked",
+		"policy is none, spoofed mail is only reported",
+		"policy only applies to 50% of failing mail",
+		"no rua= address, aggregate reports aren't collected",
+		"policy is in testing mode, TLS failures are only reported",
+		"policy max_age of 3600s is under a day",
+	} {
+		if !warnings[want] {
+			t.Errorf("expected warning %q, got %v", want, warnings)
+		}
+	}
+}
+
+func TestEmailAuthMissingRecords(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	resolver := startDNSServer(t, "127.0.0.1:0", false,
+		`example.test. 300 IN TXT "v=spf1 -all"`,
+		`example.test. 300 IN TXT "v=spf1 mx -all"`,
+		`loop.test. 300 IN TXT "v=spf1 include:loop.test -all"`,
+	)
+
+	ep := Endpoint{ID: uuid.New().String(), CheckType: "email_auth", URL: "example.test", DNSResolvers: []string{resolver}, Timeout: 2 * time.Second}
+	w.runCheck(context.Background(), ep)
+	status, findings := emailAuthFindings(t, ep)
+	want := "spf: 2 SPF records published, receivers treat that as an error; dmarc: no DMARC record published"
+	if status.ErrorMessage != want {
+		t.Errorf("expected %q, got %q", want, status.ErrorMessage)
+	}
+	// MTA-STS and TLS-RPT are optional, their absence is only informational
+	if len(findings) != 4 || findings[2].Severity != models.SeverityInfo || findings[3].Severity != models.SeverityInfo {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+
+	ep = Endpoint{ID: uuid.New().String(), CheckType: "email_auth", URL: "loop.test", DNSResolvers: []string{resolver}, Timeout: 2 * time.Second}
+	w.runCheck(context.Background(), ep)
+	status, _ = emailAuthFindings(t, ep)
+	if !strings.Contains(status.ErrorMessage, "spf: include loop through loop.test") {
+		t.Errorf("expected the include loop to be reported, got %q", status.ErrorMessage)
+	}
+}
+
+func TestEmailAuthVersionAndReportURIs(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	resolver := startDNSServer(t, "127.0.0.1:0", false,
+		`example.test. 300 IN TXT "v=spf1 -all"`,
+		`example.test. 300 IN TXT "v=spf10 +all"`,
+		`_dmarc.example.test. 300 IN TXT "v=DMARC1; p=reject; rua=mailto:dmarc@example.test, https://reports.example.test"`,
+	)
+
+	ep := Endpoint{ID: uuid.New().String(), CheckType: "email_auth", URL: "example.test", DNSResolvers: []string{resolver}, Timeout: 2 * time.Second}
+	w.runCheck(context.Background(), ep)
+	status, _ := emailAuthFindings(t, ep)
+	// v=spf10 isn't an SPF record, so it's neither a second one nor its +all
+	want := "dmarc: rua https://reports.example.test must be a mailto: URI"
+	if status.ErrorMessage != want {
+		t.Errorf("expected %q, got %q", want, status.ErrorMessage)
+	}
+}
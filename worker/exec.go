@@ -0,0 +1,272 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+var ErrExecNotAllowed = errors.New("exec command must be an absolute path inside one of EXEC_PLUGIN_DIRS")
+
+// execPluginDirs are the directories exec checks may run commands from. Without any, exec checks are
+// disabled, since anyone who can reach the API could otherwise run anything on the host
+var execPluginDirs = filepath.SplitList(os.Getenv("EXEC_PLUGIN_DIRS"))
+
+// maxPluginOutput caps how much of each of a plugin's stdout and stderr is kept
+const maxPluginOutput = 64 * 1024
+
+// execWaitDelay bounds how long a killed plugin's children may hold its output open
+var execWaitDelay = 2 * time.Second
+
+// perfValuePattern splits a perfdata value into its number and unit of measurement
+var perfValuePattern = regexp.MustCompile(`^([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)([a-zA-Z%]*)$`)
+
+// ExecCommandAllowed reports whether command may be run by exec checks
+func ExecCommandAllowed(command string) error {
+	if !filepath.IsAbs(command) {
+		return ErrExecNotAllowed
+	}
+	command = filepath.Clean(command)
+	for _, dir := range execPluginDirs {
+		if dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Clean(dir), command)
+		if err == nil && rel != "." && filepath.IsLocal(rel) {
+			return nil
+		}
+	}
+	return ErrExecNotAllowed
+}
+
+// CheckExecEndpoint runs a Nagios-compatible plugin and records its state as the status code, its
+// output, and its performance data as metrics. OK and WARNING pass, CRITICAL and UNKNOWN fail
+func (w *Worker) CheckExecEndpoint(ctx context.Context, ep Endpoint) Result {
+	start := time.Now()
+	code, output, perfdata, errorMessage := runPlugin(ctx, ep)
+	responseTime := int(time.Since(start).Milliseconds())
+
+	firstLine, _, _ := strings.Cut(output, "\n")
+	if errorMessage == "" && code != models.ExecOK && code != models.ExecWarning {
+		if firstLine == "" {
+			firstLine = "no output"
+		}
+		errorMessage = fmt.Sprintf("%s: %s", models.ExecStateNames[code], firstLine)
+	}
+
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         code, // Nagios state, 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		Output:       output,
+		CheckedAt:    start,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+	for _, metric := range parsePerfdata(perfdata) {
+		metric.ID = uuid.New().String()
+		metric.StatusID = status.ID
+		metric.EndpointID = ep.ID
+		metric.CheckedAt = start
+		result.Details = append(result.Details, &metric)
+	}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ Exec check PASSED for %s (%dms) - %s: %s", ep.URL, responseTime, models.ExecStateNames[code], firstLine)
+	} else {
+		log.Printf("✗ Exec check FAILED for %s: %s", ep.URL, errorMessage)
+	}
+	return result
+}
+
+// runPlugin runs the endpoint's command with a hard timeout and returns its Nagios state, its text
+// output (first line, then any long output) and its performance data. errorMessage is set when the
+// plugin couldn't be run to completion
+func runPlugin(ctx context.Context, ep Endpoint) (code int, output, perfdata, errorMessage string) {
+	if err := ExecCommandAllowed(ep.URL); err != nil {
+		return models.ExecUnknown, "", "", err.Error()
+	}
+	// Endpoints saved before the environment was restricted may still carry such entries
+	if err := models.ValidateExecEnv(ep.ExecEnv); err != nil {
+		return models.ExecUnknown, "", "", err.Error()
+	}
+
+	timeout := ep.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ep.URL, ep.ExecArgs...)
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, ep.ExecEnv...)
+	stdout := &cappedBuffer{limit: maxPluginOutput}
+	stderr := &cappedBuffer{limit: maxPluginOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = execWaitDelay
+
+	err := cmd.Run()
+	raw := stdout.String()
+	if strings.TrimSpace(raw) == "" {
+		raw = stderr.String() // Plugins are meant to write to stdout, but show something when they didn't
+	}
+	output, perfdata = splitPluginOutput(raw)
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		// Nagios treats plugin timeouts as CRITICAL by default
+		return models.ExecCritical, output, perfdata, fmt.Sprintf("CRITICAL: plugin timed out after %s", timeout)
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+		if code < 0 {
+			return models.ExecUnknown, output, perfdata, fmt.Sprintf("UNKNOWN: plugin %s", exitErr.ProcessState)
+		}
+		if code > models.ExecUnknown {
+			return models.ExecUnknown, output, perfdata, fmt.Sprintf("UNKNOWN: exit code %d is out of bounds", code)
+		}
+		return code, output, perfdata, ""
+	case err != nil:
+		return models.ExecUnknown, output, perfdata, fmt.Sprintf("UNKNOWN: %v", err)
+	}
+	return models.ExecOK, output, perfdata, ""
+}
+
+// splitPluginOutput separates plugin output into text and performance data. Perfdata follows a | on
+// the first line and, for multi-line output, everything after the first | in the long output
+func splitPluginOutput(raw string) (text, perfdata string) {
+	lines := strings.Split(strings.TrimRight(raw, "\r\n"), "\n")
+	first, perf, _ := strings.Cut(lines[0], "|")
+	textLines := []string{strings.TrimSpace(first)}
+	perfParts := []string{perf}
+
+	inPerfdata := false
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if inPerfdata {
+			perfParts = append(perfParts, line)
+			continue
+		}
+		if before, after, ok := strings.Cut(line, "|"); ok {
+			textLines = append(textLines, before)
+			perfParts = append(perfParts, after)
+			inPerfdata = true
+			continue
+		}
+		textLines = append(textLines, line)
+	}
+	return strings.TrimSpace(strings.Join(textLines, "\n")), strings.TrimSpace(strings.Join(perfParts, " "))
+}
+
+// parsePerfdata reads 'label'=value[UOM];[warn];[crit];[min];[max] items. Items whose value is U
+// (undetermined) or that can't be parsed are skipped
+func parsePerfdata(perfdata string) []models.ExecMetric {
+	var metrics []models.ExecMetric
+	rest := strings.TrimSpace(perfdata)
+	for rest != "" {
+		var label string
+		if rest[0] == '\'' {
+			label, rest = quotedLabel(rest)
+		} else {
+			end := strings.IndexAny(rest, "= ")
+			if end < 0 {
+				break
+			}
+			label, rest = rest[:end], rest[end:]
+		}
+		if !strings.HasPrefix(rest, "=") {
+			// Not an item, skip the stray word
+			_, rest, _ = strings.Cut(rest, " ")
+			rest = strings.TrimSpace(rest)
+			continue
+		}
+
+		item, remainder, _ := strings.Cut(rest[1:], " ")
+		rest = strings.TrimSpace(remainder)
+		if metric, ok := parsePerfItem(label, item); ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+// quotedLabel reads a single-quoted label, which may contain spaces and ” for a literal quote,
+// and returns it with what follows the closing quote
+func quotedLabel(s string) (string, string) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:]
+	}
+	return b.String(), ""
+}
+
+func parsePerfItem(label, item string) (models.ExecMetric, bool) {
+	fields := strings.Split(item, ";")
+	match := perfValuePattern.FindStringSubmatch(fields[0])
+	if label == "" || match == nil {
+		return models.ExecMetric{}, false
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return models.ExecMetric{}, false
+	}
+
+	metric := models.ExecMetric{Label: label, Value: value, Unit: match[2]}
+	field := func(i int) string {
+		if i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	metric.Warn = field(1)
+	metric.Crit = field(2)
+	if v, err := strconv.ParseFloat(field(3), 64); err == nil {
+		metric.Min = &v
+	}
+	if v, err := strconv.ParseFloat(field(4), 64); err == nil {
+		metric.Max = &v
+	}
+	return metric, true
+}
+
+// cappedBuffer keeps the first limit bytes written to it and quietly drops the rest, so a chatty
+// plugin can't exhaust memory or block on a full pipe
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// writePlugin writes a shell script into an allowed plugin directory and returns its path
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	original := execPluginDirs
+	execPluginDirs = []string{dir}
+	t.Cleanup(func() { execPluginDirs = original })
+
+	path := filepath.Join(dir, "check_test")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write plugin: %v", err)
+	}
+	return path
+}
+
+func TestExecCheckStates(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	for _, tc := range []struct {
+		script       string
+		code         int
+		errorMessage string
+	}{
+		{"echo 'DISK OK - free space: / 3326 MB'; exit 0", models.ExecOK, ""},
+		{"echo 'DISK WARNING - free space: / 900 MB'; exit 1", models.ExecWarning, ""},
+		{"echo 'DISK CRITICAL - free space: / 12 MB'; exit 2", models.ExecCritical, "CRITICAL: DISK CRITICAL - free space: / 12 MB"},
+		{"echo 'cannot stat /'; exit 3", models.ExecUnknown, "UNKNOWN: cannot stat /"},
+		{"exit 127", models.ExecUnknown, "UNKNOWN: exit code 127 is out of bounds"},
+		{"echo oops >&2; exit 2", models.ExecCritical, "CRITICAL: oops"},
+	} {
+		ep := Endpoint{ID: uuid.New().String(), CheckType: "exec", URL: writePlugin(t, tc.script), Timeout: 5 * time.Second}
+		status := runStatusCheck(t, ep)
+		if status.Code != tc.code || status.ErrorMessage != tc.errorMessage {
+			t.Errorf("%q: expected %d %q, got %d %q", tc.script, tc.code, tc.errorMessage, status.Code, status.ErrorMessage)
+		}
+	}
+}
+
+func TestExecCheckArgsEnvAndPerfdata(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	plugin := writePlugin(t, `echo "LOAD OK - $1 $THRESHOLD | load1=0.52;5;10;0 'load 5'=0.4;;;0;"
+echo "per-core detail"
+echo "core0 fine | core0=12%;80;90;0;100"
+echo "core1=7%;80;90;0;100 ignored"
+`)
+	ep := Endpoint{
+		ID:        uuid.New().String(),
+		CheckType: "exec",
+		URL:       plugin,
+		ExecArgs:  []string{"-w"},
+		ExecEnv:   []string{"THRESHOLD=5,4,3"},
+		Timeout:   5 * time.Second,
+	}
+	status := runStatusCheck(t, ep)
+	if status.Code != models.ExecOK || status.ErrorMessage != "" {
+		t.Fatalf("expected OK, got %d %q", status.Code, status.ErrorMessage)
+	}
+	if status.Output != "LOAD OK - -w 5,4,3\nper-core detail\ncore0 fine" {
+		t.Errorf("unexpected output %q", status.Output)
+	}
+
+	var metrics []models.ExecMetric
+	db.Where("status_id = ?", status.ID).Order("label").Find(&metrics)
+	if len(metrics) != 4 {
+		t.Fatalf("expected 4 metrics, got %+v", metrics)
+	}
+	core0 := metrics[0]
+	if core0.Label != "core0" || core0.Value != 12 || core0.Unit != "%" || core0.Warn != "80" || core0.Crit != "90" ||
+		core0.Min == nil || *core0.Min != 0 || core0.Max == nil || *core0.Max != 100 {
+		t.Errorf("unexpected core0 metric %+v", core0)
+	}
+	load5 := metrics[2]
+	if load5.Label != "load 5" || load5.Value != 0.4 || load5.Warn != "" || load5.Max != nil {
+		t.Errorf("unexpected load 5 metric %+v", load5)
+	}
+}
+
+func TestExecCheckTimeout(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	originalDelay := execWaitDelay
+	execWaitDelay = 100 * time.Millisecond // sleep outlives the shell and holds its output open
+	defer func() { execWaitDelay = originalDelay }()
+
+	ep := Endpoint{ID: uuid.New().String(), CheckType: "exec", URL: writePlugin(t, "echo starting; sleep 10"), Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	status := runStatusCheck(t, ep)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("plugin wasn't killed at the timeout, took %s", elapsed)
+	}
+	if status.Code != models.ExecCritical || status.ErrorMessage != "CRITICAL: plugin timed out after 200ms" {
+		t.Errorf("expected a CRITICAL timeout, got %d %q", status.Code, status.ErrorMessage)
+	}
+}
+
+func TestExecCommandAllowed(t *testing.T) {
+	original := execPluginDirs
+	execPluginDirs = []string{"/usr/lib/nagios/plugins"}
+	defer func() { execPluginDirs = original }()
+
+	for command, allowed := range map[string]bool{
+		"/usr/lib/nagios/plugins/check_disk":           true,
+		"/usr/lib/nagios/plugins/contrib/check_foo":    true,
+		"/usr/lib/nagios/plugins/../../../bin/sh":      false,
+		"/usr/lib/nagios/plugins":                      false,
+		"check_disk":                                   false,
+		"/usr/lib/nagios/plugins-extra/check_anything": false,
+	} {
+		if got := ExecCommandAllowed(command) == nil; got != allowed {
+			t.Errorf("ExecCommandAllowed(%q) = %v, want %v", command, got, allowed)
+		}
+	}
+}
+
+func TestParsePerfdata(t *testing.T) {
+	metrics := parsePerfdata(`time=0.0021s;;;0.000000 size=1234B;;;0 'it''s'=3c junk 'unknown'=U;1;2 x=1e3ms`)
+	var labels []string
+	for _, m := range metrics {
+		labels = append(labels, m.Label)
+	}
+	if strings.Join(labels, ",") != "time,size,it's,x" {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	if metrics[0].Unit != "s" || metrics[0].Min == nil || metrics[3].Value != 1000 || metrics[3].Unit != "ms" {
+		t.Errorf("unexpected parsed values %+v", metrics)
+	}
+}
@@ -0,0 +1,226 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Executor limits, overridden by CHECK_CONCURRENCY, CHECK_HOST_CONCURRENCY and CHECK_QUEUE_SIZE
+const (
+	defaultCheckConcurrency     = 64
+	defaultCheckHostConcurrency = 4
+	defaultCheckQueueSize       = 10000
+)
+
+// ExecutorStats describes the executor's limits and load, counters run from process start
+type ExecutorStats struct {
+	Concurrency      int    `json:"concurrency"`        // checks run at once at most
+	HostConcurrency  int    `json:"host_concurrency"`   // checks against one host at once at most, 0 is unlimited
+	QueueCapacity    int    `json:"queue_capacity"`     // checks waiting at most
+	Queued           int    `json:"queued"`             // checks waiting for a free slot
+	Running          int    `json:"running"`            // checks in progress
+	RetryWaiting     int    `json:"retry_waiting"`      // running checks holding their slots while they wait to retry
+	Submitted        uint64 `json:"submitted"`          // checks accepted
+	Completed        uint64 `json:"completed"`          // checks finished
+	SkippedRunning   uint64 `json:"skipped_running"`    // runs skipped because the endpoint's previous check hadn't finished
+	SkippedQueueFull uint64 `json:"skipped_queue_full"` // runs dropped because the queue was full
+}
+
+// checkJob is one check waiting in the executor's queue
+type checkJob struct {
+	endpointID string
+	host       string
+	run        func()
+}
+
+// executor runs checks with bounded concurrency, overall and per host. An endpoint has at most one
+// check queued or running, a run that comes due while it still has one is skipped. Goroutines are
+// only started for checks that may run, a dark region fills the queue rather than the scheduler
+type executor struct {
+	mu          sync.Mutex
+	concurrency int
+	perHost     int
+	capacity    int
+	queue       []checkJob
+	inflight    map[string]bool // endpoints with a check queued or running
+	hostRunning map[string]int
+	stats       ExecutorStats
+	closed      bool           // shutting down, no more checks are accepted
+	running     sync.WaitGroup // checks started and not finished
+}
+
+func newExecutor(concurrency, perHost, capacity int) *executor {
+	if concurrency <= 0 {
+		concurrency = defaultCheckConcurrency
+	}
+	if capacity <= 0 {
+		capacity = defaultCheckQueueSize
+	}
+	return &executor{
+		concurrency: concurrency,
+		perHost:     max(perHost, 0),
+		capacity:    capacity,
+		inflight:    make(map[string]bool),
+		hostRunning: make(map[string]int),
+	}
+}
+
+// newExecutorFromEnv builds an executor with the limits set in the environment
+func newExecutorFromEnv() *executor {
+	return newExecutor(
+		envInt("CHECK_CONCURRENCY", defaultCheckConcurrency),
+		envInt("CHECK_HOST_CONCURRENCY", defaultCheckHostConcurrency),
+		envInt("CHECK_QUEUE_SIZE", defaultCheckQueueSize),
+	)
+}
+
+// envInt reads a non-negative integer setting, falling back when it's unset or invalid
+func envInt(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("ignoring invalid %s=%q", name, raw)
+		return fallback
+	}
+	return n
+}
+
+// submit queues a check of ep and reports whether it was accepted
+func (e *executor) submit(ep Endpoint, run func()) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return false
+	}
+	if e.inflight[ep.ID] {
+		e.stats.SkippedRunning++
+		log.Printf("Skipping check of %s, the previous one is still running", ep.URL)
+		return false
+	}
+	if len(e.queue) >= e.capacity {
+		e.stats.SkippedQueueFull++
+		log.Printf("Skipping check of %s, %d checks are already queued", ep.URL, len(e.queue))
+		return false
+	}
+
+	e.inflight[ep.ID] = true
+	e.stats.Submitted++
+	e.queue = append(e.queue, checkJob{endpointID: ep.ID, host: checkHost(ep), run: run})
+	e.dispatchLocked()
+	return true
+}
+
+// dispatchLocked starts queued checks, oldest first, while there are free slots. Checks against a
+// host at its limit wait without holding up other hosts. e.mu must be held
+func (e *executor) dispatchLocked() {
+	for i := 0; i < len(e.queue) && e.stats.Running < e.concurrency; {
+		job := e.queue[i]
+		if job.host != "" && e.perHost > 0 && e.hostRunning[job.host] >= e.perHost {
+			i++
+			continue
+		}
+		e.queue = append(e.queue[:i], e.queue[i+1:]...)
+		e.stats.Running++
+		e.running.Add(1)
+		if job.host != "" {
+			e.hostRunning[job.host]++
+		}
+		go e.execute(job)
+	}
+}
+
+func (e *executor) execute(job checkJob) {
+	defer e.running.Done()
+	defer func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.stats.Running--
+		e.stats.Completed++
+		if job.host != "" {
+			if e.hostRunning[job.host]--; e.hostRunning[job.host] == 0 {
+				delete(e.hostRunning, job.host)
+			}
+		}
+		delete(e.inflight, job.endpointID)
+		e.dispatchLocked()
+	}()
+	job.run()
+}
+
+// retryWaiting counts a running check starting, delta 1, or ending, delta -1, a wait before its
+// next attempt. The check keeps its slots while it waits, validation keeps the waits within the
+// endpoint's interval
+func (e *executor) retryWaiting(delta int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats.RetryWaiting += delta
+}
+
+// close stops the executor accepting checks and drops the queued ones, returning how many were
+// dropped. Running checks carry on
+func (e *executor) close() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	dropped := len(e.queue)
+	for _, job := range e.queue {
+		delete(e.inflight, job.endpointID)
+	}
+	e.queue = nil
+	return dropped
+}
+
+// wait blocks until the running checks have finished or ctx ends. Nothing new starts once the
+// executor is closed, so after close it waits for the last of them
+func (e *executor) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the executor's current load
+func (e *executor) Stats() ExecutorStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	stats.Concurrency = e.concurrency
+	stats.HostConcurrency = e.perHost
+	stats.QueueCapacity = e.capacity
+	stats.Queued = len(e.queue)
+	return stats
+}
+
+// checkHost returns the host a check connects to, used for per-host limits. Checks that don't
+// connect anywhere return an empty host and are only limited overall
+func checkHost(ep Endpoint) string {
+	switch ep.CheckType {
+	case "heartbeat", "exec":
+		return ""
+	}
+	raw := strings.TrimSpace(ep.URL)
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		return strings.ToLower(host)
+	}
+	return strings.ToLower(strings.Trim(raw, "[]/"))
+}
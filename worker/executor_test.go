@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// blockingJob returns a check that signals started and then waits for release to be closed
+func blockingJob(started chan<- string, release <-chan struct{}, id string) func() {
+	return func() {
+		started <- id
+		<-release
+	}
+}
+
+func waitForStats(t *testing.T, e *executor, done func(ExecutorStats) bool) ExecutorStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := e.Stats()
+		if done(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("executor didn't settle, stats %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExecutorGlobalConcurrency(t *testing.T) {
+	e := newExecutor(2, 0, 100)
+	started := make(chan string, 10)
+	release := make(chan struct{})
+
+	for i := 0; i < 6; i++ {
+		ep := Endpoint{ID: fmt.Sprint(i), URL: fmt.Sprintf("https://host%d.example.com", i)}
+		if !e.submit(ep, blockingJob(started, release, ep.ID)) {
+			t.Fatalf("expected check %d to be accepted", i)
+		}
+	}
+	<-started
+	<-started
+	stats := e.Stats()
+	if stats.Running != 2 || stats.Queued != 4 {
+		t.Fatalf("expected 2 running and 4 queued, got %+v", stats)
+	}
+
+	close(release)
+	stats = waitForStats(t, e, func(s ExecutorStats) bool { return s.Completed == 6 })
+	if stats.Running != 0 || stats.Queued != 0 || stats.Submitted != 6 {
+		t.Errorf("expected everything to finish, got %+v", stats)
+	}
+}
+
+func TestExecutorHostConcurrency(t *testing.T) {
+	e := newExecutor(10, 1, 100)
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	defer close(release)
+
+	for i, url := range []string{"https://a.example.com/1", "https://A.example.com/2", "a.example.com:443", "https://b.example.com"} {
+		ep := Endpoint{ID: fmt.Sprint(i), URL: url}
+		e.submit(ep, blockingJob(started, release, ep.ID))
+	}
+
+	got := map[string]bool{<-started: true, <-started: true}
+	if !got["0"] || !got["3"] {
+		t.Fatalf("expected the first check of each host to start, got %v", got)
+	}
+	if stats := e.Stats(); stats.Running != 2 || stats.Queued != 2 {
+		t.Errorf("expected the other checks of a.example.com to wait, got %+v", stats)
+	}
+}
+
+func TestExecutorSkipsRunningEndpoint(t *testing.T) {
+	e := newExecutor(10, 0, 100)
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	ep := Endpoint{ID: "slow", URL: "https://slow.example.com"}
+
+	e.submit(ep, blockingJob(started, release, ep.ID))
+	<-started
+	if e.submit(ep, blockingJob(started, release, ep.ID)) {
+		t.Fatalf("expected the overlapping run to be skipped")
+	}
+	if stats := e.Stats(); stats.SkippedRunning != 1 {
+		t.Errorf("expected one skipped run, got %+v", stats)
+	}
+
+	close(release)
+	waitForStats(t, e, func(s ExecutorStats) bool { return s.Completed == 1 })
+	if !e.submit(ep, func() {}) {
+		t.Errorf("expected the next run to be accepted once the check finished")
+	}
+}
+
+func TestExecutorQueueFull(t *testing.T) {
+	e := newExecutor(1, 0, 1)
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	defer close(release)
+
+	e.submit(Endpoint{ID: "1", URL: "https://one.example.com"}, blockingJob(started, release, "1"))
+	<-started
+	e.submit(Endpoint{ID: "2", URL: "https://two.example.com"}, blockingJob(started, release, "2"))
+	if e.submit(Endpoint{ID: "3", URL: "https://three.example.com"}, blockingJob(started, release, "3")) {
+		t.Fatalf("expected the check to be dropped with the queue full")
+	}
+	if stats := e.Stats(); stats.SkippedQueueFull != 1 || stats.Queued != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, c := range []struct {
+		ep   Endpoint
+		want string
+	}{
+		{Endpoint{URL: "https://API.example.com:8443/health"}, "api.example.com"},
+		{Endpoint{URL: "bastion.example.com:2222", CheckType: "ssh"}, "bastion.example.com"},
+		{Endpoint{URL: "ssh://10.0.0.1", CheckType: "ssh"}, "10.0.0.1"},
+		{Endpoint{URL: "[2001:db8::1]", CheckType: "ping"}, "2001:db8::1"},
+		{Endpoint{URL: "example.com", CheckType: "dns"}, "example.com"},
+		{Endpoint{URL: "/usr/lib/nagios/plugins/check_load", CheckType: "exec"}, ""},
+		{Endpoint{URL: "nightly-backup", CheckType: "heartbeat"}, ""},
+	} {
+		if got := checkHost(c.ep); got != c.want {
+			t.Errorf("checkHost(%q) = %q, want %q", c.ep.URL, got, c.want)
+		}
+	}
+}
+
+func TestExecutorCloseDropsQueued(t *testing.T) {
+	e := newExecutor(1, 0, 10)
+	started := make(chan string, 10)
+	release := make(chan struct{})
+
+	e.submit(Endpoint{ID: "1", URL: "https://one.example.com"}, blockingJob(started, release, "1"))
+	<-started
+	e.submit(Endpoint{ID: "2", URL: "https://two.example.com"}, blockingJob(started, release, "2"))
+
+	if dropped := e.close(); dropped != 1 {
+		t.Fatalf("expected the queued check to be dropped, got %d", dropped)
+	}
+	if e.submit(Endpoint{ID: "3", URL: "https://three.example.com"}, func() {}) {
+		t.Errorf("expected a closed executor to refuse checks")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := e.wait(ctx); err == nil {
+		t.Fatalf("expected wait to time out while a check runs")
+	}
+	close(release)
+	if err := e.wait(context.Background()); err != nil {
+		t.Fatalf("expected wait to return once the check finished, got %v", err)
+	}
+	if stats := e.Stats(); stats.Completed != 1 || stats.Queued != 0 {
+		t.Errorf("expected only the running check to complete, got %+v", stats)
+	}
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// isUnreachable reports whether err means the target couldn't be reached at all: its name doesn't
+// resolve, the connection was refused or unroutable, or connecting timed out. connected tells
+// whether a connection had been made when err happened, after which nothing counts: TLS failures,
+// resets and timeouts waiting for an answer all mean something accepted the connection
+func isUnreachable(err error, connected bool) bool {
+	if connected {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// expectUnreachable judges a check of an endpoint that must not be reachable. err is the error of the
+// check, connected whether a connection was made before it, and reached describes what answered when
+// there was no error. It returns the check's error message, empty when the target stayed closed, and
+// the failure that was expected
+func expectUnreachable(err error, connected bool, reached string) (errorMessage, expectedFailure string) {
+	if err == nil {
+		return fmt.Sprintf("reachable but expected to fail: %s", reached), ""
+	}
+	if !isUnreachable(err, connected) {
+		return err.Error(), ""
+	}
+	return "", err.Error()
+}
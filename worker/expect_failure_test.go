@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+func TestExpectFailureTCP(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	closed := Endpoint{ID: uuid.New().String(), CheckType: "tcp", URL: "127.0.0.1", TCPPort: closedPort(t), Timeout: 2 * time.Second, ExpectFailure: true}
+	w.runCheck(context.Background(), closed)
+	status := latestStatus(t, closed.ID)
+	if status.ErrorMessage != "" || !strings.Contains(status.ExpectedFailure, "refused") {
+		t.Errorf("expected a closed port to pass, got %q (expected failure %q)", status.ErrorMessage, status.ExpectedFailure)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	open := Endpoint{ID: uuid.New().String(), CheckType: "tcp", URL: "127.0.0.1", TCPPort: ln.Addr().(*net.TCPAddr).Port, Timeout: 2 * time.Second, ExpectFailure: true}
+	w.runCheck(context.Background(), open)
+	status = latestStatus(t, open.ID)
+	if status.ErrorMessage != "reachable but expected to fail: connected to 127.0.0.1" || status.ExpectedFailure != "" {
+		t.Errorf("expected an open port to fail, got %q", status.ErrorMessage)
+	}
+}
+
+func TestExpectFailureHTTP(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		url             string
+		codes           []int
+		errorMessage    string
+		expectedFailure string
+	}{
+		{srv.URL + "/admin", []int{403}, "", "status 403"},
+		{srv.URL + "/admin", nil, "reachable but expected to fail: status 403", ""},
+		{srv.URL + "/", []int{403}, "reachable but expected to fail: status 200", ""},
+	} {
+		ep := Endpoint{
+			ID:                  uuid.New().String(),
+			URL:                 tc.url,
+			ExpectedStatusCodes: tc.codes,
+			Timeout:             2 * time.Second,
+			MaxResponseTime:     2 * time.Second,
+			ExpectFailure:       true,
+		}
+		w.runCheck(context.Background(), ep)
+		status := latestStatus(t, ep.ID)
+		if status.ErrorMessage != tc.errorMessage || status.ExpectedFailure != tc.expectedFailure {
+			t.Errorf("%s %v: expected %q/%q, got %q/%q", tc.url, tc.codes, tc.errorMessage, tc.expectedFailure, status.ErrorMessage, status.ExpectedFailure)
+		}
+	}
+
+	closed := Endpoint{ID: uuid.New().String(), URL: "http://127.0.0.1:" + strconv.Itoa(closedPort(t)), Timeout: 2 * time.Second, ExpectFailure: true}
+	w.runCheck(context.Background(), closed)
+	if status := latestStatus(t, closed.ID); status.ErrorMessage != "" || status.ExpectedFailure == "" {
+		t.Errorf("expected a refused connection to pass, got %q", status.ErrorMessage)
+	}
+}
+
+func TestExpectFailureTLSErrorStillFails(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	// Something answered the TLS handshake, the port isn't closed even though the request failed
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: 2 * time.Second, ExpectFailure: true}
+	w.runCheck(context.Background(), ep)
+	status := latestStatus(t, ep.ID)
+	if !strings.Contains(status.ErrorMessage, "certificate") || status.ExpectedFailure != "" {
+		t.Errorf("expected the certificate error to fail the check, got %q", status.ErrorMessage)
+	}
+}
+
+func TestExpectFailureHangingTargetFails(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	// The target accepts connections and never answers, it's reachable even though the check times out
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, scheme := range []string{"http", "https"} {
+		ep := Endpoint{ID: uuid.New().String(), URL: scheme + "://" + ln.Addr().String(), Timeout: 500 * time.Millisecond, ExpectFailure: true}
+		w.runCheck(context.Background(), ep)
+		status := latestStatus(t, ep.ID)
+		if status.ErrorMessage == "" || status.ExpectedFailure != "" {
+			t.Errorf("%s: expected a timeout after connecting to fail the check, got %q (expected failure %q)", scheme, status.ErrorMessage, status.ExpectedFailure)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"net"
+
+	"github.com/monty/models"
+)
+
+// familyDialer restricts the connections it opens to the endpoint's address family. Through a
+// proxy this applies to the connection to the proxy, which resolves the target itself
+type familyDialer struct {
+	dialer *net.Dialer
+	family string
+}
+
+func (d *familyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, familyNetwork(network, d.family), address)
+}
+
+// Dial lets the dialer forward SOCKS5 proxy connections
+func (d *familyDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// familyNetwork narrows a "tcp" network to tcp4 or tcp6 when the family is forced
+func familyNetwork(network, family string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch family {
+	case models.AddressFamilyIPv4:
+		return "tcp4"
+	case models.AddressFamilyIPv6:
+		return "tcp6"
+	default:
+		return network
+	}
+}
+
+// forEachFamily runs check once over IPv4 and once over IPv6 so each path records its own result
+func forEachFamily(ctx context.Context, ep Endpoint, check func(context.Context, Endpoint)) {
+	for _, family := range []string{models.AddressFamilyIPv4, models.AddressFamilyIPv6} {
+		familyEp := ep
+		familyEp.AddressFamily = family
+		check(ctx, familyEp)
+	}
+}
+
+// targetIP returns the IP address of the endpoint a check's connection reached. Through a proxy the
+// connection only shows the proxy's address, so it is left empty
+func targetIP(ep Endpoint, conn net.Conn) string {
+	if ep.ProxyURL != "" {
+		return ""
+	}
+	return remoteIP(conn)
+}
+
+// remoteIP returns the IP address a connection is talking to
+func remoteIP(conn net.Conn) string {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// resultFamily labels a result with the family it was checked over, taken from the forced
+// family or else from the IP that was used. Through a proxy the family only applies to the
+// connection to the proxy, so results aren't labelled
+func resultFamily(ep Endpoint, ip string) string {
+	if ep.ProxyURL != "" {
+		return ""
+	}
+	switch ep.AddressFamily {
+	case models.AddressFamilyIPv4, models.AddressFamilyIPv6:
+		return ep.AddressFamily
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if parsed.To4() != nil {
+		return models.AddressFamilyIPv4
+	}
+	return models.AddressFamilyIPv6
+}
+
+// checkTarget names an endpoint in log lines, noting the family when it is forced
+func checkTarget(ep Endpoint) string {
+	switch ep.AddressFamily {
+	case models.AddressFamilyIPv4, models.AddressFamilyIPv6:
+		return ep.URL + " (" + ep.AddressFamily + ")"
+	default:
+		return ep.URL
+	}
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func TestFamilyNetwork(t *testing.T) {
+	cases := []struct {
+		network, family, want string
+	}{
+		{"tcp", models.AddressFamilyAuto, "tcp"},
+		{"tcp", "", "tcp"},
+		{"tcp", models.AddressFamilyIPv4, "tcp4"},
+		{"tcp", models.AddressFamilyIPv6, "tcp6"},
+		{"udp", models.AddressFamilyIPv4, "udp"},
+	}
+	for _, c := range cases {
+		if got := familyNetwork(c.network, c.family); got != c.want {
+			t.Errorf("familyNetwork(%q, %q) = %q, want %q", c.network, c.family, got, c.want)
+		}
+	}
+}
+
+func TestResultFamily(t *testing.T) {
+	if got := resultFamily(Endpoint{AddressFamily: models.AddressFamilyAuto}, "127.0.0.1"); got != models.AddressFamilyIPv4 {
+		t.Errorf("expected ipv4 for 127.0.0.1, got %q", got)
+	}
+	if got := resultFamily(Endpoint{}, "::1"); got != models.AddressFamilyIPv6 {
+		t.Errorf("expected ipv6 for ::1, got %q", got)
+	}
+	if got := resultFamily(Endpoint{AddressFamily: models.AddressFamilyIPv6}, ""); got != models.AddressFamilyIPv6 {
+		t.Errorf("expected the forced family when no IP was used, got %q", got)
+	}
+	if got := resultFamily(Endpoint{AddressFamily: models.AddressFamilyIPv6, ProxyURL: "socks5://proxy:1080"}, ""); got != "" {
+		t.Errorf("expected no family through a proxy, got %q", got)
+	}
+}
+
+func TestTCPCheckBothFamilies(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	// An IPv4-only listener stands in for a host whose IPv6 path is broken
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ep := Endpoint{
+		ID:            uuid.New().String(),
+		CheckType:     "tcp",
+		URL:           "127.0.0.1",
+		TCPPort:       port,
+		Timeout:       5 * time.Second,
+		AddressFamily: models.AddressFamilyBoth,
+	}
+	w.runCheck(context.Background(), ep)
+
+	var statuses []models.Status
+	db.Where("endpoint_id = ?", ep.ID).Find(&statuses)
+	if len(statuses) != 2 {
+		t.Fatalf("expected one status per family, got %d", len(statuses))
+	}
+	byFamily := make(map[string]models.Status)
+	for _, s := range statuses {
+		byFamily[s.AddressFamily] = s
+	}
+
+	v4, ok := byFamily[models.AddressFamilyIPv4]
+	if !ok || v4.ErrorMessage != "" || v4.RemoteIP != "127.0.0.1" {
+		t.Errorf("expected IPv4 check to pass over 127.0.0.1, got %+v", v4)
+	}
+	v6, ok := byFamily[models.AddressFamilyIPv6]
+	if !ok || v6.ErrorMessage == "" || v6.RemoteIP != "" {
+		t.Errorf("expected IPv6 check to fail without a remote IP, got %+v", v6)
+	}
+}
+
+func TestHTTPCheckRecordsRemoteIP(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// localhost may resolve to both families, forcing IPv4 must pick 127.0.0.1
+	ep := Endpoint{
+		ID:              uuid.New().String(),
+		URL:             "http://localhost:" + port,
+		Timeout:         5 * time.Second,
+		MaxResponseTime: 5 * time.Second,
+		AddressFamily:   models.AddressFamilyIPv4,
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.Code != http.StatusOK || status.RemoteIP != "127.0.0.1" || status.AddressFamily != models.AddressFamilyIPv4 {
+		t.Fatalf("expected 200 over IPv4 from 127.0.0.1, got %d from %q (%q): %s",
+			status.Code, status.RemoteIP, status.AddressFamily, status.ErrorMessage)
+	}
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"github.com/robfig/cron/v3"
+)
+
+// heartbeatEvaluationInterval is the longest a heartbeat monitor waits between evaluations
+const heartbeatEvaluationInterval = time.Minute
+
+// heartbeatPingWindow is how many recent pings are considered when evaluating a heartbeat
+const heartbeatPingWindow = 100
+
+// CheckHeartbeatEndpoint evaluates the pings a job has pushed and records whether it is on schedule
+func (w *Worker) CheckHeartbeatEndpoint(ctx context.Context, ep Endpoint) Result {
+	now := time.Now()
+
+	var pings []models.HeartbeatPing
+	errorMessage := ""
+	if err := models.DB.Where("endpoint_id = ?", ep.ID).Order("received_at desc").Limit(heartbeatPingWindow).Find(&pings).Error; err != nil {
+		errorMessage = err.Error()
+	}
+
+	runtime := time.Duration(0)
+	if errorMessage == "" {
+		var problems []string
+		runtime, problems = evaluateHeartbeat(ep, pings, now)
+		errorMessage = strings.Join(problems, "; ")
+	}
+
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         0, // Heartbeats don't have HTTP codes
+		ResponseTime: int(runtime.Milliseconds()),
+		ErrorMessage: errorMessage,
+		CheckedAt:    now,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ Heartbeat check PASSED for %s", ep.URL)
+	} else {
+		log.Printf("✗ Heartbeat check FAILED for %s: %s", ep.URL, errorMessage)
+	}
+	return result
+}
+
+// evaluateHeartbeat inspects pings (newest first) and returns the duration of the last
+// completed run along with any reasons the monitor should be considered down
+func evaluateHeartbeat(ep Endpoint, pings []models.HeartbeatPing, now time.Time) (time.Duration, []string) {
+	var problems []string
+
+	// Walk back from the newest ping to find the last success, the start that opened
+	// it and any start that hasn't been closed by a success or fail ping yet
+	var lastSuccess, lastStart, runStart *models.HeartbeatPing
+	finished := false
+scan:
+	for i := range pings {
+		p := &pings[i]
+		switch p.Kind {
+		case models.PingKindSuccess, models.PingKindFail:
+			if lastSuccess != nil {
+				break scan
+			}
+			if p.Kind == models.PingKindSuccess {
+				lastSuccess = p
+			}
+			finished = true
+		case models.PingKindStart:
+			if !finished {
+				if lastStart == nil {
+					lastStart = p
+				}
+			} else if lastSuccess != nil {
+				runStart = p
+				break scan
+			}
+		}
+	}
+
+	if len(pings) > 0 && pings[0].Kind == models.PingKindFail {
+		problems = append(problems, fmt.Sprintf("job reported failure at %s", pings[0].ReceivedAt.Format(time.RFC3339)))
+	}
+
+	// Without any successful run yet, the monitor's creation time starts the clock
+	reference := ep.CreatedAt
+	if lastSuccess != nil {
+		reference = lastSuccess.ReceivedAt
+	}
+	expected, err := nextExpectedPing(ep, reference)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if deadline := expected.Add(ep.HeartbeatGrace); now.After(deadline) {
+		problems = append(problems, fmt.Sprintf("no ping received since %s (expected by %s)",
+			reference.Format(time.RFC3339), deadline.Format(time.RFC3339)))
+	}
+
+	runtime := time.Duration(0)
+	if lastSuccess != nil && runStart != nil {
+		runtime = lastSuccess.ReceivedAt.Sub(runStart.ReceivedAt)
+	}
+
+	if ep.HeartbeatMaxRuntime > 0 {
+		if lastStart != nil && now.Sub(lastStart.ReceivedAt) > ep.HeartbeatMaxRuntime {
+			problems = append(problems, fmt.Sprintf("run started at %s exceeded max runtime of %s",
+				lastStart.ReceivedAt.Format(time.RFC3339), ep.HeartbeatMaxRuntime))
+		} else if lastStart == nil && runtime > ep.HeartbeatMaxRuntime {
+			problems = append(problems, fmt.Sprintf("last run took %s (max %s)", runtime.Round(time.Second), ep.HeartbeatMaxRuntime))
+		}
+	}
+
+	return runtime, problems
+}
+
+// nextExpectedPing returns when the ping following the one at reference is due
+func nextExpectedPing(ep Endpoint, reference time.Time) (time.Time, error) {
+	if ep.HeartbeatSchedule == "" {
+		return reference.Add(ep.Interval), nil
+	}
+	schedule, err := cron.ParseStandard(ep.HeartbeatSchedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid heartbeat schedule %q: %v", ep.HeartbeatSchedule, err)
+	}
+	return schedule.Next(reference), nil
+}
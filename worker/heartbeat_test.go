@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monty/models"
+)
+
+func TestEvaluateHeartbeat(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ep := Endpoint{
+		Interval:            time.Hour,
+		HeartbeatGrace:      5 * time.Minute,
+		HeartbeatMaxRuntime: 10 * time.Minute,
+		CreatedAt:           now.Add(-24 * time.Hour),
+	}
+	ping := func(kind string, ago time.Duration) models.HeartbeatPing {
+		return models.HeartbeatPing{Kind: kind, ReceivedAt: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name     string
+		ep       Endpoint
+		pings    []models.HeartbeatPing
+		runtime  time.Duration
+		problems []string
+	}{
+		{
+			name:    "on time",
+			ep:      ep,
+			pings:   []models.HeartbeatPing{ping(models.PingKindSuccess, 30*time.Minute), ping(models.PingKindStart, 32*time.Minute)},
+			runtime: 2 * time.Minute,
+		},
+		{
+			name:     "late",
+			ep:       ep,
+			pings:    []models.HeartbeatPing{ping(models.PingKindSuccess, 66*time.Minute)},
+			problems: []string{"no ping received since"},
+		},
+		{
+			name:  "within grace",
+			ep:    ep,
+			pings: []models.HeartbeatPing{ping(models.PingKindSuccess, 64*time.Minute)},
+		},
+		{
+			name:     "never pinged",
+			ep:       ep,
+			problems: []string{"no ping received since"},
+		},
+		{
+			name: "reported failure",
+			ep:   ep,
+			pings: []models.HeartbeatPing{
+				ping(models.PingKindFail, time.Minute),
+				ping(models.PingKindStart, 2*time.Minute),
+				ping(models.PingKindSuccess, 30*time.Minute),
+			},
+			problems: []string{"job reported failure"},
+		},
+		{
+			name: "run still going past max runtime",
+			ep:   ep,
+			pings: []models.HeartbeatPing{
+				ping(models.PingKindStart, 15*time.Minute),
+				ping(models.PingKindSuccess, 30*time.Minute),
+			},
+			problems: []string{"exceeded max runtime"},
+		},
+		{
+			name: "last run too slow",
+			ep:   ep,
+			pings: []models.HeartbeatPing{
+				ping(models.PingKindSuccess, 5*time.Minute),
+				ping(models.PingKindStart, 20*time.Minute),
+			},
+			runtime:  15 * time.Minute,
+			problems: []string{"last run took 15m0s"},
+		},
+		{
+			name: "start from an earlier run is not paired",
+			ep:   ep,
+			pings: []models.HeartbeatPing{
+				ping(models.PingKindSuccess, 5*time.Minute),
+				ping(models.PingKindSuccess, 65*time.Minute),
+				ping(models.PingKindStart, 90*time.Minute),
+			},
+		},
+		{
+			name: "cron schedule",
+			ep: Endpoint{
+				HeartbeatSchedule: "0 3 * * *",
+				HeartbeatGrace:    time.Hour,
+				CreatedAt:         now.Add(-48 * time.Hour),
+			},
+			// Last run was yesterday at 03:00, today's run is due by 04:00
+			pings:    []models.HeartbeatPing{ping(models.PingKindSuccess, 33*time.Hour)},
+			problems: []string{"expected by 2024-01-01T04:00:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		runtime, problems := evaluateHeartbeat(test.ep, test.pings, now)
+		if runtime != test.runtime {
+			t.Errorf("%s: runtime = %s, expected %s", test.name, runtime, test.runtime)
+		}
+		if len(problems) != len(test.problems) {
+			t.Errorf("%s: problems = %v, expected %v", test.name, problems, test.problems)
+			continue
+		}
+		for i, want := range test.problems {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("%s: problem %q does not contain %q", test.name, problems[i], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupJSONPath resolves a simple JSONPath such as $.data.items[0]['name'] against a
+// decoded JSON document. Only child and index selectors are supported.
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		// Allow paths without the leading "$." such as data.token
+		rest = "." + rest
+	}
+	current := doc
+
+	for rest != "" {
+		var key string
+		index := -1
+
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], rest[end:]
+			if key == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q", path)
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid JSONPath %q", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			if unquoted, ok := unquoteSelector(selector); ok {
+				key = unquoted
+			} else {
+				n, err := strconv.Atoi(selector)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %q", path)
+				}
+				index = n
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q", path)
+		}
+
+		if index >= 0 {
+			items, ok := current.([]interface{})
+			if !ok || index >= len(items) {
+				return nil, fmt.Errorf("path %s not found", path)
+			}
+			current = items[index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+		if current, ok = object[key]; !ok {
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+	}
+
+	return current, nil
+}
+
+func unquoteSelector(selector string) (string, bool) {
+	if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+		return selector[1 : len(selector)-1], true
+	}
+	return "", false
+}
+
+// jsonValueString renders a JSON value the way it is compared and interpolated
+func jsonValueString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case nil:
+		return "null"
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
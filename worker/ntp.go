@@ -0,0 +1,210 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch, 1900, and the Unix epoch
+const ntpEpochOffset = 2208988800
+
+// ntpPacketSize is the size of an NTP header without extensions
+const ntpPacketSize = 48
+
+// ntpReading is what an SNTP exchange tells about a server's clock
+type ntpReading struct {
+	ip             string
+	stratum        int
+	leap           int
+	referenceID    string
+	offset         time.Duration
+	roundTrip      time.Duration
+	rootDelay      time.Duration
+	rootDispersion time.Duration
+}
+
+func (w *Worker) CheckNTPEndpoint(ctx context.Context, ep Endpoint) Result {
+	// NTP runs over UDP and never goes through the proxy, results carry the server's own address
+	ep.ProxyURL = ""
+	start := time.Now()
+	reading, err := queryNTP(ctx, ep)
+	responseTime := int(time.Since(start).Milliseconds())
+
+	errorMessage := ""
+	switch {
+	case err != nil:
+		errorMessage = err.Error()
+	case reading.leap == models.LeapAlarm || reading.stratum >= models.NTPUnsynchronizedStratum:
+		errorMessage = fmt.Sprintf("server is unsynchronized (stratum %d, leap indicator %d)", reading.stratum, reading.leap)
+	case ep.NTPMaxOffset > 0 && reading.offset.Abs() > ep.NTPMaxOffset:
+		errorMessage = fmt.Sprintf("clock offset %s exceeds %s", reading.offset.Round(time.Millisecond), ep.NTPMaxOffset)
+	}
+
+	status := models.Status{
+		ID:            uuid.New().String(),
+		EndpointID:    ep.ID,
+		Code:          reading.stratum,
+		ResponseTime:  responseTime,
+		ErrorMessage:  errorMessage,
+		RemoteIP:      reading.ip,
+		AddressFamily: resultFamily(ep, reading.ip),
+		CheckedAt:     time.Now(),
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+
+	if err == nil {
+		ntp := models.NTPResult{
+			ID:             uuid.New().String(),
+			StatusID:       status.ID,
+			EndpointID:     ep.ID,
+			ServerIP:       reading.ip,
+			Stratum:        reading.stratum,
+			LeapIndicator:  reading.leap,
+			ReferenceID:    reading.referenceID,
+			Offset:         milliseconds(reading.offset),
+			RoundTrip:      milliseconds(reading.roundTrip),
+			RootDelay:      milliseconds(reading.rootDelay),
+			RootDispersion: milliseconds(reading.rootDispersion),
+			CheckedAt:      status.CheckedAt,
+		}
+		result.Details = append(result.Details, &ntp)
+	}
+
+	if errorMessage == "" {
+		log.Printf("✓ NTP check PASSED for %s (stratum %d, offset %s)", checkTarget(ep), reading.stratum, reading.offset.Round(time.Microsecond))
+	} else {
+		log.Printf("✗ NTP check FAILED for %s: %s", checkTarget(ep), errorMessage)
+	}
+	return result
+}
+
+// queryNTP sends one SNTP client request to the endpoint and reads the server's answer. NTP is UDP,
+// so it doesn't go through the endpoint's proxy
+func queryNTP(ctx context.Context, ep Endpoint) (ntpReading, error) {
+	var reading ntpReading
+
+	network := "udp"
+	switch ep.AddressFamily {
+	case models.AddressFamilyIPv4:
+		network = "udp4"
+	case models.AddressFamilyIPv6:
+		network = "udp6"
+	}
+	ctx, cancel := timeoutContext(ctx, ep.Timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, ntpAddress(ep.URL))
+	if err != nil {
+		return reading, err
+	}
+	defer conn.Close()
+	reading.ip = remoteIP(conn)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock the exchange when the check is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Version 4, client mode. The transmit timestamp comes back as the origin timestamp, tying the
+	// answer to this request
+	request := make([]byte, ntpPacketSize)
+	request[0] = 4<<3 | 3
+	sent := time.Now()
+	binary.BigEndian.PutUint64(request[40:], toNTPTime(sent))
+	if _, err := conn.Write(request); err != nil {
+		return reading, err
+	}
+
+	response := make([]byte, 512)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return reading, err
+		}
+		received := time.Now()
+		if n < ntpPacketSize || !bytes.Equal(response[24:32], request[40:48]) {
+			continue // not an answer to this request, keep waiting
+		}
+		return parseNTPResponse(reading, response[:n], sent, received)
+	}
+}
+
+// parseNTPResponse reads a server's answer to a request sent at sent and received at received
+func parseNTPResponse(reading ntpReading, packet []byte, sent, received time.Time) (ntpReading, error) {
+	if mode := packet[0] & 0x7; mode != 4 {
+		return reading, fmt.Errorf("unexpected NTP mode %d in response", mode)
+	}
+	reading.leap = int(packet[0] >> 6)
+	reading.stratum = int(packet[1])
+	reading.rootDelay = ntpShortDuration(binary.BigEndian.Uint32(packet[4:]))
+	reading.rootDispersion = ntpShortDuration(binary.BigEndian.Uint32(packet[8:]))
+	refID := packet[12:16]
+
+	if reading.stratum == 0 {
+		// A kiss-o'-death packet, the reference ID is a code like RATE or DENY
+		return reading, fmt.Errorf("server sent kiss-o'-death %s", strings.TrimRight(string(refID), "\x00"))
+	}
+	if reading.stratum == 1 {
+		reading.referenceID = strings.TrimRight(string(refID), "\x00")
+	} else {
+		reading.referenceID = net.IP(refID).String()
+	}
+
+	transmitted := binary.BigEndian.Uint64(packet[40:])
+	if transmitted == 0 {
+		return reading, errors.New("server sent no transmit timestamp")
+	}
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(packet[32:]))
+	serverSent := fromNTPTime(transmitted)
+
+	// RFC 5905: offset ((T2-T1)+(T3-T4))/2, delay (T4-T1)-(T3-T2)
+	reading.offset = (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	reading.roundTrip = received.Sub(sent) - serverSent.Sub(serverReceived)
+	return reading, nil
+}
+
+// ntpAddress returns the host:port an ntp endpoint's URL names, port 123 unless it has one
+func ntpAddress(url string) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(url, "ntp://"), "/")
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), "123")
+}
+
+// toNTPTime encodes t as a 64 bit NTP timestamp, seconds since 1900 and a binary fraction
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix()+ntpEpochOffset) & 0xffffffff
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// fromNTPTime decodes a 64 bit NTP timestamp. Seconds wrap in 2036, values that would fall before
+// 1968 are taken to be in the next era
+func fromNTPTime(ts uint64) time.Time {
+	seconds := int64(ts >> 32)
+	if seconds < 1<<31 {
+		seconds += 1 << 32
+	}
+	nanoseconds := int64((ts & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(seconds-ntpEpochOffset, nanoseconds)
+}
+
+// ntpShortDuration decodes the 16.16 fixed point seconds used for root delay and dispersion
+func ntpShortDuration(v uint32) time.Duration {
+	return time.Duration(uint64(v) * uint64(time.Second) >> 16)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
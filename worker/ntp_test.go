@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// startNTPServer answers SNTP requests with a clock skew ahead of the local one. refID is sent
+// as-is, so stratum 0 servers can send kiss codes
+func startNTPServer(t *testing.T, stratum, leap int, refID string, skew time.Duration) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		request := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			if n < ntpPacketSize {
+				continue
+			}
+			response := make([]byte, ntpPacketSize)
+			response[0] = byte(leap<<6 | 4<<3 | 4)
+			response[1] = byte(stratum)
+			binary.BigEndian.PutUint32(response[4:], 0x00000800) // 31.25ms
+			binary.BigEndian.PutUint32(response[8:], 0x00000400) // 15.625ms
+			copy(response[12:16], refID)
+			copy(response[24:32], request[40:48])
+			binary.BigEndian.PutUint64(response[32:], toNTPTime(time.Now().Add(skew)))
+			binary.BigEndian.PutUint64(response[40:], toNTPTime(time.Now().Add(skew)))
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPCheckInSync(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	addr := startNTPServer(t, 1, models.LeapNone, "GPS", 0)
+	status := runStatusCheck(t, Endpoint{CheckType: "ntp", URL: addr, NTPMaxOffset: 100 * time.Millisecond})
+	if status.ErrorMessage != "" || status.Code != 1 {
+		t.Fatalf("expected a synced stratum 1 server to pass, got %d %q", status.Code, status.ErrorMessage)
+	}
+
+	var result models.NTPResult
+	if err := db.First(&result, "status_id = ?", status.ID).Error; err != nil {
+		t.Fatalf("expected result saved: %v", err)
+	}
+	if result.ReferenceID != "GPS" || result.RootDelay != 31.25 || result.RootDispersion != 15.625 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.Offset > 50 || result.Offset < -50 {
+		t.Errorf("expected a small offset, got %vms", result.Offset)
+	}
+}
+
+func TestNTPCheckOffsetExceeded(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	addr := startNTPServer(t, 2, models.LeapNone, "\x0a\x00\x00\x01", -3*time.Second)
+	status := runStatusCheck(t, Endpoint{CheckType: "ntp", URL: addr, NTPMaxOffset: 100 * time.Millisecond})
+	if !strings.HasPrefix(status.ErrorMessage, "clock offset -") || !strings.HasSuffix(status.ErrorMessage, " exceeds 100ms") {
+		t.Fatalf("expected the offset to fail the check, got %q", status.ErrorMessage)
+	}
+
+	var result models.NTPResult
+	db.First(&result, "status_id = ?", status.ID)
+	if result.ReferenceID != "10.0.0.1" || result.Offset > -2900 || result.Offset < -3100 {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestNTPCheckUnsynchronized(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	addr := startNTPServer(t, models.NTPUnsynchronizedStratum, models.LeapNone, "", 0)
+	status := runStatusCheck(t, Endpoint{CheckType: "ntp", URL: addr, NTPMaxOffset: time.Second})
+	if status.ErrorMessage != "server is unsynchronized (stratum 16, leap indicator 0)" {
+		t.Errorf("expected stratum 16 to fail, got %q", status.ErrorMessage)
+	}
+
+	addr = startNTPServer(t, 3, models.LeapAlarm, "", 0)
+	status = runStatusCheck(t, Endpoint{CheckType: "ntp", URL: addr, NTPMaxOffset: time.Second})
+	if status.ErrorMessage != "server is unsynchronized (stratum 3, leap indicator 3)" {
+		t.Errorf("expected the leap alarm to fail, got %q", status.ErrorMessage)
+	}
+
+	addr = startNTPServer(t, 0, models.LeapAlarm, "RATE", 0)
+	status = runStatusCheck(t, Endpoint{CheckType: "ntp", URL: addr, NTPMaxOffset: time.Second})
+	if status.ErrorMessage != "server sent kiss-o'-death RATE" {
+		t.Errorf("expected the kiss code, got %q", status.ErrorMessage)
+	}
+}
+
+func TestNTPTimestampRoundTrip(t *testing.T) {
+	for _, want := range []time.Time{
+		time.Date(2026, 10, 18, 12, 30, 0, 250_000_000, time.UTC),
+		time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), // after the 2036 era rollover
+	} {
+		got := fromNTPTime(toNTPTime(want))
+		if diff := got.Sub(want).Abs(); diff > time.Microsecond {
+			t.Errorf("round trip of %s gave %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// maxScrapeSize caps how much of a metrics page is read
+const maxScrapeSize = 16 * 1024 * 1024
+
+// maxOffendingSeries is how many failing series an assertion lists before summarising the rest
+const maxOffendingSeries = 5
+
+// promSample is one series value from a text exposition
+type promSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// CheckPrometheusEndpoint scrapes a metrics page and evaluates the endpoint's metric assertions,
+// failing with the series that violate them
+func (w *Worker) CheckPrometheusEndpoint(ctx context.Context, ep Endpoint) Result {
+	start := time.Now()
+	code, samples, err := scrapeMetrics(ctx, ep)
+	responseTime := int(time.Since(start).Milliseconds())
+
+	var problems []string
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		for _, text := range ep.MetricAssertions {
+			assertion, err := models.ParseMetricAssertion(text)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", text, err))
+				continue
+			}
+			if problem := evaluateAssertion(assertion, samples); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	errorMessage := strings.Join(problems, "; ")
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         code,
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		CheckedAt:    start,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ Prometheus check PASSED for %s (%dms) - %d series, %d assertions", ep.URL, responseTime, len(samples), len(ep.MetricAssertions))
+	} else {
+		log.Printf("✗ Prometheus check FAILED for %s: %s", ep.URL, errorMessage)
+	}
+	return result
+}
+
+// scrapeMetrics fetches and parses the endpoint's metrics page, returning the HTTP status code
+func scrapeMetrics(ctx context.Context, ep Endpoint) (int, []promSample, error) {
+	transport, _, err := newHTTPTransport(ep)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Timeout: ep.Timeout, Transport: transport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.URL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, nil, fmt.Errorf("scrape returned %s", resp.Status)
+	}
+
+	samples, err := parseExposition(io.LimitReader(resp.Body, maxScrapeSize))
+	return resp.StatusCode, samples, err
+}
+
+// evaluateAssertion returns why the samples violate an assertion, or "" when they don't. Comparisons
+// have to hold for every selected series and fail when nothing is selected
+func evaluateAssertion(a *models.MetricAssertion, samples []promSample) string {
+	var matched, offending []string
+	for _, s := range samples {
+		if !a.Matches(s.Name, s.Labels) {
+			continue
+		}
+		series := formatSeries(s)
+		matched = append(matched, series)
+		if a.Op != "exists" && a.Op != "absent" && !a.Holds(s.Value) {
+			offending = append(offending, fmt.Sprintf("%s = %s", series, strconv.FormatFloat(s.Value, 'g', -1, 64)))
+		}
+	}
+
+	switch {
+	case a.Op == "absent":
+		if len(matched) > 0 {
+			return fmt.Sprintf("%s: found %s", a, matched[0])
+		}
+	case len(matched) == 0:
+		return fmt.Sprintf("%s: no series match", a)
+	case len(offending) > 0:
+		more := ""
+		if len(offending) > maxOffendingSeries {
+			more = fmt.Sprintf(" and %d more", len(offending)-maxOffendingSeries)
+			offending = offending[:maxOffendingSeries]
+		}
+		return fmt.Sprintf("%s: %s%s", a, strings.Join(offending, ", "), more)
+	}
+	return ""
+}
+
+func formatSeries(s promSample) string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, s.Labels[name])
+	}
+	return s.Name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// parseExposition reads the Prometheus text exposition format (and the OpenMetrics text that most
+// exporters also serve), skipping comments and timestamps
+func parseExposition(r io.Reader) ([]promSample, error) {
+	var samples []promSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parseSampleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("metrics line %d: %v", lineNumber, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+func parseSampleLine(line string) (promSample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return promSample{}, fmt.Errorf("malformed sample %q", line)
+	}
+	s := promSample{Name: line[:end], Labels: map[string]string{}}
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if rest, err = parseSampleLabels(rest[1:], s.Labels); err != nil {
+			return promSample{}, err
+		}
+	}
+
+	if exemplar := strings.Index(rest, " # "); exemplar >= 0 {
+		rest = rest[:exemplar] // OpenMetrics exemplar
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return promSample{}, fmt.Errorf("malformed sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return promSample{}, fmt.Errorf("bad value %q for %s", fields[0], s.Name)
+	}
+	s.Value = value
+	return s, nil
+}
+
+// parseSampleLabels reads name="value" pairs up to the closing brace into labels and returns the
+// rest of the line
+func parseSampleLabels(rest string, labels map[string]string) (string, error) {
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, "}") {
+			return rest[1:], nil
+		}
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("malformed labels")
+		}
+		name := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimLeft(rest[eq+1:], " \t")
+		if !strings.HasPrefix(rest, `"`) {
+			return "", fmt.Errorf("label %s value isn't quoted", name)
+		}
+
+		// Values escape only backslash, double quote and newline
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			value.WriteByte(rest[i])
+		}
+		if i >= len(rest) {
+			return "", fmt.Errorf("label %s value isn't terminated", name)
+		}
+		labels[name] = value.String()
+		rest = strings.TrimLeft(rest[i+1:], " \t")
+		if strings.HasPrefix(rest, ",") {
+			rest = rest[1:]
+		} else if !strings.HasPrefix(rest, "}") {
+			return "", fmt.Errorf("malformed labels after %s", name)
+		}
+	}
+}
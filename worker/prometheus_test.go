@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/monty/models"
+)
+
+const testExposition = `# HELP queue_depth Jobs waiting per queue.
+# TYPE queue_depth gauge
+queue_depth{queue="emails"} 1500
+queue_depth{queue="webhooks",region="eu"} 12 1700000000000
+queue_depth{queue="reports\"daily\""} 3
+# HELP up Whether the last scrape worked.
+up 1
+worker_errors_total{kind="timeout"} 7 # {trace_id="abc"} 1.0
+temperature_celsius NaN
+`
+
+func startMetricsServer(t *testing.T, status int, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/metrics"
+}
+
+func TestPrometheusAssertionsPass(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	url := startMetricsServer(t, http.StatusOK, testExposition)
+
+	status := runStatusCheck(t, Endpoint{CheckType: "prometheus", URL: url, MetricAssertions: []string{
+		`queue_depth{queue="webhooks"} < 1000`,
+		`queue_depth{queue=~"rep.*"} == 3`,
+		`up exists`,
+		`up >= 1`,
+		`worker_errors_total{kind!="timeout"} absent`,
+		`missing_metric absent`,
+	}})
+	if status.Code != http.StatusOK || status.ErrorMessage != "" {
+		t.Errorf("expected all assertions to hold, got %d %q", status.Code, status.ErrorMessage)
+	}
+}
+
+func TestPrometheusAssertionsFail(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	url := startMetricsServer(t, http.StatusOK, testExposition)
+
+	status := runStatusCheck(t, Endpoint{CheckType: "prometheus", URL: url, MetricAssertions: []string{
+		`queue_depth < 1000`,
+		`queue_depth{queue="sms"} exists`,
+		`temperature_celsius < 80`,
+		`worker_errors_total absent`,
+	}})
+	want := []string{
+		`queue_depth < 1000: queue_depth{queue="emails"} = 1500`,
+		`queue_depth{queue="sms"} exists: no series match`,
+		`temperature_celsius < 80: temperature_celsius = NaN`,
+		`worker_errors_total absent: found worker_errors_total{kind="timeout"}`,
+	}
+	if status.ErrorMessage != strings.Join(want, "; ") {
+		t.Errorf("unexpected error message %q", status.ErrorMessage)
+	}
+}
+
+func TestPrometheusScrapeFailures(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+
+	down := startMetricsServer(t, http.StatusServiceUnavailable, "down")
+	status := runStatusCheck(t, Endpoint{CheckType: "prometheus", URL: down, MetricAssertions: []string{"up exists"}})
+	if status.Code != http.StatusServiceUnavailable || status.ErrorMessage != "scrape returned 503 Service Unavailable" {
+		t.Errorf("unexpected status %d %q", status.Code, status.ErrorMessage)
+	}
+
+	broken := startMetricsServer(t, http.StatusOK, "up 1\nbroken{a=\"b\" 2\n")
+	status = runStatusCheck(t, Endpoint{CheckType: "prometheus", URL: broken, MetricAssertions: []string{"up exists"}})
+	if !strings.HasPrefix(status.ErrorMessage, "metrics line 2: ") {
+		t.Errorf("expected the parse error, got %q", status.ErrorMessage)
+	}
+}
+
+func TestParseExposition(t *testing.T) {
+	samples, err := parseExposition(strings.NewReader(testExposition))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(samples) != 6 {
+		t.Fatalf("expected 6 samples, got %d", len(samples))
+	}
+	if got := formatSeries(samples[2]); got != `queue_depth{queue="reports\"daily\""}` {
+		t.Errorf("unexpected escaped series %s", got)
+	}
+	if samples[1].Labels["region"] != "eu" || samples[1].Value != 12 {
+		t.Errorf("unexpected labelled sample %+v", samples[1])
+	}
+	if samples[4].Value != 7 {
+		t.Errorf("expected the exemplar to be ignored, got %+v", samples[4])
+	}
+}
+
+func TestParseMetricAssertion(t *testing.T) {
+	for text, valid := range map[string]bool{
+		`queue_depth{queue="emails"} < 1000`:         true,
+		`http_requests_total{code=~"5..",job!=""}>0`: true,
+		`up exists`:                     true,
+		`up absent`:                     true,
+		`up`:                            false,
+		`up < lots`:                     false,
+		`queue_depth{queue=emails} < 1`: false,
+		`queue_depth{queue=~"("} < 1`:   false,
+		`{queue="emails"} < 1`:          false,
+	} {
+		if _, err := models.ParseMetricAssertion(text); (err == nil) != valid {
+			t.Errorf("ParseMetricAssertion(%q) error = %v, want valid %v", text, err, valid)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// checkWithRetries runs c until it passes or ep's retries are used up, waiting the retry interval
+// in between, and records the last run with the number of attempts it took. A run cut short by
+// ctx says nothing about the endpoint and isn't recorded, a failure while the canaries are
+// unreachable is recorded as unknown. The check holds its executor slots through the waits, which
+// the executor's stats count as retry_waiting
+func (w *Worker) checkWithRetries(ctx context.Context, ep Endpoint, c Checker) {
+	for attempt := 1; ; attempt++ {
+		result := c.Check(ctx, w, ep)
+		if ctx.Err() != nil {
+			log.Printf("Discarding result of %s, the check was cancelled", checkTarget(ep))
+			return
+		}
+		if result.Passed || attempt > ep.Retries {
+			w.markUnknown(ctx, ep, &result)
+			w.record(ep, result, attempt)
+			return
+		}
+
+		log.Printf("Retrying check of %s in %s after failed attempt %d of %d", checkTarget(ep), ep.RetryInterval, attempt, ep.Retries+1)
+		if !w.waitRetry(ctx, ep.RetryInterval) {
+			return
+		}
+	}
+}
+
+// waitRetry waits d before a retry and reports whether ctx is still live
+func (w *Worker) waitRetry(ctx context.Context, d time.Duration) bool {
+	if w.executor != nil {
+		w.executor.retryWaiting(1)
+		defer w.executor.retryWaiting(-1)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
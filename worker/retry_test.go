@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// flakyServer answers with a 503 to its first failures requests and with a 200 after that
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRetryRecoversFromTransientFailure(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, requests := flakyServer(t, 1)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: time.Second, MaxResponseTime: time.Second, Retries: 2, RetryInterval: 10 * time.Millisecond}
+
+	NewWorker(time.Hour).runCheck(context.Background(), ep)
+
+	statuses := statusesOf(t, ep.ID)
+	if len(statuses) != 1 {
+		t.Fatalf("expected only the passing run to be recorded, got %d statuses", len(statuses))
+	}
+	if statuses[0].Code != http.StatusOK || statuses[0].Attempts != 2 {
+		t.Errorf("expected a 200 after 2 attempts, got %d after %d", statuses[0].Code, statuses[0].Attempts)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected no further retries once the check passed, got %d requests", requests.Load())
+	}
+}
+
+func TestRetryRecordsFailureWhenExhausted(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, requests := flakyServer(t, 10)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: time.Second, MaxResponseTime: time.Second, Retries: 2, RetryInterval: 10 * time.Millisecond}
+
+	NewWorker(time.Hour).runCheck(context.Background(), ep)
+
+	statuses := statusesOf(t, ep.ID)
+	if len(statuses) != 1 {
+		t.Fatalf("expected one recorded failure, got %d statuses", len(statuses))
+	}
+	if statuses[0].Code != http.StatusServiceUnavailable || statuses[0].Attempts != 3 {
+		t.Errorf("expected a 503 after 3 attempts, got %d after %d", statuses[0].Code, statuses[0].Attempts)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("expected the check and 2 retries, got %d requests", requests.Load())
+	}
+}
+
+func TestNoRetriesRecordsFirstFailure(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, requests := flakyServer(t, 1)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: time.Second, MaxResponseTime: time.Second}
+
+	NewWorker(time.Hour).runCheck(context.Background(), ep)
+
+	statuses := statusesOf(t, ep.ID)
+	if len(statuses) != 1 || statuses[0].Code != http.StatusServiceUnavailable || statuses[0].Attempts != 1 {
+		t.Fatalf("expected the failure recorded after 1 attempt, got %+v", statuses)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request, got %d", requests.Load())
+	}
+}
+
+func TestRetryWaitHoldsExecutorSlot(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, _ := flakyServer(t, 10)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Timeout: time.Second, MaxResponseTime: time.Second, Retries: 1, RetryInterval: 300 * time.Millisecond}
+	w := NewWorker(time.Hour)
+
+	w.executor.submit(ep, func() { w.runCheck(context.Background(), ep) })
+	deadline := time.Now().Add(2 * time.Second)
+	for w.executor.Stats().RetryWaiting == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed check never started waiting to retry")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := w.executor.Stats(); stats.Running != 1 || stats.RetryWaiting != 1 {
+		t.Errorf("expected the waiting check to keep its slot, got %+v", stats)
+	}
+
+	if err := w.executor.wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if stats := w.executor.Stats(); stats.Running != 0 || stats.RetryWaiting != 0 {
+		t.Errorf("expected the slot released after the retry, got %+v", stats)
+	}
+}
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// scheduleInterval is how often an endpoint's monitor runs its check
+func scheduleInterval(ep Endpoint) time.Duration {
+	interval := ep.Interval
+	if ep.CheckType == "heartbeat" && interval > heartbeatEvaluationInterval {
+		// Heartbeats are passive, re-evaluate often so late pings are noticed promptly
+		interval = heartbeatEvaluationInterval
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return interval
+}
+
+// phaseOffset is where in each interval an endpoint's checks run. It's derived from the endpoint's
+// ID, so monitors started together don't tick in lockstep and an endpoint keeps its slot across
+// restarts
+func phaseOffset(ep Endpoint, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(ep.ID))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// nextRun returns the first of the endpoint's slots after t
+func nextRun(ep Endpoint, t time.Time) time.Time {
+	interval := scheduleInterval(ep)
+	phase := phaseOffset(ep, interval)
+	since := time.Duration(t.UnixNano()) - phase
+	slot := (since/interval + 1) * interval
+	return time.Unix(0, int64(slot+phase))
+}
+
+// firstRun returns when a starting monitor runs its first check: right away when the endpoint has
+// never been checked or its persisted next run has passed, otherwise at that next run. A next run
+// further off than the interval, left from before the interval was shortened, moves to the next slot
+func firstRun(ep Endpoint, now time.Time) time.Time {
+	if ep.NextCheckAt.IsZero() || !ep.NextCheckAt.After(now) {
+		return now
+	}
+	if ep.NextCheckAt.Sub(now) > scheduleInterval(ep) {
+		return nextRun(ep, now)
+	}
+	return ep.NextCheckAt
+}
+
+// saveNextCheck persists when an endpoint's next check is due, so a restart doesn't reset it
+func saveNextCheck(endpointID string, next time.Time) {
+	// UpdateColumn skips the endpoint's validation hooks, this isn't a configuration change
+	err := models.DB.Model(&models.Endpoint{}).Where("id = ?", endpointID).UpdateColumn("next_check_at", next).Error
+	if err != nil {
+		log.Printf("failed to save next check time of endpoint %s: %v", endpointID, err)
+	}
+}
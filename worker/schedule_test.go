@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func TestNextRunKeepsPhase(t *testing.T) {
+	ep := Endpoint{ID: "api-health", Interval: time.Minute}
+	phase := phaseOffset(ep, time.Minute)
+	if phase != phaseOffset(ep, time.Minute) || phase < 0 || phase >= time.Minute {
+		t.Fatalf("expected a stable phase within the interval, got %s", phase)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	next := nextRun(ep, now)
+	if !next.After(now) || next.Sub(now) > time.Minute {
+		t.Fatalf("expected the next run within an interval, got %s", next)
+	}
+	if after := nextRun(ep, next); after.Sub(next) != time.Minute {
+		t.Errorf("expected runs an interval apart, got %s then %s", next, after)
+	}
+	if got := time.Duration(next.UnixNano()) % time.Minute; got != phase {
+		t.Errorf("expected runs on the endpoint's phase %s, got %s", phase, got)
+	}
+}
+
+func TestPhaseOffsetsSpreadEndpoints(t *testing.T) {
+	seconds := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		ep := Endpoint{ID: fmt.Sprintf("endpoint-%d", i), Interval: time.Minute}
+		seconds[phaseOffset(ep, time.Minute).Truncate(time.Second)] = true
+	}
+	if len(seconds) < 30 {
+		t.Errorf("expected 100 endpoints to spread over the minute, got %d distinct seconds", len(seconds))
+	}
+}
+
+func TestFirstRun(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	ep := Endpoint{ID: "cert", CheckType: "ssl", Interval: 24 * time.Hour}
+
+	if got := firstRun(ep, now); !got.Equal(now) {
+		t.Errorf("expected a never checked endpoint to run right away, got %s", got)
+	}
+	ep.NextCheckAt = now.Add(-time.Hour)
+	if got := firstRun(ep, now); !got.Equal(now) {
+		t.Errorf("expected an overdue endpoint to run right away, got %s", got)
+	}
+	ep.NextCheckAt = now.Add(20 * time.Hour)
+	if got := firstRun(ep, now); !got.Equal(ep.NextCheckAt) {
+		t.Errorf("expected the persisted next run to survive a restart, got %s", got)
+	}
+	ep.Interval = time.Hour
+	if got := firstRun(ep, now); !got.Equal(nextRun(ep, now)) {
+		t.Errorf("expected a next run beyond a shortened interval to move to the next slot, got %s", got)
+	}
+}
+
+func TestMonitorRunsFirstCheckImmediately(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	stored := &models.Endpoint{ID: uuid.New().String(), URL: srv.URL, Interval: 3600}
+	if err := models.DB.Create(stored).Error; err != nil {
+		t.Fatalf("failed to create endpoint: %v", err)
+	}
+	ep := EndpointFromModel(*stored)
+
+	w := NewWorker(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.monitorEndpoint(ctx, ep)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var count int64
+		models.DB.Model(&models.Status{}).Where("endpoint_id = ?", ep.ID).Count(&count)
+		var saved models.Endpoint
+		models.DB.First(&saved, "id = ?", ep.ID)
+		if count == 1 && saved.NextCheckAt != nil {
+			if want := nextRun(ep, time.Now()); saved.NextCheckAt.Sub(want).Abs() > time.Minute {
+				t.Errorf("expected the next check in the endpoint's next slot %s, got %s", want, saved.NextCheckAt)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the first check to run right away, got %d statuses", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,225 @@
+package worker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// hstsMinMaxAge is the shortest HSTS max-age that isn't penalised, 180 days
+const hstsMinMaxAge = 180 * 24 * 60 * 60
+
+// hstsPreloadMaxAge is the max-age the preload list requires, a year
+const hstsPreloadMaxAge = 365 * 24 * 60 * 60
+
+// maxCookiePenalty caps how much insecure cookies can take off the score together
+const maxCookiePenalty = 20
+
+// securityAudit grades a response's security headers, starting from 100 and taking off each
+// finding's penalty
+type securityAudit struct {
+	ep       Endpoint
+	findings []models.SecurityHeaderFinding
+}
+
+func (a *securityAudit) add(header, severity string, penalty int, value, format string, args ...interface{}) {
+	a.findings = append(a.findings, models.SecurityHeaderFinding{
+		ID:         uuid.New().String(),
+		EndpointID: a.ep.ID,
+		Header:     header,
+		Severity:   severity,
+		Message:    fmt.Sprintf(format, args...),
+		Value:      value,
+		Penalty:    penalty,
+	})
+}
+
+// auditSecurityHeaders grades the final response of an HTTP check and returns the grade, the score
+// and the findings behind it
+func auditSecurityHeaders(ep Endpoint, resp *http.Response) (string, int, []models.SecurityHeaderFinding) {
+	a := &securityAudit{ep: ep}
+	header := resp.Header
+	csp := header.Get("Content-Security-Policy")
+
+	https := resp.Request != nil && resp.Request.URL.Scheme == "https"
+	if https {
+		a.checkHSTS(header.Get("Strict-Transport-Security"))
+	} else {
+		a.add("Strict-Transport-Security", models.SeverityError, 25, "", "served over plain HTTP, HSTS can't protect it")
+	}
+	a.checkCSP(csp, header.Get("Content-Security-Policy-Report-Only"))
+
+	if xcto := header.Get("X-Content-Type-Options"); !strings.EqualFold(strings.TrimSpace(xcto), "nosniff") {
+		a.add("X-Content-Type-Options", models.SeverityWarning, 10, xcto, "should be nosniff")
+	}
+	a.checkFraming(header.Get("X-Frame-Options"), csp)
+	a.checkReferrerPolicy(header.Get("Referrer-Policy"))
+	a.checkCookies(resp.Cookies(), https)
+
+	score := 100
+	for _, finding := range a.findings {
+		score -= finding.Penalty
+	}
+	if score < 0 {
+		score = 0
+	}
+	grade := "F"
+	for _, g := range models.SecurityGrades {
+		if score >= g.MinScore {
+			grade = g.Grade
+			break
+		}
+	}
+	return grade, score, a.findings
+}
+
+func (a *securityAudit) checkHSTS(value string) {
+	const name = "Strict-Transport-Security"
+	if value == "" {
+		a.add(name, models.SeverityError, 25, "", "missing, browsers may be downgraded to HTTP")
+		return
+	}
+
+	maxAge := -1
+	includeSubDomains, preload := false, false
+	for _, directive := range strings.Split(value, ";") {
+		key, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(strings.TrimSpace(arg), `"`)); err == nil {
+				maxAge = n
+			}
+		case "includesubdomains":
+			includeSubDomains = true
+		case "preload":
+			preload = true
+		}
+	}
+
+	switch {
+	case maxAge < 0:
+		a.add(name, models.SeverityError, 25, value, "max-age is missing or invalid")
+		return
+	case maxAge == 0:
+		a.add(name, models.SeverityError, 25, value, "max-age=0 turns HSTS off")
+		return
+	case maxAge < hstsMinMaxAge:
+		a.add(name, models.SeverityWarning, 10, value, "max-age of %d seconds is under 180 days", maxAge)
+	}
+	if !includeSubDomains {
+		a.add(name, models.SeverityInfo, 5, value, "includeSubDomains is not set")
+	}
+	if preload && (!includeSubDomains || maxAge < hstsPreloadMaxAge) {
+		a.add(name, models.SeverityWarning, 5, value, "preload needs includeSubDomains and a max-age of at least a year")
+	} else if !preload {
+		a.add(name, models.SeverityInfo, 0, value, "preload is not set")
+	}
+}
+
+func (a *securityAudit) checkCSP(csp, reportOnly string) {
+	const name = "Content-Security-Policy"
+	if csp == "" {
+		if reportOnly != "" {
+			a.add("Content-Security-Policy-Report-Only", models.SeverityWarning, 15, reportOnly, "policy is only reported, not enforced")
+		} else {
+			a.add(name, models.SeverityError, 25, "", "missing, nothing limits what the page may load")
+		}
+		return
+	}
+
+	directives := cspDirectives(csp)
+	scripts, ok := directives["script-src"]
+	if !ok {
+		scripts, ok = directives["default-src"]
+	}
+	if !ok {
+		a.add(name, models.SeverityWarning, 10, csp, "no script-src or default-src, scripts aren't restricted")
+		return
+	}
+	for _, source := range scripts {
+		switch strings.ToLower(source) {
+		case "'unsafe-inline'":
+			a.add(name, models.SeverityWarning, 10, csp, "scripts allow 'unsafe-inline'")
+		case "'unsafe-eval'":
+			a.add(name, models.SeverityWarning, 5, csp, "scripts allow 'unsafe-eval'")
+		case "*", "http:", "https:":
+			a.add(name, models.SeverityWarning, 10, csp, "scripts may load from %s", source)
+		}
+	}
+}
+
+// cspDirectives splits a policy into its directives, lowercasing names
+func cspDirectives(csp string) map[string][]string {
+	directives := make(map[string][]string)
+	for _, directive := range strings.Split(csp, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(fields[0])
+		if _, seen := directives[name]; !seen {
+			directives[name] = fields[1:] // Browsers ignore repeated directives
+		}
+	}
+	return directives
+}
+
+func (a *securityAudit) checkFraming(xfo, csp string) {
+	if csp != "" {
+		if _, ok := cspDirectives(csp)["frame-ancestors"]; ok {
+			return // frame-ancestors supersedes X-Frame-Options
+		}
+	}
+	switch strings.ToUpper(strings.TrimSpace(xfo)) {
+	case "DENY", "SAMEORIGIN":
+	case "":
+		a.add("X-Frame-Options", models.SeverityWarning, 15, "", "no X-Frame-Options or CSP frame-ancestors, the page can be framed for clickjacking")
+	default:
+		a.add("X-Frame-Options", models.SeverityWarning, 15, xfo, "should be DENY or SAMEORIGIN, use CSP frame-ancestors for anything else")
+	}
+}
+
+func (a *securityAudit) checkReferrerPolicy(value string) {
+	const name = "Referrer-Policy"
+	if value == "" {
+		a.add(name, models.SeverityWarning, 10, "", "missing, browsers fall back to their default")
+		return
+	}
+	// The last policy a browser understands wins
+	policies := strings.Split(value, ",")
+	switch policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1])); policy {
+	case "unsafe-url":
+		a.add(name, models.SeverityWarning, 10, value, "unsafe-url leaks full URLs to every site, even over HTTP")
+	case "no-referrer-when-downgrade", "origin-when-cross-origin":
+		a.add(name, models.SeverityInfo, 5, value, "%s sends full URLs to other sites", policy)
+	}
+}
+
+func (a *securityAudit) checkCookies(cookies []*http.Cookie, https bool) {
+	penalty := 0
+	take := func(points int) int {
+		points = min(points, maxCookiePenalty-penalty)
+		penalty += points
+		return points
+	}
+	for _, cookie := range cookies {
+		if https && !cookie.Secure {
+			a.add("Set-Cookie", models.SeverityWarning, take(10), cookie.Name, "cookie %s is missing Secure", cookie.Name)
+		}
+		if !cookie.HttpOnly {
+			a.add("Set-Cookie", models.SeverityInfo, take(5), cookie.Name, "cookie %s is missing HttpOnly", cookie.Name)
+		}
+		switch cookie.SameSite {
+		case 0, http.SameSiteDefaultMode:
+			a.add("Set-Cookie", models.SeverityWarning, take(5), cookie.Name, "cookie %s has no SameSite attribute", cookie.Name)
+		case http.SameSiteNoneMode:
+			if !cookie.Secure {
+				a.add("Set-Cookie", models.SeverityWarning, take(5), cookie.Name, "cookie %s is SameSite=None without Secure, browsers reject it", cookie.Name)
+			}
+		}
+	}
+}
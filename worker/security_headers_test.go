@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func hardenedHandler(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
+	h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+	http.SetCookie(w, &http.Cookie{Name: "session", Value: "x", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+func auditResponse(t *testing.T, scheme string, handler http.HandlerFunc) (string, int, []models.SecurityHeaderFinding) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, scheme+"://example.com/", nil)
+	handler(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return auditSecurityHeaders(Endpoint{ID: "ep"}, resp)
+}
+
+func TestAuditSecurityHeadersHardened(t *testing.T) {
+	grade, score, findings := auditResponse(t, "https", hardenedHandler)
+	if grade != "A+" || score != 100 || len(findings) != 0 {
+		t.Errorf("expected a clean A+, got %s %d %+v", grade, score, findings)
+	}
+}
+
+func TestAuditSecurityHeadersWeak(t *testing.T) {
+	grade, score, findings := auditResponse(t, "https", func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Strict-Transport-Security", "max-age=3600; preload")
+		h.Set("Content-Security-Policy", "script-src 'self' 'unsafe-inline'")
+		h.Set("X-Frame-Options", "ALLOW-FROM https://partner.example")
+		h.Set("Referrer-Policy", "unsafe-url")
+		h.Add("Set-Cookie", "session=x; Path=/")
+		h.Add("Set-Cookie", "prefs=y; Secure; HttpOnly; SameSite=None")
+	})
+
+	var messages []string
+	for _, f := range findings {
+		messages = append(messages, f.Message)
+	}
+	want := []string{
+		"max-age of 3600 seconds is under 180 days",
+		"includeSubDomains is not set",
+		"preload needs includeSubDomains and a max-age of at least a year",
+		"scripts allow 'unsafe-inline'",
+		"should be nosniff",
+		"should be DENY or SAMEORIGIN, use CSP frame-ancestors for anything else",
+		"unsafe-url leaks full URLs to every site, even over HTTP",
+		"cookie session is missing Secure",
+		"cookie session is missing HttpOnly",
+		"cookie session has no SameSite attribute",
+	}
+	if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected findings:\n%s", strings.Join(messages, "\n"))
+	}
+	// 100 - 10 - 5 - 5 - 10 - 10 - 15 - 10 - (10 + 5 + 5 cookies)
+	if score != 15 || grade != "F" {
+		t.Errorf("expected F with 15 points, got %s %d", grade, score)
+	}
+}
+
+func TestAuditSecurityHeadersPlainHTTP(t *testing.T) {
+	grade, _, findings := auditResponse(t, "http", hardenedHandler)
+	if grade != "B" || len(findings) != 1 || findings[0].Header != "Strict-Transport-Security" {
+		t.Errorf("expected HSTS to be flagged over plain HTTP, got %s %+v", grade, findings)
+	}
+}
+
+func TestHTTPCheckFailsBelowMinSecurityGrade(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}))
+	defer srv.Close()
+
+	ep := Endpoint{
+		ID:               uuid.New().String(),
+		URL:              srv.URL,
+		Timeout:          5 * time.Second,
+		MaxResponseTime:  5 * time.Second,
+		SecurityHeaders:  true,
+		MinSecurityGrade: "C",
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.SecurityGrade != "F" || status.ErrorMessage != "security headers graded F, below C" {
+		t.Errorf("expected the grade to fail the check, got %q %q", status.SecurityGrade, status.ErrorMessage)
+	}
+	var findings []models.SecurityHeaderFinding
+	db.Where("status_id = ?", status.ID).Find(&findings)
+	if len(findings) != 4 {
+		t.Errorf("expected HSTS, CSP, framing and referrer findings, got %+v", findings)
+	}
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// hangingServer holds every request until the client gives up or the test ends, reporting
+// arrivals on started and client cancellations on cancelled
+func hangingServer(t *testing.T) (srv *httptest.Server, started, cancelled chan struct{}) {
+	t.Helper()
+	started = make(chan struct{}, 10)
+	cancelled = make(chan struct{}, 10)
+	release := make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-release:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	return srv, started, cancelled
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func countStatuses(endpointID string) int64 {
+	var count int64
+	models.DB.Model(&models.Status{}).Where("endpoint_id = ?", endpointID).Count(&count)
+	return count
+}
+
+func TestStopMonitoringCancelsRunningCheck(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, started, cancelled := hangingServer(t)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Interval: time.Hour, Timeout: 30 * time.Second}
+
+	w := NewWorker(time.Hour)
+	w.startMonitoring(ep)
+	waitFor(t, started, "the check to start")
+	w.stopMonitoring(ep.ID)
+	waitFor(t, cancelled, "the request to be cancelled")
+
+	waitForStats(t, w.executor, func(s ExecutorStats) bool { return s.Completed == 1 })
+	if n := countStatuses(ep.ID); n != 0 {
+		t.Errorf("expected the cancelled check's result to be discarded, got %d statuses", n)
+	}
+}
+
+func TestShutdownDrainsRunningChecks(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Interval: time.Hour, Timeout: 30 * time.Second}
+
+	w := NewWorker(time.Hour)
+	w.Start([]Endpoint{ep})
+	waitForStats(t, w.executor, func(s ExecutorStats) bool { return s.Running == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("expected the running check to finish in time, got %v", err)
+	}
+	if n := countStatuses(ep.ID); n != 1 {
+		t.Errorf("expected the drained check's result to be saved, got %d statuses", n)
+	}
+	if w.executor.submit(ep, func() {}) {
+		t.Errorf("expected no checks to be accepted after shutdown")
+	}
+}
+
+func TestShutdownCancelsChecksAtDeadline(t *testing.T) {
+	models.DB = setupTestDB(t)
+	srv, started, cancelled := hangingServer(t)
+	ep := Endpoint{ID: uuid.New().String(), URL: srv.URL, Interval: time.Hour, Timeout: 30 * time.Second}
+
+	w := NewWorker(time.Hour)
+	w.Start([]Endpoint{ep})
+	waitFor(t, started, "the check to start")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := w.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to pass, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Errorf("expected the check to be cancelled rather than run to its timeout, took %s", elapsed)
+	}
+	waitFor(t, cancelled, "the request to be cancelled")
+	if n := countStatuses(ep.ID); n != 0 {
+		t.Errorf("expected the cancelled check's result to be discarded, got %d statuses", n)
+	}
+}
+
+// blockingRemote is a remote whose server doesn't answer until released
+type blockingRemote struct {
+	fakeRemote
+	fetching chan struct{}
+	release  chan struct{}
+}
+
+func (r *blockingRemote) Endpoints() ([]models.Endpoint, error) {
+	close(r.fetching)
+	<-r.release
+	return r.endpoints, nil
+}
+
+func TestShutdownDoesNotWaitForRemoteDiscovery(t *testing.T) {
+	remote := &blockingRemote{fetching: make(chan struct{}), release: make(chan struct{})}
+	defer close(remote.release)
+	w := NewRemoteWorker(remote, time.Hour)
+
+	go w.discoverEndpoints()
+	<-remote.fetching
+
+	done := make(chan error, 1)
+	go func() { done <- w.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("shutdown failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown waited for the remote to answer")
+	}
+}
@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshClientVersion is how ssh checks identify themselves in the server's logs
+const sshClientVersion = "SSH-2.0-monty"
+
+// maxBannerBytes caps how much of the start of a connection is kept to find the server's version line
+const maxBannerBytes = 8 << 10
+
+// errHostKeyObtained aborts the handshake once the host key is known and there is nothing to
+// authenticate
+var errHostKeyObtained = errors.New("host key obtained")
+
+// sshProbe is what an ssh check learned about the server
+type sshProbe struct {
+	ip       string
+	banner   string
+	hostKey  ssh.PublicKey
+	mismatch string // why the host key failed the pin, empty when it matched or there is none
+}
+
+// bannerConn remembers the first bytes the server sends, the version line ssh.ClientConn only
+// exposes after a successful handshake. The client keeps reading in the background once connected
+type bannerConn struct {
+	net.Conn
+	mu   sync.Mutex
+	head bytes.Buffer
+}
+
+func (c *bannerConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	if room := maxBannerBytes - c.head.Len(); room > 0 {
+		c.head.Write(p[:min(n, room)])
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+// banner returns the server's version line. Servers may send other lines before it
+func (c *bannerConn) banner() string {
+	c.mu.Lock()
+	head := bytes.Clone(c.head.Bytes())
+	c.mu.Unlock()
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); strings.HasPrefix(line, "SSH-") {
+			return line
+		}
+	}
+	return ""
+}
+
+func (w *Worker) CheckSSHEndpoint(ctx context.Context, ep Endpoint) Result {
+	start := time.Now()
+	probe, err := probeSSH(ctx, ep)
+	responseTime := int(time.Since(start).Milliseconds())
+
+	errorMessage := ""
+	switch {
+	case err != nil:
+		errorMessage = err.Error()
+	case probe.mismatch != "":
+		errorMessage = probe.mismatch
+	}
+
+	hostKey := ""
+	if probe.hostKey != nil {
+		hostKey = probe.hostKey.Type() + " " + ssh.FingerprintSHA256(probe.hostKey)
+	}
+
+	status := models.Status{
+		ID:            uuid.New().String(),
+		EndpointID:    ep.ID,
+		ResponseTime:  responseTime,
+		ErrorMessage:  errorMessage,
+		RemoteIP:      probe.ip,
+		AddressFamily: resultFamily(ep, probe.ip),
+		SSHBanner:     probe.banner,
+		SSHHostKey:    hostKey,
+		CheckedAt:     time.Now(),
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+
+	if errorMessage == "" {
+		log.Printf("✓ SSH check PASSED for %s (%s, %s, %dms)", checkTarget(ep), probe.banner, hostKey, responseTime)
+	} else {
+		log.Printf("✗ SSH check FAILED for %s: %s", checkTarget(ep), errorMessage)
+	}
+	return result
+}
+
+// probeSSH connects to the endpoint and runs the SSH handshake until the host key is known, then
+// authenticates when a user and key are configured
+func probeSSH(ctx context.Context, ep Endpoint) (sshProbe, error) {
+	var probe sshProbe
+
+	var signer ssh.Signer
+	if ep.SSHKeyID != "" {
+		var key models.SSHKey
+		if err := models.DB.First(&key, "id = ?", ep.SSHKeyID).Error; err != nil {
+			return probe, fmt.Errorf("loading ssh key %s: %v", ep.SSHKeyID, err)
+		}
+		var err error
+		if signer, err = key.Signer(); err != nil {
+			return probe, fmt.Errorf("loading ssh key %s: %v", ep.SSHKeyID, err)
+		}
+	}
+
+	address := sshAddress(ep.URL)
+	conn, err := dialTCP(ctx, ep, address)
+	if err != nil {
+		return probe, err
+	}
+	defer conn.Close()
+	// Unblock the handshake when the check is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	probe.ip = targetIP(ep, conn)
+	if ep.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(ep.Timeout))
+	}
+
+	config := &ssh.ClientConfig{
+		User:          ep.SSHUsername,
+		ClientVersion: sshClientVersion,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			probe.hostKey = key
+			if ep.SSHHostKeyFingerprint != "" && !hostKeyMatches(key, ep.SSHHostKeyFingerprint) {
+				probe.mismatch = fmt.Sprintf("host key %s %s does not match pinned %s", key.Type(), ssh.FingerprintSHA256(key), ep.SSHHostKeyFingerprint)
+				return errors.New(probe.mismatch)
+			}
+			if signer == nil {
+				return errHostKeyObtained
+			}
+			return nil
+		},
+	}
+	if config.User == "" {
+		config.User = "monty"
+	}
+	if ep.SSHHostKeyAlgorithm != "" {
+		config.HostKeyAlgorithms = []string{ep.SSHHostKeyAlgorithm}
+	}
+	if signer != nil {
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	}
+
+	bc := &bannerConn{Conn: conn}
+	client, _, _, err := ssh.NewClientConn(bc, address, config)
+	probe.banner = bc.banner()
+	switch {
+	case err == nil:
+		client.Close()
+		return probe, nil
+	case probe.mismatch != "":
+		return probe, nil
+	case probe.hostKey == nil:
+		if probe.banner == "" {
+			return probe, fmt.Errorf("no SSH banner received: %v", err)
+		}
+		return probe, err
+	case signer == nil:
+		return probe, nil // stopped on purpose once the host key was known
+	default:
+		return probe, fmt.Errorf("authentication as %s failed: %v", ep.SSHUsername, err)
+	}
+}
+
+// sshAddress returns the host:port an ssh endpoint's URL names, port 22 unless it has one
+func sshAddress(url string) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(url, "ssh://"), "/")
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), "22")
+}
+
+// hostKeyMatches compares a host key with a pinned SHA256 or MD5 fingerprint
+func hostKeyMatches(key ssh.PublicKey, pin string) bool {
+	if strings.HasPrefix(pin, "SHA256:") {
+		return ssh.FingerprintSHA256(key) == pin
+	}
+	return ssh.FingerprintLegacyMD5(key) == pin
+}
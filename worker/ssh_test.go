@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/monty/models"
+	"golang.org/x/crypto/ssh"
+)
+
+func newSSHSigner(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return signer, pem.EncodeToMemory(block)
+}
+
+// startSSHServer runs an SSH server that accepts only authorized and returns its address and host key
+func startSSHServer(t *testing.T, authorized ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+	hostKey, _ := newSSHSigner(t)
+	config := &ssh.ServerConfig{
+		ServerVersion: "SSH-2.0-TestSSH_1.0",
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "deploy" && bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "no channels")
+				}
+				sconn.Close()
+			}()
+		}
+	}()
+	return ln.Addr().String(), hostKey.PublicKey()
+}
+
+func TestSSHCheckPinnedHostKey(t *testing.T) {
+	models.DB = setupTestDB(t)
+	clientKey, _ := newSSHSigner(t)
+	addr, hostKey := startSSHServer(t, clientKey.PublicKey())
+
+	status := runStatusCheck(t, Endpoint{CheckType: "ssh", URL: addr, SSHHostKeyFingerprint: ssh.FingerprintSHA256(hostKey)})
+	if status.ErrorMessage != "" {
+		t.Fatalf("expected the pinned key to pass, got %q", status.ErrorMessage)
+	}
+	if status.SSHBanner != "SSH-2.0-TestSSH_1.0" {
+		t.Errorf("unexpected banner %q", status.SSHBanner)
+	}
+	if status.SSHHostKey != "ssh-ed25519 "+ssh.FingerprintSHA256(hostKey) {
+		t.Errorf("unexpected host key %q", status.SSHHostKey)
+	}
+
+	status = runStatusCheck(t, Endpoint{CheckType: "ssh", URL: addr, SSHHostKeyFingerprint: ssh.FingerprintLegacyMD5(hostKey)})
+	if status.ErrorMessage != "" {
+		t.Errorf("expected an MD5 pin to match, got %q", status.ErrorMessage)
+	}
+}
+
+func TestSSHCheckHostKeyChanged(t *testing.T) {
+	models.DB = setupTestDB(t)
+	clientKey, _ := newSSHSigner(t)
+	addr, _ := startSSHServer(t, clientKey.PublicKey())
+	other, _ := newSSHSigner(t)
+	pin := ssh.FingerprintSHA256(other.PublicKey())
+
+	status := runStatusCheck(t, Endpoint{CheckType: "ssh", URL: addr, SSHHostKeyFingerprint: pin})
+	if !strings.HasSuffix(status.ErrorMessage, "does not match pinned "+pin) {
+		t.Errorf("expected a host key mismatch, got %q", status.ErrorMessage)
+	}
+	if status.SSHBanner == "" || status.SSHHostKey == "" {
+		t.Errorf("expected the banner and presented key to be recorded, got %+v", status)
+	}
+}
+
+func TestSSHCheckAuthentication(t *testing.T) {
+	models.DB = setupTestDB(t)
+	clientKey, clientPEM := newSSHSigner(t)
+	addr, _ := startSSHServer(t, clientKey.PublicKey())
+
+	key, err := models.NewSSHKey("deploy", clientPEM, "")
+	if err != nil {
+		t.Fatalf("store key: %v", err)
+	}
+	models.DB.Create(&key)
+	_, strangerPEM := newSSHSigner(t)
+	stranger, _ := models.NewSSHKey("stranger", strangerPEM, "")
+	models.DB.Create(&stranger)
+
+	status := runStatusCheck(t, Endpoint{CheckType: "ssh", URL: addr, SSHUsername: "deploy", SSHKeyID: key.ID})
+	if status.ErrorMessage != "" {
+		t.Errorf("expected authentication to succeed, got %q", status.ErrorMessage)
+	}
+
+	status = runStatusCheck(t, Endpoint{CheckType: "ssh", URL: addr, SSHUsername: "deploy", SSHKeyID: stranger.ID})
+	if !strings.HasPrefix(status.ErrorMessage, "authentication as deploy failed: ") {
+		t.Errorf("expected authentication to fail, got %q", status.ErrorMessage)
+	}
+}
+
+func TestSSHCheckNotSSH(t *testing.T) {
+	models.DB = setupTestDB(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("220 smtp.example.com ESMTP\r\n"))
+		conn.Close()
+	}()
+
+	status := runStatusCheck(t, Endpoint{CheckType: "ssh", URL: ln.Addr().String()})
+	if !strings.HasPrefix(status.ErrorMessage, "no SSH banner received") {
+		t.Errorf("expected a missing banner, got %q", status.ErrorMessage)
+	}
+}
+
+func TestSSHAddress(t *testing.T) {
+	for url, want := range map[string]string{
+		"bastion.example.com":      "bastion.example.com:22",
+		"bastion.example.com:2222": "bastion.example.com:2222",
+		"ssh://10.0.0.1":           "10.0.0.1:22",
+		"[2001:db8::1]":            "[2001:db8::1]:22",
+		"[2001:db8::1]:2222":       "[2001:db8::1]:2222",
+	} {
+		if got := sshAddress(url); got != want {
+			t.Errorf("sshAddress(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/monty/models"
+)
+
+// loadClientCertificate returns the endpoint's client certificate for mutual TLS, nil when none is configured
+func loadClientCertificate(ep Endpoint) (*models.ClientCertificate, error) {
+	if ep.ClientCertificateID == "" {
+		return nil, nil
+	}
+	var cred models.ClientCertificate
+	if err := models.DB.First(&cred, "id = ?", ep.ClientCertificateID).Error; err != nil {
+		return nil, fmt.Errorf("loading client certificate %s: %v", ep.ClientCertificateID, err)
+	}
+	return &cred, nil
+}
+
+// newTLSConfig returns a copy of base (which may be nil) presenting cred when it is set
+func newTLSConfig(base *tls.Config, cred *models.ClientCertificate) (*tls.Config, error) {
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if cred != nil {
+		pair, err := cred.TLSCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("client certificate %s: %v", cred.Name, err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
+
+// newHTTPTransport returns the transport used for an endpoint's HTTP requests, including
+// its client certificate, proxy and address family. It serves one check, whose caller closes its
+// idle connections when done, they would otherwise stay open with nothing to reuse them
+func newHTTPTransport(ep Endpoint) (*http.Transport, *models.ClientCertificate, error) {
+	cred, err := loadClientCertificate(ep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	proxyURL, err := parseProxyURL(ep.ProxyURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &familyDialer{
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}, // as http.DefaultTransport
+		family: ep.AddressFamily,
+	}
+	transport.DialContext = dialer.DialContext
+	if proxyURL != nil {
+		// The transport speaks both HTTP CONNECT and SOCKS5 proxies natively
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if transport.TLSClientConfig, err = newTLSConfig(transport.TLSClientConfig, cred); err != nil {
+		return nil, nil, err
+	}
+	return transport, cred, nil
+}
+
+// checkClientCertificateExpiry warns about a client certificate close to expiry the same way
+// server certificates are judged against MinDaysValid, and reports whether it has expired
+func checkClientCertificateExpiry(ep Endpoint, cred *models.ClientCertificate, now time.Time) (daysUntilExpiry int, expired bool) {
+	daysUntilExpiry = int(cred.ExpiresAt.Sub(now).Hours() / 24)
+	expired = now.After(cred.ExpiresAt)
+	if expired {
+		log.Printf("✗ Client certificate %s for %s expired on %s", cred.Name, ep.URL, cred.ExpiresAt.Format(time.RFC3339))
+	} else if daysUntilExpiry < ep.MinDaysValid {
+		log.Printf("⚠ Client certificate %s for %s expires in %d days", cred.Name, ep.URL, daysUntilExpiry)
+	}
+	return daysUntilExpiry, expired
+}
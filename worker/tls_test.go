@@ -0,0 +1,197 @@
+package worker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// newTestClientCertificate issues a client certificate from a throwaway CA and returns
+// the stored credential together with a pool trusting that CA
+func newTestClientCertificate(t *testing.T, notAfter time.Time) (models.ClientCertificate, *x509.CertPool) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "monty"},
+		NotBefore:    time.Now().Add(-24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create client certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	cred, err := models.NewClientCertificate("test client",
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatalf("failed to build client certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return cred, pool
+}
+
+func newMutualTLSServer(t *testing.T, clientCAs *x509.CertPool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckHTTPEndpointWithClientCertificate(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	cred, pool := newTestClientCertificate(t, time.Now().Add(90*24*time.Hour))
+	if err := db.Create(&cred).Error; err != nil {
+		t.Fatalf("failed to store client certificate: %v", err)
+	}
+	server := newMutualTLSServer(t, pool)
+
+	// The test server's own certificate isn't trusted, trust it for this test
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	original := defaultTransport.TLSClientConfig
+	defaultTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	defer func() { defaultTransport.TLSClientConfig = original }()
+
+	for _, test := range []struct {
+		clientCertificateID string
+		code                int
+	}{
+		{"", 0},
+		{cred.ID, http.StatusOK},
+	} {
+		ep := Endpoint{
+			ID: uuid.New().String(), URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second,
+			MinDaysValid: 30, ClientCertificateID: test.clientCertificateID,
+		}
+		w.runCheck(context.Background(), ep)
+
+		status := latestStatus(t, ep.ID)
+		if status.Code != test.code {
+			t.Errorf("client certificate %q: code = %d, expected %d (%s)", test.clientCertificateID, status.Code, test.code, status.ErrorMessage)
+		}
+	}
+}
+
+func TestCheckSSLEndpointTracksClientCertificateExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	w := &Worker{}
+
+	cred, pool := newTestClientCertificate(t, time.Now().Add(10*24*time.Hour))
+	if err := db.Create(&cred).Error; err != nil {
+		t.Fatalf("failed to store client certificate: %v", err)
+	}
+	server := newMutualTLSServer(t, pool)
+
+	ep := Endpoint{
+		ID: uuid.New().String(), CheckType: "ssl", URL: server.URL, Timeout: 5 * time.Second, MinDaysValid: 30,
+		AcceptableTLSVersions: []string{"TLS 1.2", "TLS 1.3"}, ClientCertificateID: cred.ID,
+	}
+	w.runCheck(context.Background(), ep)
+
+	var status models.SSLStatus
+	if err := db.First(&status, "endpoint_id = ?", ep.ID).Error; err != nil {
+		t.Fatalf("failed to find saved SSL status: %v", err)
+	}
+	if status.TLSVersion == "" {
+		t.Fatalf("expected handshake with client certificate to succeed: %s", status.ErrorMessage)
+	}
+	if status.ClientCertificateDaysUntilExpiry == nil || *status.ClientCertificateDaysUntilExpiry != 9 {
+		t.Fatalf("expected client certificate expiry to be tracked, got %v", status.ClientCertificateDaysUntilExpiry)
+	}
+}
+
+func TestCheckClientCertificateExpiry(t *testing.T) {
+	now := time.Now()
+	ep := Endpoint{URL: "https://internal.example.com", MinDaysValid: 30}
+
+	days, expired := checkClientCertificateExpiry(ep, &models.ClientCertificate{Name: "valid", ExpiresAt: now.Add(45 * 24 * time.Hour)}, now)
+	if days != 45 || expired {
+		t.Errorf("expected 45 days and not expired, got %d, %v", days, expired)
+	}
+	days, expired = checkClientCertificateExpiry(ep, &models.ClientCertificate{Name: "expired", ExpiresAt: now.Add(-time.Hour)}, now)
+	if days != 0 || !expired {
+		t.Errorf("expected expired certificate, got %d, %v", days, expired)
+	}
+}
+
+func TestCheckHTTPEndpointClosesItsConnections(t *testing.T) {
+	var open atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	w := &Worker{}
+	result := w.CheckHTTPEndpoint(context.Background(), Endpoint{ID: uuid.New().String(), URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second})
+	if !result.Passed {
+		t.Fatalf("expected the check to pass, got %+v", result.Status)
+	}
+	// The transport is thrown away with the check, no keep-alive connection may outlive it
+	deadline := time.Now().Add(2 * time.Second)
+	for open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("expected the check's connections closed, %d still open", n)
+	}
+}
@@ -0,0 +1,300 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+// maxTransactionBodySize caps how much of each step's response body is read
+const maxTransactionBodySize = 1 << 20
+
+// CheckTransactionEndpoint runs the endpoint's HTTP steps in order, carrying cookies and
+// extracted variables from one step to the next, and stops at the first failing step
+func (w *Worker) CheckTransactionEndpoint(ctx context.Context, ep Endpoint) Result {
+	results := w.runTransaction(ctx, ep)
+	now := time.Now()
+
+	code := 0
+	responseTime := 0
+	errorMessage := ""
+	for _, result := range results {
+		code = result.Code
+		responseTime += result.ResponseTime
+		if result.ErrorMessage != "" {
+			errorMessage = fmt.Sprintf("step %d (%s): %s", result.StepIndex+1, result.Name, result.ErrorMessage)
+		}
+	}
+
+	status := models.Status{
+		ID:           uuid.New().String(),
+		EndpointID:   ep.ID,
+		Code:         code, // Code of the last step that ran
+		ResponseTime: responseTime,
+		ErrorMessage: errorMessage,
+		CheckedAt:    now,
+	}
+	result := Result{Passed: errorMessage == "", Status: &status}
+
+	for i := range results {
+		// Steps share the transaction's status and timestamp so they list together in order
+		results[i].StatusID = status.ID
+		results[i].CheckedAt = now
+		result.Details = append(result.Details, &results[i])
+	}
+
+	// Log result
+	if errorMessage == "" {
+		log.Printf("✓ Transaction check PASSED for %s (%d steps, %dms)", ep.URL, len(results), responseTime)
+	} else {
+		log.Printf("✗ Transaction check FAILED for %s: %s", ep.URL, errorMessage)
+	}
+	return result
+}
+
+func (w *Worker) runTransaction(ctx context.Context, ep Endpoint) []models.TransactionStepResult {
+	transport, _, err := newHTTPTransport(ep)
+	if err != nil {
+		return []models.TransactionStepResult{{
+			ID:           uuid.New().String(),
+			EndpointID:   ep.ID,
+			Name:         "setup",
+			ErrorMessage: err.Error(),
+		}}
+	}
+	defer transport.CloseIdleConnections()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Timeout:   ep.Timeout,
+		Transport: transport,
+		Jar:       jar,
+	}
+
+	vars := make(map[string]string)
+	results := make([]models.TransactionStepResult, 0, len(ep.TransactionSteps))
+	for i, step := range ep.TransactionSteps {
+		result := w.runTransactionStep(ctx, client, ep, i, step, vars)
+		results = append(results, result)
+		if result.ErrorMessage != "" {
+			break
+		}
+	}
+	return results
+}
+
+func (w *Worker) runTransactionStep(ctx context.Context, client *http.Client, ep Endpoint, index int, step models.TransactionStep, vars map[string]string) models.TransactionStepResult {
+	result := models.TransactionStepResult{
+		ID:         uuid.New().String(),
+		EndpointID: ep.ID,
+		StepIndex:  index,
+		Name:       step.Name,
+		Method:     strings.ToUpper(step.Method),
+	}
+	if result.Name == "" {
+		result.Name = fmt.Sprintf("step %d", index+1)
+	}
+	if result.Method == "" {
+		result.Method = http.MethodGet
+	}
+
+	req, err := buildTransactionRequest(ctx, ep, step, result.Method, vars)
+	if err != nil {
+		result.ErrorMessage = err.Error()
+		return result
+	}
+	result.URL = req.URL.String()
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.ResponseTime = int(time.Since(start).Milliseconds())
+		result.ErrorMessage = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxTransactionBodySize))
+	result.ResponseTime = int(time.Since(start).Milliseconds())
+	result.Code = resp.StatusCode
+	if err != nil {
+		result.ErrorMessage = err.Error()
+		return result
+	}
+	log.Printf("%s %s -> %s (%dms)", result.Method, result.URL, resp.Status, result.ResponseTime)
+
+	expectedCodes := step.ExpectedStatusCodes
+	if len(expectedCodes) == 0 {
+		expectedCodes = defaultExpectedStatusCodes
+	}
+	maxResponseTime := int(ep.MaxResponseTime.Milliseconds())
+	if step.MaxResponseTime > 0 {
+		maxResponseTime = step.MaxResponseTime
+	}
+	if !w.isCheckSuccessful(result.Code, 0, "", expectedCodes, maxResponseTime) {
+		result.ErrorMessage = fmt.Sprintf("unexpected status code %d", result.Code)
+		return result
+	}
+	if result.ResponseTime > maxResponseTime {
+		result.ErrorMessage = fmt.Sprintf("response time %dms exceeded %dms", result.ResponseTime, maxResponseTime)
+		return result
+	}
+	if step.BodyContains != "" && !strings.Contains(string(body), step.BodyContains) {
+		result.ErrorMessage = fmt.Sprintf("response body does not contain %q", step.BodyContains)
+		return result
+	}
+
+	selector := responseSelector{resp: resp, body: body}
+	for _, assertion := range step.Assertions {
+		value, err := selector.selectValue(assertion.TransactionSelector)
+		if err != nil {
+			result.ErrorMessage = fmt.Sprintf("assertion on %s %s: %v", assertion.Source, assertion.Path, err)
+			return result
+		}
+		if assertion.Equals != "" && value != assertion.Equals {
+			result.ErrorMessage = fmt.Sprintf("assertion on %s %s: got %q, expected %q", assertion.Source, assertion.Path, value, assertion.Equals)
+			return result
+		}
+	}
+	for _, extraction := range step.Extract {
+		value, err := selector.selectValue(extraction.TransactionSelector)
+		if err != nil {
+			result.ErrorMessage = fmt.Sprintf("extracting %s from %s %s: %v", extraction.Name, extraction.Source, extraction.Path, err)
+			return result
+		}
+		vars[extraction.Name] = value
+	}
+
+	return result
+}
+
+func buildTransactionRequest(ctx context.Context, ep Endpoint, step models.TransactionStep, method string, vars map[string]string) (*http.Request, error) {
+	rawURL, err := interpolateURL(step.URL, vars)
+	if err != nil {
+		return nil, err
+	}
+	// Step URLs are resolved against the endpoint URL so steps can be written as paths
+	base, err := url.Parse(ep.URL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := interpolate(step.Body, vars, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base.ResolveReference(target).String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range step.Headers {
+		value, err := interpolate(value, vars, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// interpolateURL interpolates a step URL, escaping values for the path or query they land in so
+// an extracted value can't change the request's path or add query parameters
+func interpolateURL(s string, vars map[string]string) (string, error) {
+	path, query, hasQuery := strings.Cut(s, "?")
+	path, err := interpolate(path, vars, url.PathEscape)
+	if err != nil || !hasQuery {
+		return path, err
+	}
+	query, err = interpolate(query, vars, url.QueryEscape)
+	if err != nil {
+		return "", err
+	}
+	return path + "?" + query, nil
+}
+
+// interpolate replaces {{name}} placeholders with previously extracted variables, passed through
+// escape when set
+func interpolate(s string, vars map[string]string, escape func(string) string) (string, error) {
+	var missing []string
+	out := models.TransactionVariablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := models.TransactionVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			if escape != nil {
+				return escape(value)
+			}
+			return value
+		}
+		missing = append(missing, name)
+		return match
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// responseSelector evaluates selectors against a response, decoding the JSON body at most once
+type responseSelector struct {
+	resp    *http.Response
+	body    []byte
+	doc     interface{}
+	decoded bool
+}
+
+func (s *responseSelector) selectValue(sel models.TransactionSelector) (string, error) {
+	switch sel.Source {
+	case models.SourceJSON:
+		if !s.decoded {
+			if err := json.Unmarshal(s.body, &s.doc); err != nil {
+				return "", fmt.Errorf("response is not JSON: %v", err)
+			}
+			s.decoded = true
+		}
+		value, err := lookupJSONPath(s.doc, sel.Path)
+		if err != nil {
+			return "", err
+		}
+		return jsonValueString(value), nil
+	case models.SourceRegex:
+		re, err := regexp.Compile(sel.Path)
+		if err != nil {
+			return "", err
+		}
+		match := re.FindSubmatch(s.body)
+		if match == nil {
+			return "", fmt.Errorf("no match")
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	case models.SourceHeader:
+		values := s.resp.Header.Values(sel.Path)
+		if len(values) == 0 {
+			return "", fmt.Errorf("header not present")
+		}
+		return values[0], nil
+	case models.SourceCookie:
+		for _, cookie := range s.resp.Cookies() {
+			if cookie.Name == sel.Path {
+				return cookie.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cookie not set")
+	default:
+		return "", fmt.Errorf("unknown source %q", sel.Source)
+	}
+}
@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/monty/models"
+)
+
+func newTransactionTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3ss10n"})
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Write([]byte(`{"data":{"token":"abc123","roles":["admin"]}}`))
+	})
+	mux.HandleFunc("/api/me", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		if r.Header.Get("Authorization") != "Bearer abc123" || err != nil || cookie.Value != "s3ss10n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"user":"alice","active":true}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunTransaction(t *testing.T) {
+	server := newTransactionTestServer(t)
+	w := &Worker{}
+
+	steps := []models.TransactionStep{
+		{
+			Name:    "login",
+			Method:  "post",
+			URL:     "/login",
+			Headers: map[string]string{"Content-Type": "application/json"},
+			Body:    `{"user":"alice"}`,
+			Assertions: []models.TransactionAssertion{
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceJSON, Path: "$.data.roles[0]"}, Equals: "admin"},
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceCookie, Path: "session"}},
+			},
+			Extract: []models.TransactionExtraction{
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceJSON, Path: "$.data.token"}, Name: "token"},
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceHeader, Path: "X-Request-Id"}, Name: "request_id"},
+			},
+		},
+		{
+			Name:    "profile",
+			URL:     "/api/me?trace={{request_id}}",
+			Headers: map[string]string{"Authorization": "Bearer {{ token }}"},
+			Assertions: []models.TransactionAssertion{
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceJSON, Path: "active"}, Equals: "true"},
+				{TransactionSelector: models.TransactionSelector{Source: models.SourceRegex, Path: `"user":"(\w+)"`}, Equals: "alice"},
+			},
+		},
+	}
+	ep := Endpoint{ID: uuid.New().String(), URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second, TransactionSteps: steps}
+
+	results := w.runTransaction(context.Background(), ep)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 step results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.ErrorMessage != "" {
+			t.Fatalf("step %q failed: %s", result.Name, result.ErrorMessage)
+		}
+		if result.Code != http.StatusOK {
+			t.Fatalf("step %q returned code %d", result.Name, result.Code)
+		}
+	}
+	if !strings.HasSuffix(results[1].URL, "/api/me?trace=req-1") {
+		t.Fatalf("expected interpolated URL, got %s", results[1].URL)
+	}
+}
+
+func TestRunTransactionStopsAtFailingStep(t *testing.T) {
+	server := newTransactionTestServer(t)
+	w := &Worker{}
+
+	steps := []models.TransactionStep{
+		{Name: "profile without login", URL: "/api/me", Headers: map[string]string{"Authorization": "Bearer {{token}}"}},
+		{Name: "never reached", URL: "/api/me"},
+	}
+	ep := Endpoint{ID: uuid.New().String(), URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second, TransactionSteps: steps}
+
+	results := w.runTransaction(context.Background(), ep)
+	if len(results) != 1 {
+		t.Fatalf("expected transaction to stop after 1 step, got %d", len(results))
+	}
+	if !strings.Contains(results[0].ErrorMessage, "undefined variable token") {
+		t.Fatalf("expected undefined variable error, got %q", results[0].ErrorMessage)
+	}
+
+	steps[0] = models.TransactionStep{Name: "profile", URL: "/api/me"}
+	results = w.runTransaction(context.Background(), ep)
+	if len(results) != 1 || results[0].Code != http.StatusUnauthorized {
+		t.Fatalf("expected a single 401 step, got %+v", results)
+	}
+	if results[0].ErrorMessage != "unexpected status code 401" {
+		t.Fatalf("unexpected error message %q", results[0].ErrorMessage)
+	}
+}
+
+func TestCheckTransactionEndpointRecordsSteps(t *testing.T) {
+	db := setupTestDB(t)
+	models.DB = db
+	server := newTransactionTestServer(t)
+	w := &Worker{}
+
+	ep := Endpoint{
+		ID: uuid.New().String(), CheckType: "transaction", URL: server.URL, Timeout: 5 * time.Second, MaxResponseTime: 5 * time.Second,
+		TransactionSteps: []models.TransactionStep{{Name: "profile", URL: "/api/me"}},
+	}
+	w.runCheck(context.Background(), ep)
+
+	status := latestStatus(t, ep.ID)
+	if status.ErrorMessage != "step 1 (profile): unexpected status code 401" {
+		t.Fatalf("unexpected status error message %q", status.ErrorMessage)
+	}
+
+	var results []models.TransactionStepResult
+	db.Where("status_id = ?", status.ID).Find(&results)
+	if len(results) != 1 || results[0].Code != http.StatusUnauthorized {
+		t.Fatalf("expected one stored step result with code 401, got %+v", results)
+	}
+}
+
+func TestInterpolateURLEscapesValues(t *testing.T) {
+	vars := map[string]string{"id": "../admin", "q": "a&admin=1"}
+
+	got, err := interpolateURL("/users/{{id}}?search={{q}}", vars)
+	if err != nil {
+		t.Fatalf("interpolateURL returned error: %v", err)
+	}
+	if want := "/users/..%2Fadmin?search=a%26admin%3D1"; got != want {
+		t.Errorf("interpolateURL = %s, expected %s", got, want)
+	}
+	if _, err := interpolateURL("/users/{{missing}}", vars); err == nil {
+		t.Error("expected an error for an undefined variable")
+	}
+}
+
+func TestLookupJSONPath(t *testing.T) {
+	doc := map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []interface{}{map[string]interface{}{"name": "first", "count": float64(3)}},
+			"ok":    true,
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+		err      bool
+	}{
+		{"$.data.items[0].name", "first", false},
+		{"$['data']['items'][0]['count']", "3", false},
+		{"data.ok", "true", false},
+		{"$.data.items[1]", "", true},
+		{"$.missing", "", true},
+		{"$.data[", "", true},
+	}
+
+	for _, test := range tests {
+		value, err := lookupJSONPath(doc, test.path)
+		if test.err {
+			if err == nil {
+				t.Errorf("lookupJSONPath(%s) expected error", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("lookupJSONPath(%s) returned error: %v", test.path, err)
+			continue
+		}
+		if got := jsonValueString(value); got != test.expected {
+			t.Errorf("lookupJSONPath(%s) = %s, expected %s", test.path, got, test.expected)
+		}
+	}
+}
@@ -2,20 +2,30 @@ package worker
 
 import (
 "context"
+	"crypto/sha256"
 "crypto/tls"
 "crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 "fmt"
+"io"
 "log"
 "net"
 "net/http"
+	"net/http/httptrace"
+	"slices"
 "strings"
 "sync"
+	"sync/atomic"
 	"time"
 
 "github.com/google/uuid"
 	"github.com/monty/models"
 )
 
+// defaultExpectedStatusCodes are the 2xx and 3xx codes accepted when an endpoint doesn't specify any
+var defaultExpectedStatusCodes = []int{200, 201, 202, 203, 204, 205, 206, 207, 208, 226, 300, 301, 302, 303, 304, 305, 307, 308}
+
 type Endpoint struct {
 ID                   string
 URL                  string
@@ -29,34 +39,231 @@ MinDaysValid         int
 CheckChain           bool
 CheckDomainMatch     bool
 AcceptableTLSVersions []string
+	ClientCertificateID  string
+	ProxyURL             string
+	ExpectFailure        bool
+	AddressFamily        string
+	Retries              int
+	RetryInterval        time.Duration
 	// DNS-specific fields
 	DNSRecordType        string
 	ExpectedDNSAnswers   []int
+	DNSResolvers         []string
+	DNSCheckAuthoritative bool
+	DNSSEC               bool
+	DNSSECTrustAnchor    string
+	DNSSECMinDaysValid   int
+	// Email authentication fields
+	DKIMSelectors        []string
+	// Exec-specific fields
+	ExecArgs             []string
+	ExecEnv              []string
+	// Prometheus-specific fields
+	MetricAssertions     []string
+	// SSH-specific fields
+	SSHHostKeyFingerprint string
+	SSHHostKeyAlgorithm  string
+	SSHUsername          string
+	SSHKeyID             string
+	// NTP-specific fields
+	NTPMaxOffset         time.Duration
 	// TCP-specific fields
 	TCPPort              int
+	// Heartbeat-specific fields
+	HeartbeatSchedule    string
+	HeartbeatGrace       time.Duration
+	HeartbeatMaxRuntime  time.Duration
+	// Transaction-specific fields
+	TransactionSteps     []models.TransactionStep
+	// Content change detection fields
+	ContentMode          string
+	ContentSelectorType  string
+	ContentSelector      string
+	ContentStaleAfter    time.Duration
+	// Security header audit fields
+	SecurityHeaders      bool
+	MinSecurityGrade     string
+	CreatedAt            time.Time
+	// NextCheckAt is scheduling state, not configuration, so it's left out of the fingerprint
+	NextCheckAt          time.Time `json:"-"`
+}
+
+// EndpointFromModel converts a stored endpoint into the worker's representation
+func EndpointFromModel(ep models.Endpoint) Endpoint {
+	var nextCheckAt time.Time
+	if ep.NextCheckAt != nil {
+		nextCheckAt = *ep.NextCheckAt
+	}
+	return Endpoint{
+		ID:                    ep.ID,
+		URL:                   ep.URL,
+		CheckType:             ep.CheckType,
+		Interval:              time.Duration(ep.Interval) * time.Second,
+		Timeout:               time.Duration(ep.Timeout) * time.Second,
+		ExpectedStatusCodes:   []int(ep.ExpectedStatusCodes),
+		MaxResponseTime:       time.Duration(ep.MaxResponseTime) * time.Millisecond,
+		MinDaysValid:          ep.MinDaysValid,
+		CheckChain:            ep.CheckChain,
+		CheckDomainMatch:      ep.CheckDomainMatch,
+		AcceptableTLSVersions: ep.AcceptableTLSVersions,
+		ClientCertificateID:   ep.ClientCertificateID,
+		ProxyURL:              ep.ProxyURL,
+		ExpectFailure:         ep.ExpectFailure,
+		AddressFamily:         ep.AddressFamily,
+		Retries:               ep.Retries,
+		RetryInterval:         time.Duration(ep.RetryInterval) * time.Second,
+		DNSRecordType:         ep.DNSRecordType,
+		ExpectedDNSAnswers:    []int(ep.ExpectedDNSAnswers),
+		DNSResolvers:          ep.DNSResolvers,
+		DNSCheckAuthoritative: ep.DNSCheckAuthoritative,
+		DNSSEC:                ep.DNSSEC,
+		DNSSECTrustAnchor:     ep.DNSSECTrustAnchor,
+		DNSSECMinDaysValid:    ep.DNSSECMinDaysValid,
+		DKIMSelectors:         ep.DKIMSelectors,
+		ExecArgs:              ep.ExecArgs,
+		ExecEnv:               ep.ExecEnv,
+		MetricAssertions:      ep.MetricAssertions,
+		SSHHostKeyFingerprint: ep.SSHHostKeyFingerprint,
+		SSHHostKeyAlgorithm:   ep.SSHHostKeyAlgorithm,
+		SSHUsername:           ep.SSHUsername,
+		SSHKeyID:              ep.SSHKeyID,
+		NTPMaxOffset:          time.Duration(ep.NTPMaxOffset) * time.Millisecond,
+		TCPPort:               ep.TCPPort,
+		HeartbeatSchedule:     ep.HeartbeatSchedule,
+		HeartbeatGrace:        time.Duration(ep.HeartbeatGrace) * time.Second,
+		HeartbeatMaxRuntime:   time.Duration(ep.HeartbeatMaxRuntime) * time.Second,
+		TransactionSteps:      []models.TransactionStep(ep.TransactionSteps),
+		ContentMode:           ep.ContentMode,
+		ContentSelectorType:   ep.ContentSelectorType,
+		ContentSelector:       ep.ContentSelector,
+		ContentStaleAfter:     time.Duration(ep.ContentStaleAfter) * time.Second,
+		SecurityHeaders:       ep.SecurityHeaders,
+		MinSecurityGrade:      ep.MinSecurityGrade,
+		CreatedAt:             ep.CreatedAt,
+		NextCheckAt:           nextCheckAt,
+	}
+}
+
+// monitor is a running monitorEndpoint goroutine and the configuration it was started with
+type monitor struct {
+	ep          Endpoint
+	fingerprint string
+	cancel      context.CancelFunc
 }
 
+// checkCancelGrace is how long Shutdown waits for cancelled checks to return
+const checkCancelGrace = 5 * time.Second
+
 type Worker struct {
 	mu         sync.RWMutex
-	monitored  map[string]context.CancelFunc // endpointID -> cancel function
+	monitored  map[string]*monitor // endpointID -> running monitor
 	discoveryInterval time.Duration
+	executor   *executor // runs the checks monitors schedule
+	ctx        context.Context    // parent of the monitors' contexts
+	abort      context.CancelFunc // cancels every monitor and its running check
+	stopping   chan struct{}      // closed by Shutdown, monitors and discovery stop scheduling
+	stopped    bool               // Shutdown was called, no monitors are started
+	loops      sync.WaitGroup     // running monitor and discovery goroutines
+	cluster    *cluster           // shares the endpoints with other instances, nil when standalone
+	remote     Remote             // replaces the database in probe agents, nil otherwise
+	canary     *canary            // tells the worker's own network failing from its endpoints, nil without canaries
+}
+
+// Remote stands in for the database when the worker runs in a probe agent: endpoints come from a
+// central server and results are sent to it
+type Remote interface {
+	Endpoints() ([]models.Endpoint, error)
+	Record(ep Endpoint, result Result)
 }
 
 func NewWorker(discoveryInterval time.Duration) *Worker {
+	ctx, abort := context.WithCancel(context.Background())
+	return &Worker{
+		monitored:         make(map[string]*monitor),
+		discoveryInterval: discoveryInterval,
+		executor:          newExecutorFromEnv(),
+		ctx:               ctx,
+		abort:             abort,
+		stopping:          make(chan struct{}),
+		cluster:           newClusterFromEnv(),
+		canary:            newCanaryFromEnv(),
+	}
+}
+
+// NewRemoteWorker creates a worker that gets its endpoints from remote and reports its results
+// to it, for probe agents without a database
+func NewRemoteWorker(remote Remote, discoveryInterval time.Duration) *Worker {
+	ctx, abort := context.WithCancel(context.Background())
 	return &Worker{
-		monitored:         make(map[string]context.CancelFunc),
+		monitored:         make(map[string]*monitor),
 		discoveryInterval: discoveryInterval,
+		executor:          newExecutorFromEnv(),
+		ctx:               ctx,
+		abort:             abort,
+		stopping:          make(chan struct{}),
+		remote:            remote,
+		canary:            newCanaryFromEnv(),
 	}
 }
 
 func (w *Worker) Start(initialEndpoints []Endpoint) {
-	// Start monitoring initial endpoints
-	for _, ep := range initialEndpoints {
-		w.startMonitoring(ep)
+	if w.cluster != nil || w.remote != nil {
+		// Only the endpoints this node gets the leases of are monitored, and a probe's come from
+		// its remote
+		w.discoverEndpoints()
+	} else {
+		// Start monitoring initial endpoints
+		for _, ep := range initialEndpoints {
+			w.startMonitoring(ep)
+		}
+	}
+
+	if w.canary != nil {
+		w.loops.Add(1)
+		go func() {
+			defer w.loops.Done()
+			w.canaryLoop()
+		}()
 	}
 
 	// Start discovery loop
-	go w.discoveryLoop()
+	w.loops.Add(1)
+	go func() {
+		defer w.loops.Done()
+		w.discoveryLoop()
+	}()
+}
+
+// Shutdown stops scheduling checks, drops the queued ones and waits for the running ones to finish
+// and save their results. Checks still running when ctx ends are cancelled, and their results
+// discarded, Shutdown then returns ctx's error
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.stopping)
+	}
+	w.mu.Unlock()
+	w.loops.Wait()
+
+	if dropped := w.executor.close(); dropped > 0 {
+		log.Printf("Dropped %d queued checks", dropped)
+	}
+	err := w.executor.wait(ctx)
+	if err != nil {
+		log.Printf("Cancelling %d checks still running", w.executor.Stats().Running)
+		w.abort()
+		grace, cancel := context.WithTimeout(context.Background(), checkCancelGrace)
+		defer cancel()
+		if w.executor.wait(grace) != nil {
+			log.Printf("%d checks didn't return after being cancelled", w.executor.Stats().Running)
+		}
+	}
+	w.abort()
+	if w.cluster != nil {
+		w.cluster.leave()
+	}
+	return err
 }
 
 func (w *Worker) startMonitoring(ep Endpoint) {
@@ -68,11 +275,11 @@ func (w *Worker) startMonitoring(ep Endpoint) {
 		log.Printf("Endpoint %s already being monitored", ep.ID)
 		return
 	}
+	if w.cluster != nil && !w.cluster.acquire(ep.ID) {
+		return // another node checks it
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	w.monitored[ep.ID] = cancel
-
-	go w.monitorEndpoint(ctx, ep)
+	w.startLocked(ep, endpointFingerprint(ep))
 	log.Printf("Started monitoring endpoint %s (%s)", ep.ID, ep.URL)
 }
 
@@ -80,77 +287,157 @@ func (w *Worker) stopMonitoring(endpointID string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if cancel, exists := w.monitored[endpointID]; exists {
-		cancel()
-		delete(w.monitored, endpointID)
+	if w.stopLocked(endpointID) {
 		log.Printf("Stopped monitoring endpoint %s", endpointID)
 	}
 }
 
+// updateMonitoring restarts an endpoint's monitor with its new configuration, or starts it. A
+// monitor already running the same configuration is left alone
 func (w *Worker) updateMonitoring(ep Endpoint) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Stop existing monitoring if any
-	if cancel, exists := w.monitored[ep.ID]; exists {
-		cancel()
-		delete(w.monitored, ep.ID)
+	fingerprint := endpointFingerprint(ep)
+	if m, exists := w.monitored[ep.ID]; exists && m.fingerprint == fingerprint {
+		return
 	}
-
-	// Start new monitoring
-	ctx, cancel := context.WithCancel(context.Background())
-	w.monitored[ep.ID] = cancel
-	go w.monitorEndpoint(ctx, ep)
+	w.stopLocked(ep.ID)
+	if w.cluster != nil && !w.cluster.acquire(ep.ID) {
+		return // another node checks it
+	}
+	w.startLocked(ep, fingerprint)
 	log.Printf("Updated monitoring for endpoint %s (%s)", ep.ID, ep.URL)
 }
 
+// startLocked starts monitoring ep, w.mu must be held. The monitor's context also bounds the checks
+// it runs, so stopping the monitor cancels a check in progress
+func (w *Worker) startLocked(ep Endpoint, fingerprint string) {
+	if w.stopped {
+		return
+	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.monitored[ep.ID] = &monitor{ep: ep, fingerprint: fingerprint, cancel: cancel}
+	w.loops.Add(1)
+	go func() {
+		defer w.loops.Done()
+		w.monitorEndpoint(ctx, ep)
+	}()
+}
+
+// stopLocked stops an endpoint's monitor and reports whether there was one, w.mu must be held
+func (w *Worker) stopLocked(endpointID string) bool {
+	m, exists := w.monitored[endpointID]
+	if !exists {
+		return false
+	}
+	m.cancel()
+	delete(w.monitored, endpointID)
+	return true
+}
+
+// endpointFingerprint identifies an endpoint's configuration, any change to a setting a check uses
+// changes it
+func endpointFingerprint(ep Endpoint) string {
+	data, err := json.Marshal(ep)
+	if err != nil {
+		// Every field marshals, but never treat an unknown configuration as unchanged
+		return uuid.New().String()
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// monitorEndpoint runs the endpoint's first check when it's due and then one in each of its
+// slots, persisting the next run as it goes
 func (w *Worker) monitorEndpoint(ctx context.Context, ep Endpoint) {
-	ticker := time.NewTicker(ep.Interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(firstRun(ep, time.Now())))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-		switch ep.CheckType {
-		case "ssl":
-		go w.CheckSSLEndpoint(ep)
-		case "dns":
-		go w.CheckDNSEndpoint(ep)
-		case "domain":
-		go w.CheckDomainEndpoint(ep)
-		case "ping":
-		go w.CheckPingEndpoint(ep)
-		case "tcp":
-		go w.CheckTCPEndpoint(ep)
-		case "http":
-		default:
-		go w.CheckHTTPEndpoint(ep)
-		}
-		}
+		case <-w.stopping:
+			return
+		case <-timer.C:
+			w.executor.submit(ep, func() { w.runCheck(ctx, ep) })
+			next := nextRun(ep, time.Now())
+			if w.remote == nil {
+				saveNextCheck(ep.ID, next)
+			}
+			timer.Reset(time.Until(next))
 		}
+	}
+}
+
+// runCheck runs one check of ep with its type's checker and records the result. Endpoints checked
+// over both address families get a check, and retries, per family
+func (w *Worker) runCheck(ctx context.Context, ep Endpoint) {
+	if ctx.Err() != nil {
+		return // stopped while the check was queued
+	}
+	c, ok := LookupChecker(ep.CheckType)
+	if !ok {
+		c = httpChecker // what an endpoint without a known type has always been checked as
+	}
+	if ep.AddressFamily == models.AddressFamilyBoth && checkedByFamily(c) {
+		forEachFamily(ctx, ep, func(ctx context.Context, familyEp Endpoint) { w.checkWithRetries(ctx, familyEp, c) })
+		return
+	}
+	w.checkWithRetries(ctx, ep, c)
 }
 
-func (w *Worker) CheckHTTPEndpoint(ep Endpoint) {
-	// Create HTTP client with timeout
+func (w *Worker) CheckHTTPEndpoint(ctx context.Context, ep Endpoint) Result {
+	// Create HTTP client with timeout, presenting the client certificate if one is configured
+	transport, cred, transportErr := newHTTPTransport(ep)
+	if transportErr == nil {
+		defer transport.CloseIdleConnections()
+	}
 	client := &http.Client{
-		Timeout: ep.Timeout,
+		Timeout:   ep.Timeout,
+		Transport: transport,
 	}
 
 	// Determine expected status codes (default to 2xx and 3xx if not specified)
 	expectedCodes := ep.ExpectedStatusCodes
 	if len(expectedCodes) == 0 {
-		expectedCodes = []int{200, 201, 202, 203, 204, 205, 206, 207, 208, 226, 300, 301, 302, 303, 304, 305, 307, 308}
+		expectedCodes = defaultExpectedStatusCodes
+	}
+
+	// Remember the address of the connection the final response came over, and whether any
+	// connection was made at all. Dials of both families may report at once
+	ip := ""
+	var connected atomic.Bool
+	trace := &httptrace.ClientTrace{
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				connected.Store(true)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			ip = targetIP(ep, info.Conn)
+		},
 	}
 
 	// Measure response time
 	start := time.Now()
-	resp, err := client.Get(ep.URL)
+	var resp *http.Response
+	err := transportErr
+	if err == nil {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, ep.URL, nil)
+		if err == nil {
+			resp, err = client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		}
+	}
 	responseTime := int(time.Since(start).Milliseconds())
 
 	code := 0
 	errorMessage := ""
+	var body []byte
+	grade := ""
+	var findings []models.SecurityHeaderFinding
 
 	if err != nil {
 		log.Printf("error requesting %s: %v", ep.URL, err)
@@ -158,11 +445,52 @@ func (w *Worker) CheckHTTPEndpoint(ep Endpoint) {
 	} else {
 		code = resp.StatusCode
 		log.Printf("GET %s -> %s (%dms)", ep.URL, resp.Status, responseTime)
+		if ep.SecurityHeaders && !ep.ExpectFailure {
+			grade, _, findings = auditSecurityHeaders(ep, resp)
+		}
+		if ep.ContentMode != "" {
+			body, err = io.ReadAll(io.LimitReader(resp.Body, maxContentBodySize))
+			if err != nil {
+				errorMessage = err.Error()
+			}
+		}
 		resp.Body.Close()
 	}
 
+	if cred != nil {
+		if _, expired := checkClientCertificateExpiry(ep, cred, time.Now()); expired && errorMessage == "" {
+			errorMessage = "client certificate expired"
+		}
+	}
+
+	// An endpoint that must stay closed passes when it can't be reached or answers with one of its
+	// expected codes, such as a 403 from a firewall, and fails on any other response
+	expectedFailure := ""
+	if ep.ExpectFailure {
+		if err == nil && slices.Contains(ep.ExpectedStatusCodes, code) {
+			expectedFailure = fmt.Sprintf("status %d", code)
+			errorMessage = ""
+		} else {
+			errorMessage, expectedFailure = expectUnreachable(err, connected.Load(), fmt.Sprintf("status %d", code))
+		}
+	}
+
+	// Watch the response content for changes, only successful responses are compared
+	if ep.ContentMode != "" && !ep.ExpectFailure && errorMessage == "" && w.isCheckSuccessful(code, 0, "", expectedCodes, 0) {
+		errorMessage = w.trackContent(ep, body, time.Now())
+	}
+
+	// Fail when the security headers regress below the configured grade
+	if grade != "" && ep.MinSecurityGrade != "" && errorMessage == "" &&
+		models.SecurityGradeRank(grade) > models.SecurityGradeRank(ep.MinSecurityGrade) {
+		errorMessage = fmt.Sprintf("security headers graded %s, below %s", grade, ep.MinSecurityGrade)
+	}
+
 	// Determine if the check was successful
 	isSuccessful := w.isCheckSuccessful(code, responseTime, errorMessage, expectedCodes, int(ep.MaxResponseTime.Milliseconds()))
+	if ep.ExpectFailure {
+		isSuccessful = errorMessage == ""
+	}
 
 	status := models.Status{
 		ID:           uuid.New().String(),
@@ -170,18 +498,28 @@ func (w *Worker) CheckHTTPEndpoint(ep Endpoint) {
 		Code:         code,
 		ResponseTime: responseTime,
 		ErrorMessage: errorMessage,
+		RemoteIP:      ip,
+		AddressFamily: resultFamily(ep, ip),
+		SecurityGrade: grade,
+		ExpectedFailure: expectedFailure,
 		CheckedAt:    time.Now(),
 	}
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save status for %s: %v", ep.URL, err)
+	result := Result{Passed: isSuccessful, Status: &status}
+	for i := range findings {
+		findings[i].StatusID = status.ID
+		findings[i].CheckedAt = status.CheckedAt
+		result.Details = append(result.Details, &findings[i])
 	}
 
 	// Log success/failure status
-	if isSuccessful {
-		log.Printf("✓ Health check PASSED for %s", ep.URL)
+	if isSuccessful && expectedFailure != "" {
+		log.Printf("✓ Health check PASSED for %s, unreachable as expected: %s", checkTarget(ep), expectedFailure)
+	} else if isSuccessful {
+		log.Printf("✓ Health check PASSED for %s", checkTarget(ep))
 	} else {
-		log.Printf("✗ Health check FAILED for %s", ep.URL)
+		log.Printf("✗ Health check FAILED for %s", checkTarget(ep))
 	}
+	return result
 }
 
 func (w *Worker) isCheckSuccessful(code, responseTime int, errorMessage string, expectedCodes []int, maxResponseTime int) bool {
@@ -210,50 +548,67 @@ func (w *Worker) isCheckSuccessful(code, responseTime int, errorMessage string,
 	return true
 }
 
-func (w *Worker) CheckSSLEndpoint(ep Endpoint) {
+func (w *Worker) CheckSSLEndpoint(ctx context.Context, ep Endpoint) Result {
 	// Parse the URL to extract host and port
 	host, port, err := parseHostPort(ep.URL)
 	if err != nil {
 		log.Printf("Failed to parse URL %s: %v", ep.URL, err)
-		w.saveSSLStatus(ep.ID, models.SSLStatus{
-			ID:           uuid.New().String(),
-			EndpointID:   ep.ID,
-			IsValid:      false,
-			ErrorMessage: err.Error(),
-			CheckedAt:    time.Now(),
+		return sslResult(models.SSLStatus{
+			ID:            uuid.New().String(),
+			EndpointID:    ep.ID,
+			IsValid:       false,
+			AddressFamily: resultFamily(ep, ""),
+			ErrorMessage:  err.Error(),
+			CheckedAt:     time.Now(),
 		})
-		return
 	}
 
-	// Establish TLS connection
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: ep.Timeout}, "tcp", net.JoinHostPort(host, port), &tls.Config{
-		InsecureSkipVerify: true, // We'll verify manually
-	})
+	// Establish TLS connection, presenting the client certificate if one is configured
+	cred, err := loadClientCertificate(ep)
+	var tlsConfig *tls.Config
+	if err == nil {
+		tlsConfig, err = newTLSConfig(nil, cred)
+	}
 	if err != nil {
-		log.Printf("TLS connection failed for %s: %v", ep.URL, err)
-		w.saveSSLStatus(ep.ID, models.SSLStatus{
-			ID:           uuid.New().String(),
-			EndpointID:   ep.ID,
-			IsValid:      false,
-			ErrorMessage: err.Error(),
-			CheckedAt:    time.Now(),
+		log.Printf("Failed to load client certificate for %s: %v", ep.URL, err)
+		return sslResult(models.SSLStatus{
+			ID:            uuid.New().String(),
+			EndpointID:    ep.ID,
+			IsValid:       false,
+			AddressFamily: resultFamily(ep, ""),
+			ErrorMessage:  err.Error(),
+			CheckedAt:     time.Now(),
+		})
+	}
+	tlsConfig.InsecureSkipVerify = true // We'll verify manually
+	conn, err := dialTLS(ctx, ep, host, port, tlsConfig)
+	if err != nil {
+		log.Printf("TLS connection failed for %s: %v", checkTarget(ep), err)
+		return sslResult(models.SSLStatus{
+			ID:            uuid.New().String(),
+			EndpointID:    ep.ID,
+			IsValid:       false,
+			AddressFamily: resultFamily(ep, ""),
+			ErrorMessage:  err.Error(),
+			CheckedAt:     time.Now(),
 		})
-		return
 	}
 	defer conn.Close()
+	ip := targetIP(ep, conn)
 
 	// Get certificate chain
 	certs := conn.ConnectionState().PeerCertificates
 	if len(certs) == 0 {
 		log.Printf("No certificates found for %s", ep.URL)
-		w.saveSSLStatus(ep.ID, models.SSLStatus{
-			ID:           uuid.New().String(),
-			EndpointID:   ep.ID,
-			IsValid:      false,
-			ErrorMessage: "No certificates found",
-			CheckedAt:    time.Now(),
+		return sslResult(models.SSLStatus{
+			ID:            uuid.New().String(),
+			EndpointID:    ep.ID,
+			IsValid:       false,
+			RemoteIP:      ip,
+			AddressFamily: resultFamily(ep, ip),
+			ErrorMessage:  "No certificates found",
+			CheckedAt:     time.Now(),
 		})
-		return
 	}
 
 	// Use leaf certificate
@@ -282,14 +637,27 @@ func (w *Worker) CheckSSLEndpoint(ep Endpoint) {
 	tlsVersion := tlsVersionString(conn.ConnectionState().Version)
 	versionAcceptable := w.isTLSVersionAcceptable(tlsVersion, ep.AcceptableTLSVersions)
 
+	// Check the client certificate's own expiry
+	clientCertExpired := false
+	clientCertExpiresSoon := false
+	var clientCertExpiresAt *time.Time
+	var clientCertDays *int
+	if cred != nil {
+		days, expired := checkClientCertificateExpiry(ep, cred, now)
+		clientCertExpired = expired
+		clientCertExpiresSoon = days < ep.MinDaysValid
+		clientCertExpiresAt = &cred.ExpiresAt
+		clientCertDays = &days
+	}
+
 	// Determine overall validity - only fail if expired
-	isValid := !isExpired && domainMatches && chainValid && versionAcceptable
+	isValid := !isExpired && domainMatches && chainValid && versionAcceptable && !clientCertExpired
 
 	// Log result
 	if isValid {
-		log.Printf("✓ SSL check PASSED for %s (expires in %d days)", ep.URL, daysUntilExpiry)
+		log.Printf("✓ SSL check PASSED for %s (expires in %d days)", checkTarget(ep), daysUntilExpiry)
 	} else {
-		log.Printf("✗ SSL check FAILED for %s (expires in %d days)", ep.URL, daysUntilExpiry)
+		log.Printf("✗ SSL check FAILED for %s (expires in %d days)", checkTarget(ep), daysUntilExpiry)
 	}
 
 	// Save status
@@ -305,6 +673,10 @@ func (w *Worker) CheckSSLEndpoint(ep Endpoint) {
 		Subject:              cert.Subject.String(),
 		TLSVersion:           tlsVersion,
 		SerialNumber:         cert.SerialNumber.String(),
+		ClientCertificateExpiresAt:       clientCertExpiresAt,
+		ClientCertificateDaysUntilExpiry: clientCertDays,
+		RemoteIP:             ip,
+		AddressFamily:        resultFamily(ep, ip),
 		ErrorMessage:         "",
 		CheckedAt:            now,
 	}
@@ -323,19 +695,24 @@ func (w *Worker) CheckSSLEndpoint(ep Endpoint) {
 		if !versionAcceptable {
 			errors = append(errors, "unsupported TLS version")
 		}
+		if clientCertExpired {
+			errors = append(errors, "client certificate expired")
+		}
 		status.ErrorMessage = strings.Join(errors, "; ")
 		if expiresSoon {
 			status.ErrorMessage += " (warning: certificate expires soon)"
 		}
+		if clientCertExpiresSoon && !clientCertExpired {
+			status.ErrorMessage += " (warning: client certificate expires soon)"
+		}
 	}
 
-	w.saveSSLStatus(ep.ID, status)
+	return sslResult(status)
 }
 
-func (w *Worker) saveSSLStatus(endpointID string, status models.SSLStatus) {
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save SSL status for %s: %v", endpointID, err)
-	}
+// sslResult wraps an SSL check's status, the check passes when the certificate is valid
+func sslResult(status models.SSLStatus) Result {
+	return Result{Passed: status.IsValid, SSLStatus: &status}
 }
 
 func parseHostPort(url string) (host, port string, err error) {
@@ -413,7 +790,11 @@ return true
 return false
 }
 
-func (w *Worker) CheckDNSEndpoint(ep Endpoint) {
+func (w *Worker) CheckDNSEndpoint(ctx context.Context, ep Endpoint) Result {
+	if ep.DNSSEC {
+		return w.CheckDNSSECEndpoint(ctx, ep)
+	}
+
 	start := time.Now()
 
 	// For DNS checks, the URL should be a domain name
@@ -426,30 +807,30 @@ func (w *Worker) CheckDNSEndpoint(ep Endpoint) {
 
 	switch ep.DNSRecordType {
 	case "A":
-		answers, err = net.LookupHost(domain)
+		answers, err = net.DefaultResolver.LookupHost(ctx, domain)
 	case "AAAA":
-		answers, err = net.LookupHost(domain) // This returns IPv4, we need IPv6
+		answers, err = net.DefaultResolver.LookupHost(ctx, domain) // This returns IPv4, we need IPv6
 		// For IPv6, we'd need net.LookupIP with IPv6 filter, but this is simplified
 	case "CNAME":
-		cname, err := net.LookupCNAME(domain)
+		cname, err := net.DefaultResolver.LookupCNAME(ctx, domain)
 		if err == nil {
 			answers = []string{cname}
 		}
 	case "MX":
-		mxs, err := net.LookupMX(domain)
+		mxs, err := net.DefaultResolver.LookupMX(ctx, domain)
 		if err == nil {
 			for _, mx := range mxs {
 				answers = append(answers, mx.Host)
 			}
 		}
 	case "TXT":
-		txts, err := net.LookupTXT(domain)
+		txts, err := net.DefaultResolver.LookupTXT(ctx, domain)
 		if err == nil {
 			answers = txts
 		}
 	default:
 		// Default to A record
-		answers, err = net.LookupHost(domain)
+		answers, err = net.DefaultResolver.LookupHost(ctx, domain)
 	}
 
 	responseTime := int(time.Since(start).Milliseconds())
@@ -475,9 +856,7 @@ func (w *Worker) CheckDNSEndpoint(ep Endpoint) {
 		ErrorMessage: errorMessage,
 		CheckedAt:    time.Now(),
 	}
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save DNS status for %s: %v", ep.URL, err)
-	}
+	result := Result{Passed: isSuccessful, Status: &status}
 
 	// Log result
 	if isSuccessful {
@@ -485,9 +864,10 @@ func (w *Worker) CheckDNSEndpoint(ep Endpoint) {
 	} else {
 		log.Printf("✗ DNS check FAILED for %s (%s) - %d answers", ep.URL, ep.DNSRecordType, len(answers))
 	}
+	return result
 }
 
-func (w *Worker) CheckPingEndpoint(ep Endpoint) {
+func (w *Worker) CheckPingEndpoint(ctx context.Context, ep Endpoint) Result {
 	start := time.Now()
 
 	// For ping checks, extract host from URL
@@ -506,16 +886,24 @@ func (w *Worker) CheckPingEndpoint(ep Endpoint) {
 		port = "80"
 	}
 
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), ep.Timeout)
+	conn, err := dialTCP(ctx, ep, net.JoinHostPort(host, port))
 	responseTime := int(time.Since(start).Milliseconds())
 	errorMessage := ""
+	ip := ""
 
 	if err != nil {
 		errorMessage = err.Error()
 	} else {
+		ip = targetIP(ep, conn)
 		conn.Close()
 	}
 
+	expectedFailure := ""
+	if ep.ExpectFailure {
+		// Dialing is the whole check, any error came before a connection
+		errorMessage, expectedFailure = expectUnreachable(err, false, "connected to "+ip)
+	}
+
 	isSuccessful := errorMessage == ""
 
 	// Save status
@@ -525,21 +913,25 @@ func (w *Worker) CheckPingEndpoint(ep Endpoint) {
 		Code:         0, // Ping doesn't have HTTP codes
 		ResponseTime: responseTime,
 		ErrorMessage: errorMessage,
+		RemoteIP:      ip,
+		AddressFamily: resultFamily(ep, ip),
+		ExpectedFailure: expectedFailure,
 		CheckedAt:    time.Now(),
 	}
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save ping status for %s: %v", ep.URL, err)
-	}
+	result := Result{Passed: isSuccessful, Status: &status}
 
 	// Log result
-	if isSuccessful {
-		log.Printf("✓ PING check PASSED for %s (%dms)", ep.URL, responseTime)
+	if isSuccessful && expectedFailure != "" {
+		log.Printf("✓ PING check PASSED for %s, unreachable as expected: %s", checkTarget(ep), expectedFailure)
+	} else if isSuccessful {
+		log.Printf("✓ PING check PASSED for %s (%dms)", checkTarget(ep), responseTime)
 	} else {
-		log.Printf("✗ PING check FAILED for %s", ep.URL)
+		log.Printf("✗ PING check FAILED for %s", checkTarget(ep))
 	}
+	return result
 }
 
-func (w *Worker) CheckDomainEndpoint(ep Endpoint) {
+func (w *Worker) CheckDomainEndpoint(ctx context.Context, ep Endpoint) Result {
 	// Extract domain from URL
 	domain := strings.TrimPrefix(ep.URL, "http://")
 	domain = strings.TrimPrefix(domain, "https://")
@@ -561,7 +953,6 @@ func (w *Worker) CheckDomainEndpoint(ep Endpoint) {
 	// Log result
 	log.Printf("✓ Domain check PASSED for %s - expires in %d days", domain, daysUntilExpiry)
 
-	// Save status
 	status := models.DomainStatus{
 		ID:              uuid.New().String(),
 		EndpointID:      ep.ID,
@@ -573,12 +964,10 @@ func (w *Worker) CheckDomainEndpoint(ep Endpoint) {
 		CheckedAt:       now,
 	}
 
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save domain status for %s: %v", ep.URL, err)
-	}
+	return Result{Passed: errorMessage == "", DomainStatus: &status}
 }
 
-func (w *Worker) CheckTCPEndpoint(ep Endpoint) {
+func (w *Worker) CheckTCPEndpoint(ctx context.Context, ep Endpoint) Result {
 	start := time.Now()
 
 	// Extract host from URL
@@ -594,16 +983,24 @@ func (w *Worker) CheckTCPEndpoint(ep Endpoint) {
 		port = 80
 	}
 
-	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)), ep.Timeout)
+	conn, err := dialTCP(ctx, ep, net.JoinHostPort(host, fmt.Sprintf("%d", port)))
 	responseTime := int(time.Since(start).Milliseconds())
 	errorMessage := ""
+	ip := ""
 
 	if err != nil {
 		errorMessage = err.Error()
 	} else {
+		ip = targetIP(ep, conn)
 		conn.Close()
 	}
 
+	expectedFailure := ""
+	if ep.ExpectFailure {
+		// Dialing is the whole check, any error came before a connection
+		errorMessage, expectedFailure = expectUnreachable(err, false, "connected to "+ip)
+	}
+
 	isSuccessful := errorMessage == ""
 
 	// Save status
@@ -613,104 +1010,132 @@ func (w *Worker) CheckTCPEndpoint(ep Endpoint) {
 		Code:         0, // TCP doesn't have HTTP codes
 		ResponseTime: responseTime,
 		ErrorMessage: errorMessage,
+		RemoteIP:      ip,
+		AddressFamily: resultFamily(ep, ip),
+		ExpectedFailure: expectedFailure,
 		CheckedAt:    time.Now(),
 	}
-	if err := models.DB.Create(&status).Error; err != nil {
-		log.Printf("failed to save TCP status for %s: %v", ep.URL, err)
-	}
+	result := Result{Passed: isSuccessful, Status: &status}
 
 	// Log result
-	if isSuccessful {
-		log.Printf("✓ TCP check PASSED for %s:%d (%dms)", ep.URL, port, responseTime)
+	if isSuccessful && expectedFailure != "" {
+		log.Printf("✓ TCP check PASSED for %s:%d, unreachable as expected: %s", checkTarget(ep), port, expectedFailure)
+	} else if isSuccessful {
+		log.Printf("✓ TCP check PASSED for %s:%d (%dms)", checkTarget(ep), port, responseTime)
 	} else {
-		log.Printf("✗ TCP check FAILED for %s:%d", ep.URL, port)
+		log.Printf("✗ TCP check FAILED for %s:%d", checkTarget(ep), port)
 	}
+	return result
 }
 
 func (w *Worker) discoveryLoop() {
-	ticker := time.NewTicker(w.discoveryInterval)
+	interval := w.discoveryInterval
+	if w.cluster != nil && w.cluster.renewInterval() < interval {
+		interval = w.cluster.renewInterval() // discovery renews the leases
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		w.discoverEndpoints()
+	for {
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+			w.discoverEndpoints()
+		}
 	}
 }
 
+// discoverEndpoints reconciles the running monitors with the endpoints in the database: new
+// endpoints are started, deleted ones stopped, and only those whose configuration changed restarted.
+// The endpoints are read under the lock. The API changes the database before it starts, updates or
+// stops a monitor, so that call always comes after a reconciliation that read the old state and
+// its change isn't undone. Probe agents have no API and fetch theirs before taking the lock. In cluster mode only the endpoints whose lease this node holds are wanted
 func (w *Worker) discoverEndpoints() {
 	var dbEndpoints []models.Endpoint
-	if err := models.DB.Find(&dbEndpoints).Error; err != nil {
-		log.Printf("Failed to query endpoints: %v", err)
-		return
+	var err error
+	if w.remote != nil {
+		// A probe agent's endpoints come from the server, which can take its whole timeout to
+		// answer. Nothing else starts or stops an agent's monitors, so the fetch doesn't need the
+		// lock, and holding it would block Shutdown
+		dbEndpoints, err = w.endpoints()
 	}
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Create map of current DB endpoints
-	dbEndpointMap := make(map[string]Endpoint)
-	for _, ep := range dbEndpoints {
-		expectedCodes := []int(ep.ExpectedStatusCodes)
-		if len(expectedCodes) == 0 {
-			expectedCodes = []int{200, 201, 202, 203, 204, 205, 206, 207, 208, 226, 300, 301, 302, 303, 304, 305, 307, 308}
+	if w.remote == nil {
+		dbEndpoints, err = w.endpoints()
+	}
+	if err != nil {
+		log.Printf("Failed to query endpoints: %v", err)
+		if w.cluster != nil && w.cluster.lapsed() {
+			for id := range w.monitored {
+				w.stopLocked(id)
+			}
+			log.Printf("Stopped all monitors, the node's leases expired")
 		}
+		return
+	}
 
-		dbEndpointMap[ep.ID] = Endpoint{
-		ID:                   ep.ID,
-		URL:                  ep.URL,
-		CheckType:            ep.CheckType,
-		Interval:             time.Duration(ep.Interval) * time.Second,
-		Timeout:              time.Duration(ep.Timeout) * time.Second,
-		ExpectedStatusCodes:  expectedCodes,
-		MaxResponseTime:      time.Duration(ep.MaxResponseTime) * time.Millisecond,
-		MinDaysValid:         ep.MinDaysValid,
-		CheckChain:           ep.CheckChain,
-		CheckDomainMatch:     ep.CheckDomainMatch,
-		AcceptableTLSVersions: ep.AcceptableTLSVersions,
-		 DNSRecordType:        ep.DNSRecordType,
-			ExpectedDNSAnswers:   []int(ep.ExpectedDNSAnswers),
-			TCPPort:              ep.TCPPort,
+	var owned map[string]bool
+	if w.cluster != nil {
+		ids := make([]string, 0, len(dbEndpoints))
+		for _, ep := range dbEndpoints {
+			ids = append(ids, ep.ID)
+		}
+		var err error
+		if owned, err = w.cluster.sync(ids); err != nil {
+			log.Printf("Failed to renew endpoint leases: %v", err)
 		}
 	}
 
-	// Find endpoints to start, stop, or update
-	toStart := make([]Endpoint, 0)
-	toStop := make([]string, 0)
-	toUpdate := make([]Endpoint, 0)
+	wanted := make(map[string]Endpoint, len(dbEndpoints))
+	for _, ep := range dbEndpoints {
+		if owned == nil || owned[ep.ID] {
+			wanted[ep.ID] = EndpointFromModel(ep)
+		}
+	}
 
-	// Check current monitored endpoints
+	started, stopped, restarted := 0, 0, 0
 	for id := range w.monitored {
-		if dbEp, exists := dbEndpointMap[id]; exists {
-			// Endpoint exists in DB, check if it changed
-			currentEp := Endpoint{ID: id, URL: dbEp.URL, Interval: dbEp.Interval}
-			// For now, assume we need to restart if interval changed
-			// TODO: More sophisticated change detection
-			toUpdate = append(toUpdate, currentEp)
-		} else {
-			// Endpoint no longer exists in DB
-			toStop = append(toStop, id)
+		if _, exists := wanted[id]; !exists {
+			w.stopLocked(id)
+			stopped++
 		}
-		delete(dbEndpointMap, id)
 	}
-
-	// Remaining endpoints in dbEndpointMap need to be started
-	for _, ep := range dbEndpointMap {
-		toStart = append(toStart, ep)
+	for id, ep := range wanted {
+		fingerprint := endpointFingerprint(ep)
+		m, exists := w.monitored[id]
+		switch {
+		case !exists:
+			w.startLocked(ep, fingerprint)
+			started++
+		case m.fingerprint != fingerprint:
+			w.stopLocked(id)
+			w.startLocked(ep, fingerprint)
+			restarted++
+		}
 	}
 
-	w.mu.Unlock() // Unlock before making changes to avoid deadlocks
-
-	// Apply changes
-	for _, id := range toStop {
-		w.stopMonitoring(id)
-	}
-	for _, ep := range toStart {
-		w.startMonitoring(ep)
-	}
-	for _, ep := range toUpdate {
-		w.updateMonitoring(ep)
+	if started+stopped+restarted > 0 {
+		log.Printf("Discovery: started %d, stopped %d, restarted %d endpoint monitors", started, stopped, restarted)
 	}
+}
 
-	w.mu.Lock() // Re-lock for the defer
+// endpoints returns every endpoint, from the database or the worker's remote
+func (w *Worker) endpoints() ([]models.Endpoint, error) {
+	if w.remote != nil {
+		endpoints, err := w.remote.Endpoints()
+		// Content snapshots live in the database, the central worker watches the content
+		for i := range endpoints {
+			endpoints[i].ContentMode = ""
+		}
+		return endpoints, err
+	}
+	var endpoints []models.Endpoint
+	err := models.DB.Find(&endpoints).Error
+	return endpoints, err
 }
 
 // Global worker instance for immediate updates
@@ -753,6 +1178,47 @@ func UpdateMonitoring(ep Endpoint) {
 	}
 }
 
+// Shutdown stops the global worker, see Worker.Shutdown
+func Shutdown(ctx context.Context) error {
+	if GlobalWorker == nil {
+		return nil
+	}
+	return GlobalWorker.Shutdown(ctx)
+}
+
+// Stats returns the load of the global worker's check executor
+func Stats() ExecutorStats {
+	if GlobalWorker == nil {
+		return ExecutorStats{}
+	}
+	return GlobalWorker.executor.Stats()
+}
+
+// Cluster returns the global worker's view of the cluster, and false when it runs standalone
+func Cluster() (ClusterStats, bool) {
+	if GlobalWorker == nil || GlobalWorker.cluster == nil {
+		return ClusterStats{}, false
+	}
+	return GlobalWorker.cluster.Stats(), true
+}
+
+// Canary returns what the global worker's canaries last saw of its network, and false when it has
+// no canaries
+func Canary() (CanaryStats, bool) {
+	if GlobalWorker == nil {
+		return CanaryStats{}, false
+	}
+	return GlobalWorker.Canary()
+}
+
+// Canary returns what the worker's canaries last saw of its network, and false when it has none
+func (w *Worker) Canary() (CanaryStats, bool) {
+	if w.canary == nil {
+		return CanaryStats{}, false
+	}
+	return w.canary.Stats(), true
+}
+
 // Legacy function for backward compatibility
 func Start(endpoints []Endpoint) {
 	worker := NewWorker(1 * time.Minute) // Default 1 minute discovery
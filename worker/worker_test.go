@@ -1,7 +1,9 @@
 package worker
 
 import (
+	"context"
 	"crypto/x509"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,13 +21,47 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to open sqlite: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.Endpoint{}, &models.Status{}, &models.SSLStatus{}); err != nil {
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Status{}, &models.SSLStatus{}, &models.HeartbeatPing{}, &models.TransactionStepResult{}, &models.ContentSnapshot{}, &models.ContentChange{}, &models.ClientCertificate{}, &models.DNSResolverResult{}, &models.DNSSECSignature{}, &models.EmailAuthFinding{}, &models.ExecMetric{}, &models.SecurityHeaderFinding{}, &models.SSHKey{}, &models.NTPResult{}, &models.ClusterNode{}, &models.EndpointLease{}, &models.Incident{}); err != nil {
 		t.Fatalf("failed to migrate schema: %v", err)
 	}
 
 	return db
 }
 
+// runStatusCheck runs the endpoint's check once on a fresh worker and returns the status it
+// recorded. The endpoint gets an ID and a 5 second timeout unless the test sets them
+func runStatusCheck(t *testing.T, ep Endpoint) models.Status {
+	t.Helper()
+	if ep.ID == "" {
+		ep.ID = uuid.New().String()
+	}
+	if ep.Timeout == 0 {
+		ep.Timeout = 5 * time.Second
+	}
+	(&Worker{}).runCheck(context.Background(), ep)
+	return latestStatus(t, ep.ID)
+}
+
+// latestStatus returns the status most recently recorded for the endpoint
+func latestStatus(t *testing.T, endpointID string) models.Status {
+	t.Helper()
+	var status models.Status
+	if err := models.DB.Order("checked_at desc").First(&status, "endpoint_id = ?", endpointID).Error; err != nil {
+		t.Fatalf("expected status saved: %v", err)
+	}
+	return status
+}
+
+// statusesOf returns every status recorded for the endpoint
+func statusesOf(t *testing.T, endpointID string) []models.Status {
+	t.Helper()
+	var statuses []models.Status
+	if err := models.DB.Where("endpoint_id = ?", endpointID).Find(&statuses).Error; err != nil {
+		t.Fatalf("failed to load statuses: %v", err)
+	}
+	return statuses
+}
+
 func TestParseHostPort(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -121,8 +157,6 @@ func TestWorkerSaveSSLStatus(t *testing.T) {
 	db := setupTestDB(t)
 	models.DB = db
 
-	w := &Worker{}
-
 	status := models.SSLStatus{
 		ID:                   uuid.New().String(),
 		EndpointID:           uuid.New().String(),
@@ -139,7 +173,7 @@ func TestWorkerSaveSSLStatus(t *testing.T) {
 		CheckedAt:            time.Now(),
 	}
 
-	w.saveSSLStatus(status.EndpointID, status)
+	(&Worker{}).record(Endpoint{ID: status.EndpointID}, sslResult(status), 1)
 
 	// Verify it was saved
 	var saved models.SSLStatus
@@ -155,3 +189,128 @@ func TestWorkerSaveSSLStatus(t *testing.T) {
 		t.Errorf("saved IsValid = %v, expected %v", saved.IsValid, status.IsValid)
 	}
 }
+
+// monitorOf returns the monitor running for an endpoint, nil when there is none
+func monitorOf(w *Worker, id string) *monitor {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.monitored[id]
+}
+
+func stopAllMonitors(w *Worker) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id := range w.monitored {
+		w.stopLocked(id)
+	}
+}
+
+// createTestEndpoints replaces the stored endpoints. Their next check is an hour out, so monitors
+// started for them don't check anything during the test
+func createTestEndpoints(t *testing.T, endpoints ...*models.Endpoint) {
+	t.Helper()
+	models.DB.Where("1 = 1").Delete(&models.Endpoint{})
+	next := time.Now().Add(time.Hour)
+	for _, ep := range endpoints {
+		ep.NextCheckAt = &next
+		if err := models.DB.Create(ep).Error; err != nil {
+			t.Fatalf("failed to create endpoint: %v", err)
+		}
+	}
+}
+
+func TestDiscoverEndpointsReconciles(t *testing.T) {
+	models.DB = setupTestDB(t)
+	tcp := &models.Endpoint{ID: uuid.New().String(), URL: "bastion.example.com", CheckType: "tcp", TCPPort: 2222, Timeout: 7, Interval: 3600}
+	web := &models.Endpoint{ID: uuid.New().String(), URL: "https://example.com", Interval: 3600, ExpectedStatusCodes: models.IntArray{204}}
+	createTestEndpoints(t, tcp, web)
+
+	w := NewWorker(time.Hour)
+	t.Cleanup(func() { stopAllMonitors(w) })
+	w.discoverEndpoints()
+
+	tcpMonitor, webMonitor := monitorOf(w, tcp.ID), monitorOf(w, web.ID)
+	if tcpMonitor == nil || webMonitor == nil {
+		t.Fatalf("expected both endpoints to be monitored")
+	}
+	if tcpMonitor.ep.CheckType != "tcp" || tcpMonitor.ep.TCPPort != 2222 || tcpMonitor.ep.Timeout != 7*time.Second {
+		t.Errorf("expected the full configuration to be kept, got %+v", tcpMonitor.ep)
+	}
+	if len(webMonitor.ep.ExpectedStatusCodes) != 1 || webMonitor.ep.ExpectedStatusCodes[0] != 204 {
+		t.Errorf("expected the expected status codes to be kept, got %v", webMonitor.ep.ExpectedStatusCodes)
+	}
+
+	// Nothing changed, nothing restarts
+	w.discoverEndpoints()
+	if monitorOf(w, tcp.ID) != tcpMonitor || monitorOf(w, web.ID) != webMonitor {
+		t.Fatalf("expected unchanged endpoints to keep their monitors")
+	}
+
+	// Only the changed endpoint restarts
+	web.Timeout = 9
+	if err := models.DB.Save(web).Error; err != nil {
+		t.Fatalf("failed to update endpoint: %v", err)
+	}
+	w.discoverEndpoints()
+	if monitorOf(w, tcp.ID) != tcpMonitor {
+		t.Errorf("expected the unchanged endpoint to keep its monitor")
+	}
+	if m := monitorOf(w, web.ID); m == webMonitor || m.ep.Timeout != 9*time.Second {
+		t.Errorf("expected the changed endpoint to restart with its new timeout")
+	}
+
+	// An update with the running configuration is a no-op
+	webMonitor = monitorOf(w, web.ID)
+	w.updateMonitoring(webMonitor.ep)
+	if monitorOf(w, web.ID) != webMonitor {
+		t.Errorf("expected an update without changes to keep the monitor")
+	}
+
+	models.DB.Delete(&models.Endpoint{}, "id = ?", tcp.ID)
+	w.discoverEndpoints()
+	if monitorOf(w, tcp.ID) != nil {
+		t.Errorf("expected the deleted endpoint to stop")
+	}
+}
+
+func TestDiscoverEndpointsConcurrentWithAPI(t *testing.T) {
+	models.DB = setupTestDB(t)
+	var endpoints []*models.Endpoint
+	for i := 0; i < 5; i++ {
+		endpoints = append(endpoints, &models.Endpoint{ID: uuid.New().String(), URL: "https://example.com", Interval: 3600})
+	}
+	createTestEndpoints(t, endpoints...)
+
+	w := NewWorker(time.Hour)
+	t.Cleanup(func() { stopAllMonitors(w) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				w.discoverEndpoints()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j, ep := range endpoints {
+				workerEp := EndpointFromModel(*ep)
+				w.startMonitoring(workerEp)
+				workerEp.Timeout = time.Duration(j) * time.Second
+				w.updateMonitoring(workerEp)
+				w.stopMonitoring(ep.ID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.discoverEndpoints()
+	for _, ep := range endpoints {
+		m := monitorOf(w, ep.ID)
+		if m == nil || m.fingerprint != endpointFingerprint(EndpointFromModel(*ep)) {
+			t.Errorf("expected endpoint %s to run its stored configuration after reconciling", ep.ID)
+		}
+	}
+}